@@ -0,0 +1,52 @@
+// Package main serves as the entry point for the audit trail verification.
+// It checks that no audit entry was edited or deleted by verifying the hash chain of the audit trail.
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/storage"
+)
+
+// main is the entry point of the audit trail verification.
+// It loads the configuration, connects to the database and verifies the audit chain, exiting with an error code
+// when the chain is broken.
+func main() {
+	slog.Info("starting audit trail verification")
+
+	if err := verify(); err != nil {
+		slog.Error("unable to verify audit trail", slog.String("error", err.Error()))
+		os.Exit(-1)
+	}
+
+	slog.Info("finishing audit trail verification")
+}
+
+// verify verifies the hash chain of the audit entries, logging its head so it can be compared with the next run.
+func verify() error {
+	applicationConfig, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	logger := slog.Default()
+
+	db, err := storage.ConnectMySQL(applicationConfig.Repository)
+	if err != nil {
+		return err
+	}
+
+	verification, err := audit.NewLogger(storage.NewMySQLRepository(db, logger), logger).Verify()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("audit trail verified",
+		slog.Int("entries", verification.Entries),
+		slog.Uint64("sequence", verification.Sequence),
+		slog.String("head", verification.Head))
+	return nil
+}
@@ -1,18 +1,24 @@
 // Package main provides functionality for simulating a bank service.
-// It includes HTTP handlers for processing payment and refund requests.
+// It includes HTTP handlers for processing payment and refund requests, and for reporting the outcome of the
+// transactions it received.
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
+	mathrand "math/rand"
 	"net/http"
+	"sync"
 )
 
 // PaymentRequest represents a request to process a payment.
 type PaymentRequest struct {
+	Reference   string  `json:"reference"`
 	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
 	CardNumber  string  `json:"card_number"`
 	ExpiryMonth string  `json:"expiry_month"`
 	ExpiryYear  string  `json:"expiry_year"`
@@ -21,19 +27,81 @@ type PaymentRequest struct {
 
 // RefundRequest represents a request to process a refund.
 type RefundRequest struct {
-	Amount float64 `json:"amount"`
-	Reason string  `json:"reason"`
+	Reference string  `json:"reference"`
+	Amount    float64 `json:"amount"`
+	Currency  string  `json:"currency"`
+	Reason    string  `json:"reason"`
+}
+
+// CaptureRequest represents a request to capture a previously authorized payment.
+type CaptureRequest struct {
+	Reference         string  `json:"reference"`
+	AuthorizationCode string  `json:"authorization_code"`
+	Amount            float64 `json:"amount"`
+	Currency          string  `json:"currency"`
+}
+
+// VoidRequest represents a request to release the hold of an authorized payment.
+type VoidRequest struct {
+	Reference         string `json:"reference"`
+	AuthorizationCode string `json:"authorization_code"`
+}
+
+// StatusRequest represents a request for the outcome of the transaction received with a reference.
+type StatusRequest struct {
+	Reference string `json:"reference"`
+}
+
+// StatusResponse represents the outcome of the transaction received with a reference.
+type StatusResponse struct {
+	PaymentResponse
+	Found     bool   `json:"found"`
+	Operation string `json:"operation,omitempty"`
 }
 
 // PaymentResponse represents the response from a payment or refund request.
 type PaymentResponse struct {
-	Success   bool   `json:"success"`
-	Message   string `json:"message"`
-	Processor string `json:"processor"`
+	Success           bool   `json:"success"`
+	Message           string `json:"message"`
+	Processor         string `json:"processor"`
+	AuthorizationCode string `json:"authorization_code,omitempty"`
+}
+
+// holds keeps the amount held for every open authorization, keyed by authorization code.
+var (
+	holds   = map[string]float64{}
+	holdsMu sync.Mutex
+)
+
+// transactions keeps the outcome of every transaction received with a reference, keyed by reference.
+var (
+	transactions   = map[string]StatusResponse{}
+	transactionsMu sync.Mutex
+)
+
+// recordedResponse returns the response of the transaction already received with the reference, if any.
+func recordedResponse(reference string) (PaymentResponse, bool) {
+	transactionsMu.Lock()
+	defer transactionsMu.Unlock()
+
+	transaction, ok := transactions[reference]
+	return transaction.PaymentResponse, ok
+}
+
+// recordTransaction stores the outcome of the transaction received with the reference.
+func recordTransaction(reference, operation string, paymentResponse PaymentResponse) {
+	if reference == "" {
+		return
+	}
+
+	transactionsMu.Lock()
+	transactions[reference] = StatusResponse{PaymentResponse: paymentResponse, Found: true, Operation: operation}
+	transactionsMu.Unlock()
 }
 
 // handlePaymentRequest handles HTTP requests to process payments.
 // It decodes the request body, processes the payment, and sends back a response.
+// A payment repeating the reference of a received one gets the same response.
 func handlePaymentRequest(w http.ResponseWriter, r *http.Request) {
 	var paymentRequest PaymentRequest
 	if err := json.NewDecoder(r.Body).Decode(&paymentRequest); err != nil {
@@ -42,7 +110,12 @@ func handlePaymentRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	success := rand.Intn(2) == 0
+	if paymentResponse, ok := recordedResponse(paymentRequest.Reference); ok {
+		writeResponse(w, paymentResponse)
+		return
+	}
+
+	success := mathrand.Intn(2) == 0
 	var message string
 	if success {
 		message = "Payment succeeded"
@@ -55,6 +128,7 @@ func handlePaymentRequest(w http.ResponseWriter, r *http.Request) {
 		Message:   message,
 		Processor: "Awesome Bank",
 	}
+	recordTransaction(paymentRequest.Reference, "process", paymentResponse)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(paymentResponse); err != nil {
@@ -65,6 +139,7 @@ func handlePaymentRequest(w http.ResponseWriter, r *http.Request) {
 
 // handleRefundRequest handles HTTP requests to process refunds.
 // It decodes the request body, processes the refund, and sends back a response.
+// A refund repeating the reference of a received one gets the same response.
 func handleRefundRequest(w http.ResponseWriter, r *http.Request) {
 	var refundRequest RefundRequest
 	if err := json.NewDecoder(r.Body).Decode(&refundRequest); err != nil {
@@ -73,6 +148,11 @@ func handleRefundRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if paymentResponse, ok := recordedResponse(refundRequest.Reference); ok {
+		writeResponse(w, paymentResponse)
+		return
+	}
+
 	success := true
 	message := "Refund succeeded"
 
@@ -81,6 +161,7 @@ func handleRefundRequest(w http.ResponseWriter, r *http.Request) {
 		Message:   message,
 		Processor: "Awesome Bank",
 	}
+	recordTransaction(refundRequest.Reference, "refund", paymentResponse)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(paymentResponse); err != nil {
@@ -89,9 +170,168 @@ func handleRefundRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAuthorizeRequest handles HTTP requests to authorize payments.
+// It places a hold for the requested amount and returns the authorization code needed to capture it.
+// An authorization repeating the reference of a received one gets the same response without a new hold.
+func handleAuthorizeRequest(w http.ResponseWriter, r *http.Request) {
+	var paymentRequest PaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&paymentRequest); err != nil {
+		fmt.Println(err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if paymentResponse, ok := recordedResponse(paymentRequest.Reference); ok {
+		writeResponse(w, paymentResponse)
+		return
+	}
+
+	paymentResponse := PaymentResponse{
+		Success:   mathrand.Intn(2) == 0,
+		Message:   "Authorization declined",
+		Processor: "Awesome Bank",
+	}
+
+	if paymentResponse.Success {
+		code, err := generateAuthorizationCode()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		holdsMu.Lock()
+		holds[code] = paymentRequest.Amount
+		holdsMu.Unlock()
+
+		paymentResponse.Message = "Authorization approved"
+		paymentResponse.AuthorizationCode = code
+	}
+	recordTransaction(paymentRequest.Reference, "authorize", paymentResponse)
+
+	writeResponse(w, paymentResponse)
+}
+
+// handleCaptureRequest handles HTTP requests to capture authorized payments.
+// The captured amount may be lower than the authorized one, in which case the remainder is released.
+// A capture repeating the reference of a received one gets the same response without capturing again.
+func handleCaptureRequest(w http.ResponseWriter, r *http.Request) {
+	var captureRequest CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&captureRequest); err != nil {
+		fmt.Println(err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if paymentResponse, ok := recordedResponse(captureRequest.Reference); ok {
+		writeResponse(w, paymentResponse)
+		return
+	}
+
+	paymentResponse := PaymentResponse{
+		Processor:         "Awesome Bank",
+		AuthorizationCode: captureRequest.AuthorizationCode,
+	}
+
+	holdsMu.Lock()
+	held, ok := holds[captureRequest.AuthorizationCode]
+	switch {
+	case !ok:
+		paymentResponse.Message = "Authorization not found"
+	case captureRequest.Amount > held:
+		paymentResponse.Message = "Capture amount exceeds authorized amount"
+	default:
+		delete(holds, captureRequest.AuthorizationCode)
+		paymentResponse.Success = true
+		paymentResponse.Message = fmt.Sprintf("Capture succeeded, released %.2f", held-captureRequest.Amount)
+	}
+	holdsMu.Unlock()
+	recordTransaction(captureRequest.Reference, "capture", paymentResponse)
+
+	writeResponse(w, paymentResponse)
+}
+
+// handleVoidRequest handles HTTP requests to void authorized payments.
+// It releases the full hold of the authorization.
+// A void repeating the reference of a received one gets the same response.
+func handleVoidRequest(w http.ResponseWriter, r *http.Request) {
+	var voidRequest VoidRequest
+	if err := json.NewDecoder(r.Body).Decode(&voidRequest); err != nil {
+		fmt.Println(err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if paymentResponse, ok := recordedResponse(voidRequest.Reference); ok {
+		writeResponse(w, paymentResponse)
+		return
+	}
+
+	paymentResponse := PaymentResponse{
+		Processor:         "Awesome Bank",
+		AuthorizationCode: voidRequest.AuthorizationCode,
+	}
+
+	holdsMu.Lock()
+	if _, ok := holds[voidRequest.AuthorizationCode]; ok {
+		delete(holds, voidRequest.AuthorizationCode)
+		paymentResponse.Success = true
+		paymentResponse.Message = "Void succeeded"
+	} else {
+		paymentResponse.Message = "Authorization not found"
+	}
+	holdsMu.Unlock()
+	recordTransaction(voidRequest.Reference, "void", paymentResponse)
+
+	writeResponse(w, paymentResponse)
+}
+
+// handleStatusRequest handles HTTP requests for the outcome of a transaction.
+// It reports whether a payment, authorization, capture, void or refund was received with the reference and its
+// response.
+func handleStatusRequest(w http.ResponseWriter, r *http.Request) {
+	var statusRequest StatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&statusRequest); err != nil {
+		fmt.Println(err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	transactionsMu.Lock()
+	statusResponse := transactions[statusRequest.Reference]
+	transactionsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statusResponse); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// writeResponse encodes the payment response as JSON into the HTTP response.
+func writeResponse(w http.ResponseWriter, paymentResponse PaymentResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(paymentResponse); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// generateAuthorizationCode generates a random authorization code for a hold.
+func generateAuthorizationCode() (string, error) {
+	codeBytes := make([]byte, 8)
+	if _, err := rand.Read(codeBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(codeBytes), nil
+}
+
 func main() {
 	http.HandleFunc("/payment/process", handlePaymentRequest)
+	http.HandleFunc("/payment/authorize", handleAuthorizeRequest)
+	http.HandleFunc("/payment/capture", handleCaptureRequest)
+	http.HandleFunc("/payment/void", handleVoidRequest)
 	http.HandleFunc("/payment/refund", handleRefundRequest)
+	http.HandleFunc("/payment/status", handleStatusRequest)
 
 	log.Println("Bank Simulator started on port 8090")
 	if err := http.ListenAndServe(":8090", nil); err != nil {
@@ -24,7 +24,7 @@ func main() {
 	app := newApplicationServer()
 
 	if err := app.Run(); err != nil {
-		slog.Error("unable to start service: %s", err)
+		slog.Error("unable to start service", slog.String("error", err.Error()))
 		os.Exit(-1)
 	}
 
@@ -0,0 +1,53 @@
+// Package main serves as the entry point for the card vault key rotation.
+// It re-encrypts every stored card number that is not encrypted with the active vault key.
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/arielcr/payment-gateway/internal/vault"
+)
+
+// main is the entry point of the key rotation.
+// It loads the configuration, connects to the database and rotates the vault keys, exiting with an error code on failure.
+func main() {
+	slog.Info("starting vault key rotation")
+
+	if err := rotate(); err != nil {
+		slog.Error("unable to rotate vault keys", slog.String("error", err.Error()))
+		os.Exit(-1)
+	}
+
+	slog.Info("finishing vault key rotation")
+}
+
+// rotate re-encrypts the vault entries with the active key of the configuration.
+func rotate() error {
+	applicationConfig, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	logger := slog.Default()
+
+	db, err := storage.ConnectMySQL(applicationConfig.Repository)
+	if err != nil {
+		return err
+	}
+
+	cards, err := vault.NewVault(storage.NewMySQLRepository(db, logger), applicationConfig, logger)
+	if err != nil {
+		return err
+	}
+
+	rotated, err := cards.Rotate()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("vault keys rotated", slog.Int("entries", rotated))
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package handlers provides HTTP handlers for managing the API keys of merchants.
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/arielcr/payment-gateway/internal/api/middleware"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// maxApiKeyNameLength is the longest name an API key can be given.
+const maxApiKeyNameLength = 100
+
+// Define custom error messages
+var (
+	errInvalidApiKeyID     = errors.New("invalid api key id")
+	errInvalidApiKeyName   = errors.New("name is required and must be at most 100 characters")
+	errMissingApiKeyScopes = errors.New("at least one scope is required")
+	errUnknownScope        = errors.New("unknown scope")
+	errScopesNotGranted    = errors.New("api key cannot grant scopes it was not granted")
+	errRevokeCurrentApiKey = errors.New("the api key authenticating the request cannot revoke itself")
+)
+
+// ApiKeyHandler handles HTTP requests related to the API keys of merchants.
+type ApiKeyHandler struct {
+	store  storage.Repository
+	logger *slog.Logger
+}
+
+// NewApiKeyHandler creates a new instance of ApiKeyHandler with the provided store.
+func NewApiKeyHandler(store storage.Repository, logger *slog.Logger) *ApiKeyHandler {
+	return &ApiKeyHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// CreateApiKey handles the HTTP POST request to create an API key for the merchant.
+// The new key can only be granted scopes of the key creating it, and it is returned in the response only.
+func (h *ApiKeyHandler) CreateApiKey(context *gin.Context) {
+	h.logger.Info("Creating API key")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	currentKey, err := middleware.AuthenticatedApiKey(context)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	apiKeyRequest := models.ApiKeyRequest{}
+	if err := context.BindJSON(&apiKeyRequest); err != nil {
+		h.logger.Error(err.Error())
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scopes, err := validateApiKeyRequest(apiKeyRequest)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.HasScopes(currentKey.GrantedScopes(), scopes) {
+		h.logger.Error(errScopesNotGranted.Error())
+		context.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errScopesNotGranted.Error()})
+		return
+	}
+
+	key, err := models.GenerateApiKey()
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	apiKey := models.MerchantApiKey{
+		MerchantID: merchant.ID,
+		Name:       strings.TrimSpace(apiKeyRequest.Name),
+		KeyHash:    models.HashApiToken(key),
+		Scopes:     joinScopes(scopes),
+	}
+	if err := h.store.CreateMerchantApiKey(&apiKey); err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := newApiKeyResponse(apiKey)
+	response.Key = key
+	context.JSON(http.StatusCreated, &response)
+}
+
+// GetApiKeys handles the HTTP GET request to list the API keys of the merchant that were not revoked.
+func (h *ApiKeyHandler) GetApiKeys(context *gin.Context) {
+	h.logger.Info("Getting API keys")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := h.store.GetMerchantApiKeys(merchant.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]models.ApiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, newApiKeyResponse(apiKey))
+	}
+	context.JSON(http.StatusOK, &response)
+}
+
+// RevokeApiKey handles the HTTP DELETE request to revoke an API key of the merchant.
+// The key authenticating the request cannot revoke itself, so that a merchant is not locked out by mistake.
+func (h *ApiKeyHandler) RevokeApiKey(context *gin.Context) {
+	h.logger.Info("Revoking API key")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.Atoi(context.Param("keyID"))
+	if err != nil || keyID <= 0 {
+		h.logger.Error(errInvalidApiKeyID.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidApiKeyID.Error()})
+		return
+	}
+
+	if currentKey, err := middleware.AuthenticatedApiKey(context); err == nil && currentKey.ID == uint(keyID) {
+		h.logger.Error(errRevokeCurrentApiKey.Error())
+		context.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": errRevokeCurrentApiKey.Error()})
+		return
+	}
+
+	if err := h.store.RevokeMerchantApiKey(merchant.ID, uint(keyID)); err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+// validateApiKeyRequest checks the name and scopes of an API key request and returns its scopes without duplicates.
+func validateApiKeyRequest(request models.ApiKeyRequest) ([]models.Scope, error) {
+	if name := strings.TrimSpace(request.Name); name == "" || len(name) > maxApiKeyNameLength {
+		return nil, errInvalidApiKeyName
+	}
+	if len(request.Scopes) == 0 {
+		return nil, errMissingApiKeyScopes
+	}
+
+	var scopes []models.Scope
+	seen := make(map[models.Scope]bool)
+	for _, scope := range request.Scopes {
+		if !models.IsKnownScope(scope) {
+			return nil, errUnknownScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// joinScopes returns the space separated list of scopes stored with an API key.
+func joinScopes(scopes []models.Scope) string {
+	values := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		values = append(values, string(scope))
+	}
+	return strings.Join(values, " ")
+}
+
+// newApiKeyResponse builds the response of an API key, which does not include the key itself.
+func newApiKeyResponse(apiKey models.MerchantApiKey) models.ApiKeyResponse {
+	return models.ApiKeyResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Scopes:    apiKey.GrantedScopes(),
+		CreatedAt: apiKey.CreatedAt,
+	}
+}
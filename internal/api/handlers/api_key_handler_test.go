@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+func TestCreateApiKeyOnlyGrantsScopesOfTheCaller(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey string
+		body   string
+		status int
+	}{
+		{name: "subset of the caller scopes", apiKey: merchantAKey, body: `{"name":"support","scopes":["payments:read"]}`, status: http.StatusCreated},
+		{name: "every caller scope", apiKey: merchantAReadOnlyKey, body: `{"name":"support","scopes":["payments:read","api_keys:write"]}`, status: http.StatusCreated},
+		{name: "scope the caller lacks", apiKey: merchantAReadOnlyKey, body: `{"name":"payments","scopes":["payments:write"]}`, status: http.StatusForbidden},
+		{name: "admin", apiKey: merchantAKey, body: `{"name":"admin","scopes":["admin"]}`, status: http.StatusBadRequest},
+		{name: "audit", apiKey: merchantAKey, body: `{"name":"audit","scopes":["audit:read"]}`, status: http.StatusBadRequest},
+		{name: "unknown scope", apiKey: merchantAKey, body: `{"name":"unknown","scopes":["payments:delete"]}`, status: http.StatusBadRequest},
+		{name: "no scopes", apiKey: merchantAKey, body: `{"name":"empty","scopes":[]}`, status: http.StatusBadRequest},
+		{name: "no name", apiKey: merchantAKey, body: `{"scopes":["payments:read"]}`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			handler := NewApiKeyHandler(store, testLogger())
+
+			recorder := serve(t, store, http.MethodPost, "/merchants/api-keys", "/merchants/api-keys", tt.apiKey, tt.body, handler.CreateApiKey)
+			assertStatus(t, recorder, tt.status)
+			if tt.status != http.StatusCreated {
+				return
+			}
+
+			var response models.ApiKeyResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			created, err := store.GetMerchantApiKey(models.HashApiToken(response.Key))
+			if err != nil {
+				t.Fatalf("expected the returned key to authenticate, got %v", err)
+			}
+			if created.MerchantID != 1 {
+				t.Fatalf("expected the key to belong to merchant 1, got %d", created.MerchantID)
+			}
+		})
+	}
+}
+
+func TestGetApiKeysIsScopedToMerchant(t *testing.T) {
+	store := newFakeRepository()
+	handler := NewApiKeyHandler(store, testLogger())
+
+	recorder := serve(t, store, http.MethodGet, "/merchants/api-keys", "/merchants/api-keys", merchantBKey, "", handler.GetApiKeys)
+	assertStatus(t, recorder, http.StatusOK)
+
+	var response []models.ApiKeyResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response) != 1 || response[0].ID != 3 {
+		t.Fatalf("expected only the key of merchant B, got %+v", response)
+	}
+}
+
+func TestRevokeApiKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKey  string
+		target  string
+		status  int
+		revoked int
+	}{
+		{name: "another key of the merchant", apiKey: merchantAKey, target: "/merchants/api-keys/2", status: http.StatusNoContent, revoked: 1},
+		{name: "key of another merchant", apiKey: merchantBKey, target: "/merchants/api-keys/1", status: http.StatusNotFound},
+		{name: "key authenticating the request", apiKey: merchantAKey, target: "/merchants/api-keys/1", status: http.StatusConflict},
+		{name: "invalid id", apiKey: merchantAKey, target: "/merchants/api-keys/abc", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			handler := NewApiKeyHandler(store, testLogger())
+
+			recorder := serve(t, store, http.MethodDelete, "/merchants/api-keys/:keyID", tt.target, tt.apiKey, "", handler.RevokeApiKey)
+			assertStatus(t, recorder, tt.status)
+			if store.revokedApiKeys != tt.revoked {
+				t.Fatalf("expected %d revoked keys, got %d", tt.revoked, store.revokedApiKeys)
+			}
+		})
+	}
+}
+
+func TestRevokedApiKeyNoLongerAuthenticates(t *testing.T) {
+	store := newFakeRepository()
+	handler := NewApiKeyHandler(store, testLogger())
+
+	assertStatus(t, serve(t, store, http.MethodDelete, "/merchants/api-keys/:keyID", "/merchants/api-keys/2", merchantAKey, "", handler.RevokeApiKey), http.StatusNoContent)
+	assertStatus(t, serve(t, store, http.MethodGet, "/merchants/api-keys", "/merchants/api-keys", merchantAReadOnlyKey, "", handler.GetApiKeys), http.StatusUnauthorized)
+}
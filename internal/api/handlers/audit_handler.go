@@ -0,0 +1,241 @@
+// Package handlers provides HTTP handlers for querying and exporting the audit trail.
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of the audit entries returned at a time.
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+	auditExportBatchSize = 500
+)
+
+// Formats of the audit entries.
+const (
+	auditFormatJSON   = "json"
+	auditFormatNDJSON = "ndjson"
+	auditFormatCSV    = "csv"
+)
+
+// auditCSVHeader lists the columns of the CSV export of the audit entries.
+var auditCSVHeader = []string{
+	"sequence", "occurred_at", "actor", "merchant_id", "action", "payment_id", "refund_id",
+	"before", "after", "previous_hash", "hash",
+}
+
+// Define custom error messages
+var (
+	errInvalidAuditCursor   = errors.New("invalid cursor")
+	errInvalidAuditLimit    = errors.New("limit must be between 1 and 1000")
+	errInvalidAuditFormat   = errors.New("format must be json, ndjson or csv")
+	errInvalidAuditTime     = errors.New("from and to must be RFC 3339 times")
+	errInvalidAuditMerchant = errors.New("invalid merchant id")
+)
+
+// AuditHandler handles HTTP requests related to the audit trail.
+type AuditHandler struct {
+	store  storage.Repository
+	logger *slog.Logger
+}
+
+// NewAuditHandler creates a new instance of AuditHandler with the provided store.
+func NewAuditHandler(store storage.Repository, logger *slog.Logger) *AuditHandler {
+	return &AuditHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// GetAuditEntries handles the HTTP GET request to query the audit trail.
+// Entries are filtered by actor, merchant, payment, action and time range and returned in sequence order. The JSON
+// format returns a page of entries with the cursor of the next one, while the NDJSON and CSV formats export every
+// matching entry after the cursor.
+func (h *AuditHandler) GetAuditEntries(context *gin.Context) {
+	h.logger.Info("Getting audit entries")
+
+	filter, err := parseAuditFilter(context)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch format := context.DefaultQuery("format", auditFormatJSON); format {
+	case auditFormatJSON:
+		h.getAuditPage(context, filter)
+	case auditFormatNDJSON, auditFormatCSV:
+		h.exportAuditEntries(context, filter, format)
+	default:
+		h.logger.Error(errInvalidAuditFormat.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidAuditFormat.Error()})
+	}
+}
+
+// getAuditPage responds with a page of the audit entries matching the filter.
+func (h *AuditHandler) getAuditPage(context *gin.Context, filter audit.Filter) {
+	limit := defaultAuditPageSize
+	if value := context.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAuditPageSize {
+			h.logger.Error(errInvalidAuditLimit.Error())
+			context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidAuditLimit.Error()})
+			return
+		}
+		limit = parsed
+	}
+
+	// one more entry than the page size is read to know whether there is a next page
+	entries, err := h.store.FindAuditEntries(filter, limit+1)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.AuditEntryListResponse{Entries: entries}
+	if len(entries) > limit {
+		response.Entries = entries[:limit]
+		response.NextCursor = strconv.FormatUint(entries[limit-1].Sequence, 10)
+	}
+	if response.Entries == nil {
+		response.Entries = []audit.Entry{}
+	}
+
+	context.JSON(http.StatusOK, &response)
+}
+
+// exportAuditEntries streams every audit entry matching the filter as NDJSON or CSV, reading them in batches.
+// Once the export started its status cannot change, so a failure only ends it early.
+func (h *AuditHandler) exportAuditEntries(context *gin.Context, filter audit.Filter, format string) {
+	entries, err := h.store.FindAuditEntries(filter, auditExportBatchSize)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	writer := context.Writer
+	var encoder *json.Encoder
+	var csvWriter *csv.Writer
+	if format == auditFormatCSV {
+		writer.Header().Set("Content-Type", "text/csv")
+		writer.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		csvWriter = csv.NewWriter(writer)
+		if err := csvWriter.Write(auditCSVHeader); err != nil {
+			h.logger.Error(err.Error())
+			return
+		}
+	} else {
+		writer.Header().Set("Content-Type", "application/x-ndjson")
+		writer.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+		encoder = json.NewEncoder(writer)
+	}
+	writer.WriteHeader(http.StatusOK)
+
+	for len(entries) > 0 {
+		for _, entry := range entries {
+			if csvWriter != nil {
+				err = csvWriter.Write(auditCSVRecord(entry))
+			} else {
+				err = encoder.Encode(entry)
+			}
+			if err != nil {
+				h.logger.Error(err.Error())
+				return
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+		writer.Flush()
+
+		if len(entries) < auditExportBatchSize {
+			return
+		}
+		filter.AfterSequence = entries[len(entries)-1].Sequence
+		if entries, err = h.store.FindAuditEntries(filter, auditExportBatchSize); err != nil {
+			h.logger.Error(err.Error())
+			return
+		}
+	}
+}
+
+// parseAuditFilter builds the audit filter from the query parameters of the request.
+func parseAuditFilter(context *gin.Context) (audit.Filter, error) {
+	filter := audit.Filter{
+		Actor:  context.Query("actor"),
+		Action: audit.Action(context.Query("action")),
+	}
+
+	if value := context.Query("merchant_id"); value != "" {
+		merchantID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || merchantID == 0 {
+			return audit.Filter{}, errInvalidAuditMerchant
+		}
+		filter.MerchantID = uint(merchantID)
+	}
+	if value := context.Query("payment_id"); value != "" {
+		paymentID, err := parsePaymentID(value)
+		if err != nil {
+			return audit.Filter{}, err
+		}
+		filter.PaymentID = paymentID
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(context.Query("from")); err != nil {
+		return audit.Filter{}, err
+	}
+	if filter.To, err = parseAuditTime(context.Query("to")); err != nil {
+		return audit.Filter{}, err
+	}
+
+	if value := context.Query("cursor"); value != "" {
+		if filter.AfterSequence, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return audit.Filter{}, errInvalidAuditCursor
+		}
+	}
+	return filter, nil
+}
+
+// parseAuditTime parses an optional RFC 3339 time of the time range filter.
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errInvalidAuditTime
+	}
+	return parsed, nil
+}
+
+// auditCSVRecord converts an audit entry into a row of the CSV export, following auditCSVHeader.
+func auditCSVRecord(entry audit.Entry) []string {
+	return []string{
+		strconv.FormatUint(entry.Sequence, 10),
+		entry.OccurredAt.UTC().Format(time.RFC3339Nano),
+		entry.Actor,
+		strconv.FormatUint(uint64(entry.MerchantID), 10),
+		string(entry.Action),
+		strconv.FormatUint(uint64(entry.PaymentID), 10),
+		strconv.FormatUint(uint64(entry.RefundID), 10),
+		string(entry.Before),
+		string(entry.After),
+		entry.PreviousHash,
+		entry.Hash,
+	}
+}
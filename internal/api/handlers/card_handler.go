@@ -0,0 +1,230 @@
+// Package handlers provides HTTP handlers for managing the saved cards of the customers of a merchant.
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/arielcr/payment-gateway/internal/utils"
+	"github.com/arielcr/payment-gateway/internal/vault"
+	"github.com/gin-gonic/gin"
+)
+
+// Define custom error messages
+var (
+	errInvalidCustomerID = errors.New("invalid customer id")
+	errInvalidCardID     = errors.New("invalid card id")
+)
+
+// CardHandler handles HTTP requests related to the saved cards of customers.
+type CardHandler struct {
+	store  storage.Repository
+	cards  *vault.Vault
+	logger *slog.Logger
+}
+
+// NewCardHandler creates a new instance of CardHandler with the provided store and card vault.
+func NewCardHandler(store storage.Repository, cards *vault.Vault, logger *slog.Logger) *CardHandler {
+	return &CardHandler{
+		store:  store,
+		cards:  cards,
+		logger: logger,
+	}
+}
+
+// GetCards handles the HTTP GET request to list the saved cards of a customer of the authenticated merchant.
+func (h *CardHandler) GetCards(context *gin.Context) {
+	h.logger.Info("Getting cards")
+
+	customer, ok := h.findCustomer(context)
+	if !ok {
+		return
+	}
+
+	creditCards, err := h.store.GetCreditCards(customer.MerchantID, customer.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.CardListResponse{
+		CustomerID: customer.ID,
+		Cards:      make([]models.CardResponse, 0, len(creditCards)),
+	}
+	for _, creditCard := range creditCards {
+		response.Cards = append(response.Cards, newCardResponse(creditCard))
+	}
+
+	context.JSON(http.StatusOK, &response)
+}
+
+// AddCard handles the HTTP POST request to save a card for a customer of the authenticated merchant.
+// A card number the customer already saved is not stored twice, and the existing card is returned instead.
+func (h *CardHandler) AddCard(context *gin.Context) {
+	h.logger.Info("Adding card")
+
+	customer, ok := h.findCustomer(context)
+	if !ok {
+		return
+	}
+
+	cardInfo := models.CardInfo{}
+	if err := context.BindJSON(&cardInfo); err != nil {
+		h.logger.Error(err.Error())
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	creditCard, created, err := saveCreditCard(h.store, h.cards, cardInfo, customer)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	statusCode := http.StatusOK
+	if created {
+		statusCode = http.StatusCreated
+	}
+	response := newCardResponse(creditCard)
+	context.JSON(statusCode, &response)
+}
+
+// DeleteCard handles the HTTP DELETE request to remove a saved card of a customer of the authenticated merchant.
+func (h *CardHandler) DeleteCard(context *gin.Context) {
+	h.logger.Info("Deleting card")
+
+	customer, ok := h.findCustomer(context)
+	if !ok {
+		return
+	}
+
+	cardID, err := strconv.Atoi(context.Param("cardID"))
+	if err != nil || cardID <= 0 {
+		h.logger.Error(errInvalidCardID.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidCardID.Error()})
+		return
+	}
+
+	if err := h.store.DeleteCreditCard(customer.MerchantID, customer.ID, uint(cardID)); err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+// findCustomer retrieves the customer of the customer ID path parameter owned by the authenticated merchant,
+// aborting the request when it does not exist, so customers of other merchants are not found.
+func (h *CardHandler) findCustomer(context *gin.Context) (models.Customer, bool) {
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return models.Customer{}, false
+	}
+
+	customerID, err := strconv.Atoi(context.Param("customerID"))
+	if err != nil || customerID <= 0 {
+		h.logger.Error(errInvalidCustomerID.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidCustomerID.Error()})
+		return models.Customer{}, false
+	}
+
+	customer, err := h.store.GetCustomer(merchant.ID, uint(customerID))
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return models.Customer{}, false
+	}
+	return customer, true
+}
+
+// saveCreditCard validates the card information and saves the card for the customer and its merchant, storing its
+// number in the card vault. When the customer already saved the same card number, including in a request saving it
+// concurrently, the existing card is returned with its expiration and holder refreshed, and created is false.
+func saveCreditCard(store storage.Repository, cards *vault.Vault, cardInfo models.CardInfo, customer models.Customer) (creditCard models.CreditCard, created bool, err error) {
+	if err := utils.ValidateCreditCard(cardInfo.CardNumber); err != nil {
+		return models.CreditCard{}, false, err
+	}
+
+	fingerprint := cards.Fingerprint(cardInfo.CardNumber)
+	if creditCard, err := store.FindCreditCard(customer.MerchantID, customer.ID, fingerprint); err == nil {
+		creditCard, err = refreshCreditCard(store, creditCard, cardInfo)
+		return creditCard, false, err
+	}
+
+	lastFourDigits, err := utils.GetLastFourDigits(cardInfo.CardNumber)
+	if err != nil {
+		return models.CreditCard{}, false, err
+	}
+
+	creditCardToken, err := cards.Tokenize(cardInfo.CardNumber)
+	if err != nil {
+		return models.CreditCard{}, false, err
+	}
+
+	creditCard = models.CreditCard{
+		Token:           creditCardToken,
+		ExpirationMonth: cardInfo.ExpirationMonth,
+		ExpirationYear:  cardInfo.ExpirationYear,
+		CardHolder:      cardInfo.CardHolder,
+		CardType:        cardInfo.CardType,
+		CardBrand:       utils.GetCreditCardBrand(cardInfo.CardNumber),
+		LastFour:        lastFourDigits,
+		MerchantID:      customer.MerchantID,
+		CustomerID:      customer.ID,
+		Fingerprint:     fingerprint,
+	}
+
+	if err := store.CreateCreditCard(&creditCard); err != nil {
+		if !errors.Is(err, storage.ErrCreditCardExists) {
+			return models.CreditCard{}, false, err
+		}
+
+		// another request saved the same card number since it was looked up
+		existing, err := store.FindCreditCard(customer.MerchantID, customer.ID, fingerprint)
+		if err != nil {
+			return models.CreditCard{}, false, err
+		}
+		creditCard, err = refreshCreditCard(store, existing, cardInfo)
+		return creditCard, false, err
+	}
+	return creditCard, true, nil
+}
+
+// refreshCreditCard updates the expiration and holder of a saved card with the card information when they changed.
+func refreshCreditCard(store storage.Repository, creditCard models.CreditCard, cardInfo models.CardInfo) (models.CreditCard, error) {
+	if creditCard.ExpirationMonth == cardInfo.ExpirationMonth &&
+		creditCard.ExpirationYear == cardInfo.ExpirationYear &&
+		creditCard.CardHolder == cardInfo.CardHolder {
+		return creditCard, nil
+	}
+
+	creditCard.ExpirationMonth = cardInfo.ExpirationMonth
+	creditCard.ExpirationYear = cardInfo.ExpirationYear
+	creditCard.CardHolder = cardInfo.CardHolder
+	if err := store.UpdateCreditCard(&creditCard); err != nil {
+		return models.CreditCard{}, err
+	}
+	return creditCard, nil
+}
+
+// newCardResponse builds the response of a saved card, which never includes its number.
+func newCardResponse(creditCard models.CreditCard) models.CardResponse {
+	return models.CardResponse{
+		ID:              creditCard.ID,
+		Token:           creditCard.Token,
+		CardType:        creditCard.CardType,
+		CardBrand:       creditCard.CardBrand,
+		CardHolder:      creditCard.CardHolder,
+		LastFourDigits:  creditCard.LastFour,
+		ExpirationMonth: creditCard.ExpirationMonth,
+		ExpirationYear:  creditCard.ExpirationYear,
+		CreatedAt:       creditCard.CreatedAt,
+	}
+}
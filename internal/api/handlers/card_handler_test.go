@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+func TestGetCardsIsScopedToMerchant(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey string
+		status int
+		cards  int
+	}{
+		{name: "owner", apiKey: merchantAKey, status: http.StatusOK, cards: 1},
+		{name: "other merchant", apiKey: merchantBKey, status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			handler := NewCardHandler(store, nil, testLogger())
+
+			recorder := serve(t, store, http.MethodGet, "/customers/:customerID/cards", "/customers/10/cards", tt.apiKey, "", handler.GetCards)
+			assertStatus(t, recorder, tt.status)
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response models.CardListResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Cards) != tt.cards {
+				t.Fatalf("expected %d cards, got %d", tt.cards, len(response.Cards))
+			}
+		})
+	}
+}
+
+func TestDeleteCardOfAnotherMerchantFails(t *testing.T) {
+	store := newFakeRepository()
+	handler := NewCardHandler(store, nil, testLogger())
+
+	recorder := serve(t, store, http.MethodDelete, "/customers/:customerID/cards/:cardID", "/customers/10/cards/20", merchantBKey, "", handler.DeleteCard)
+
+	assertStatus(t, recorder, http.StatusNotFound)
+	if store.deletedCards != 0 {
+		t.Fatalf("expected no card to be deleted, got %d", store.deletedCards)
+	}
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/api/middleware"
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/bank"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+var errNotFound = errors.New("not found")
+
+// fakeRepository is an in-memory storage.Repository holding the records the handler tests need, scoped by
+// merchant like the MySQL repository. Methods the tests do not need panic through the nil embedded interface.
+type fakeRepository struct {
+	storage.Repository
+
+	merchants []models.Merchant
+	apiKeys   []models.MerchantApiKey
+	payments  []models.Payment
+	refunds   []models.Refund
+	customers []models.Customer
+	cards     []models.CreditCard
+
+	createdPayments int
+	createdRefunds  int
+	deletedCards    int
+	revokedApiKeys  int
+}
+
+func (f *fakeRepository) GetMerchantApiKey(keyHash string) (models.MerchantApiKey, error) {
+	for _, apiKey := range f.apiKeys {
+		if apiKey.KeyHash == keyHash {
+			return apiKey, nil
+		}
+	}
+	return models.MerchantApiKey{}, errNotFound
+}
+
+func (f *fakeRepository) GetMerchant(merchantID uint) (models.Merchant, error) {
+	for _, merchant := range f.merchants {
+		if merchant.ID == merchantID {
+			return merchant, nil
+		}
+	}
+	return models.Merchant{}, errNotFound
+}
+
+func (f *fakeRepository) CreateMerchantApiKey(apiKey *models.MerchantApiKey) error {
+	apiKey.ID = uint(len(f.apiKeys) + 1)
+	f.apiKeys = append(f.apiKeys, *apiKey)
+	return nil
+}
+
+func (f *fakeRepository) GetMerchantApiKeys(merchantID uint) ([]models.MerchantApiKey, error) {
+	var apiKeys []models.MerchantApiKey
+	for _, apiKey := range f.apiKeys {
+		if apiKey.MerchantID == merchantID {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+	return apiKeys, nil
+}
+
+func (f *fakeRepository) RevokeMerchantApiKey(merchantID uint, keyID uint) error {
+	for i, apiKey := range f.apiKeys {
+		if apiKey.MerchantID == merchantID && apiKey.ID == keyID {
+			f.apiKeys = append(f.apiKeys[:i], f.apiKeys[i+1:]...)
+			f.revokedApiKeys++
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+func (f *fakeRepository) FindPayment(merchantID uint, paymentID uint) (models.Payment, error) {
+	for _, payment := range f.payments {
+		if payment.MerchantID == merchantID && payment.ID == paymentID {
+			return payment, nil
+		}
+	}
+	return models.Payment{}, errNotFound
+}
+
+func (f *fakeRepository) FindPaymentByOrderToken(merchantID uint, orderToken string) (models.Payment, error) {
+	for i := len(f.payments) - 1; i >= 0; i-- {
+		if payment := f.payments[i]; payment.MerchantID == merchantID && payment.OrderToken == orderToken {
+			return payment, nil
+		}
+	}
+	return models.Payment{}, errNotFound
+}
+
+func (f *fakeRepository) GetPayment(merchantID uint, paymentID string) (models.PaymentData, error) {
+	id, err := strconv.Atoi(paymentID)
+	if err != nil {
+		return models.PaymentData{}, err
+	}
+	payment, err := f.FindPayment(merchantID, uint(id))
+	if err != nil {
+		return models.PaymentData{}, err
+	}
+	return models.PaymentData{ID: payment.ID, OrderToken: payment.OrderToken, Status: payment.Status}, nil
+}
+
+func (f *fakeRepository) GetPaymentByOrderToken(merchantID uint, orderToken string) (models.PaymentData, error) {
+	payment, err := f.FindPaymentByOrderToken(merchantID, orderToken)
+	if err != nil {
+		return models.PaymentData{}, err
+	}
+	return models.PaymentData{ID: payment.ID, OrderToken: payment.OrderToken, Status: payment.Status}, nil
+}
+
+func (f *fakeRepository) UpdatePayment(payment *models.Payment, from models.PaymentStatus) error {
+	if err := from.ValidateTransition(payment.Status); err != nil {
+		return err
+	}
+	for i := range f.payments {
+		if f.payments[i].ID == payment.ID {
+			if f.payments[i].Status != from {
+				return storage.ErrPaymentStatusConflict
+			}
+			f.payments[i] = *payment
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+func (f *fakeRepository) CreatePayment(payment *models.Payment) error {
+	f.createdPayments++
+	return nil
+}
+
+func (f *fakeRepository) GetRefunds(paymentID uint) ([]models.Refund, error) {
+	var refunds []models.Refund
+	for _, refund := range f.refunds {
+		if refund.PaymentID == paymentID {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (f *fakeRepository) CreateRefund(refund *models.Refund) error {
+	f.createdRefunds++
+	refund.ID = uint(len(f.refunds) + 1)
+	refund.Status = models.RefundPending
+	f.refunds = append(f.refunds, *refund)
+	return nil
+}
+
+func (f *fakeRepository) SettleRefund(refund *models.Refund, status models.RefundStatus) (models.Payment, error) {
+	refund.Status = status
+	for i, payment := range f.payments {
+		if payment.ID == refund.PaymentID {
+			if status == models.RefundSucceeded {
+				f.payments[i].Status = models.PartiallyRefunded
+			}
+			return f.payments[i], nil
+		}
+	}
+	return models.Payment{}, errNotFound
+}
+
+func (f *fakeRepository) AppendAuditEntry(entry *audit.Entry) error {
+	return nil
+}
+
+func (f *fakeRepository) GetCustomer(merchantID uint, customerID uint) (models.Customer, error) {
+	for _, customer := range f.customers {
+		if customer.MerchantID == merchantID && customer.ID == customerID {
+			return customer, nil
+		}
+	}
+	return models.Customer{}, errNotFound
+}
+
+func (f *fakeRepository) GetCreditCard(merchantID uint, customerID uint, token string) (models.CreditCard, error) {
+	for _, card := range f.cards {
+		if card.MerchantID == merchantID && card.CustomerID == customerID && card.Token == token {
+			return card, nil
+		}
+	}
+	return models.CreditCard{}, errNotFound
+}
+
+func (f *fakeRepository) GetCreditCards(merchantID uint, customerID uint) ([]models.CreditCard, error) {
+	var cards []models.CreditCard
+	for _, card := range f.cards {
+		if card.MerchantID == merchantID && card.CustomerID == customerID {
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+func (f *fakeRepository) DeleteCreditCard(merchantID uint, customerID uint, creditCardID uint) error {
+	for _, card := range f.cards {
+		if card.MerchantID == merchantID && card.CustomerID == customerID && card.ID == creditCardID {
+			f.deletedCards++
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// fakeAcquirer is an acquirer answering every call with the same response and error, keeping the references of the
+// calls it received. Methods the tests do not need panic through the nil embedded interface.
+type fakeAcquirer struct {
+	bank.Acquirer
+
+	response   bank.PaymentResponse
+	err        error
+	references []string
+}
+
+func (a *fakeAcquirer) CapturePayment(request bank.CaptureRequest) (bank.PaymentResponse, error) {
+	a.references = append(a.references, request.Reference)
+	return a.response, a.err
+}
+
+func (a *fakeAcquirer) VoidPayment(request bank.VoidRequest) (bank.PaymentResponse, error) {
+	a.references = append(a.references, request.Reference)
+	return a.response, a.err
+}
+
+func (a *fakeAcquirer) ProcessRefund(request bank.RefundRequest) (bank.PaymentResponse, error) {
+	a.references = append(a.references, request.Reference)
+	return a.response, a.err
+}
+
+// Merchant A owns a customer with a saved card and a paid order, merchant B owns a customer without cards.
+// Both merchants hold a key with every merchant scope, and merchant A also holds a read-only key that can create
+// API keys.
+const (
+	merchantAKey         = "merchant-a-key"
+	merchantAReadOnlyKey = "merchant-a-read-only-key"
+	merchantBKey         = "merchant-b-key"
+)
+
+// merchantKeyScopes are the scopes of the keys of the merchants with every merchant scope.
+const merchantKeyScopes = "payments:write payments:read refunds:write webhooks:write api_keys:read api_keys:write"
+
+// newFakeRepository returns a repository with the records of merchants A and B.
+func newFakeRepository() *fakeRepository {
+	merchantA := models.Merchant{Name: "Merchant A"}
+	merchantA.ID = 1
+	merchantB := models.Merchant{Name: "Merchant B"}
+	merchantB.ID = 2
+
+	apiKeyA := models.MerchantApiKey{MerchantID: merchantA.ID, Name: "default", KeyHash: models.HashApiToken(merchantAKey), Scopes: merchantKeyScopes}
+	apiKeyA.ID = 1
+	readOnlyApiKeyA := models.MerchantApiKey{MerchantID: merchantA.ID, Name: "support", KeyHash: models.HashApiToken(merchantAReadOnlyKey), Scopes: "payments:read api_keys:write"}
+	readOnlyApiKeyA.ID = 2
+	apiKeyB := models.MerchantApiKey{MerchantID: merchantB.ID, Name: "default", KeyHash: models.HashApiToken(merchantBKey), Scopes: merchantKeyScopes}
+	apiKeyB.ID = 3
+
+	payment := models.Payment{MerchantID: merchantA.ID, CustomerID: 10, OrderToken: "order-a", Status: models.Succeeded}
+	payment.ID = 100
+	customer := models.Customer{MerchantID: merchantA.ID, Name: "Shopper", Email: "shopper@example.com"}
+	customer.ID = 10
+	customerB := models.Customer{MerchantID: merchantB.ID, Name: "Other shopper", Email: "other@example.com"}
+	customerB.ID = 11
+	card := models.CreditCard{MerchantID: merchantA.ID, CustomerID: customer.ID, Token: "card-token-a", LastFour: "4242"}
+	card.ID = 20
+
+	return &fakeRepository{
+		merchants: []models.Merchant{merchantA, merchantB},
+		apiKeys:   []models.MerchantApiKey{apiKeyA, readOnlyApiKeyA, apiKeyB},
+		payments:  []models.Payment{payment},
+		customers: []models.Customer{customer, customerB},
+		cards:     []models.CreditCard{card},
+	}
+}
+
+// testLogger returns a logger discarding its output.
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// serve sends a request with the merchant API key to a router serving the route with the handler behind the
+// merchant authentication, and returns the recorded response.
+func serve(t *testing.T, store storage.Repository, method, route, target, apiKey, body string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, route, middleware.AuthenticateMerchant(store, testLogger()), handler)
+
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set(middleware.APIKeyHeader, apiKey)
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// assertStatus fails the test when the response does not have the expected status code.
+func assertStatus(t *testing.T, recorder *httptest.ResponseRecorder, expected int) {
+	t.Helper()
+
+	if recorder.Code != expected {
+		t.Fatalf("expected status %d, got %d: %s", expected, recorder.Code, recorder.Body.String())
+	}
+}
@@ -2,31 +2,70 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/arielcr/payment-gateway/internal/api/middleware"
+	"github.com/arielcr/payment-gateway/internal/audit"
 	"github.com/arielcr/payment-gateway/internal/bank"
 	"github.com/arielcr/payment-gateway/internal/config"
 	"github.com/arielcr/payment-gateway/internal/models"
 	"github.com/arielcr/payment-gateway/internal/storage"
-	"github.com/arielcr/payment-gateway/internal/utils"
+	"github.com/arielcr/payment-gateway/internal/vault"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Limits of the payments listed at a time.
+const (
+	defaultPaymentPageSize = 50
+	maxPaymentPageSize     = 200
+)
+
+// Define custom error messages
+var (
+	errInvalidPaymentID         = errors.New("invalid payment id")
+	errCancelDeclined           = errors.New("acquiring bank declined to void the authorization")
+	errInvalidCaptureAmount     = errors.New("capture amount must be between zero and the authorized amount")
+	errInvalidPaymentAmount     = errors.New("payment amount must be greater than zero")
+	errCurrencyNotAccepted      = errors.New("merchant does not accept payments in this currency")
+	errCardTokenWithoutCustomer = errors.New("a card token can only be charged for an existing customer")
+	errInvalidPaymentStatus     = errors.New("invalid payment status")
+	errOrderAlreadyPaid         = errors.New("order is already paid")
+	errInvalidPaymentTime       = errors.New("from and to must be RFC 3339 times")
+	errAmountWithoutCurrency    = errors.New("min_amount and max_amount require a currency")
+	errInvalidPaymentSort       = errors.New("sort must be created_at, -created_at, amount or -amount")
+	errInvalidPaymentLimit      = errors.New("limit must be between 1 and 200")
+)
+
+// transactionSender sends a payment request to an acquiring bank.
+type transactionSender func(acquirer bank.Acquirer, request bank.PaymentRequest) (bank.PaymentResponse, error)
+
 // PaymentHandler handles HTTP requests related to processing payments.
 type PaymentHandler struct {
-	store  storage.Repository
-	config config.Application
-	logger *slog.Logger
+	store     storage.Repository
+	config    config.Application
+	acquirers *bank.Registry
+	cards     *vault.Vault
+	audit     *audit.Logger
+	logger    *slog.Logger
 }
 
-// NewPaymentHandler creates a new instance of PaymentHandler with the provided store and config.
-func NewPaymentHandler(store storage.Repository, config config.Application, logger *slog.Logger) *PaymentHandler {
+// NewPaymentHandler creates a new instance of PaymentHandler with the provided store, config, acquirers, card vault
+// and audit logger.
+func NewPaymentHandler(store storage.Repository, config config.Application, acquirers *bank.Registry, cards *vault.Vault, auditLogger *audit.Logger, logger *slog.Logger) *PaymentHandler {
 	return &PaymentHandler{
-		store:  store,
-		config: config,
-		logger: logger,
+		store:     store,
+		config:    config,
+		acquirers: acquirers,
+		cards:     cards,
+		audit:     auditLogger,
+		logger:    logger,
 	}
 }
 
@@ -35,61 +74,356 @@ func NewPaymentHandler(store storage.Repository, config config.Application, logg
 func (p *PaymentHandler) ProcessPayment(context *gin.Context) {
 	p.logger.Info("Proccesing payment")
 
-	paymentRequest := models.PaymentRequest{}
-	if err := context.BindJSON(&paymentRequest); err != nil {
+	p.handlePayment(context, p.sendTransactionRequest, models.Succeeded)
+}
+
+// AuthorizePayment handles the HTTP POST request to authorize a payment.
+// The funds are held by the acquiring bank until the payment is captured.
+func (p *PaymentHandler) AuthorizePayment(context *gin.Context) {
+	p.logger.Info("Authorizing payment")
+
+	p.handlePayment(context, p.sendAuthorizationRequest, models.Authorized)
+}
+
+// CapturePayment handles the HTTP POST request to capture an authorized payment.
+// It captures the requested amount, or the full authorized amount when none is given, and the
+// acquiring bank releases any uncaptured remainder. The payment is stored as capturing before the bank is called,
+// and when the outcome of the call is unknown the capture is accepted and settled by the reconciliation.
+func (p *PaymentHandler) CapturePayment(context *gin.Context) {
+	p.logger.Info("Capturing payment")
+
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
+	paymentID, err := parsePaymentID(context.Param("paymentID"))
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	captureRequest := models.CaptureRequest{}
+	if err := context.BindJSON(&captureRequest); err != nil {
 		p.logger.Error(err.Error())
 		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	merchant, err := p.getMerchantInfo(paymentRequest.MerchandID)
+	payment, err := p.store.FindPayment(merchant.ID, paymentID)
 	if err != nil {
 		p.logger.Error(err.Error())
 		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	customer, err := p.getCustomerInfo(paymentRequest.Customer)
+	if err := payment.Status.ValidateTransition(models.Capturing); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	amount, err := captureRequest.MoneyIn(payment.Currency)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if amount.IsZero() {
+		amount = payment.Amount
+	}
+	released, err := payment.Amount.Sub(amount)
+	if err != nil || amount.IsNegative() || amount.IsZero() || released.IsNegative() {
+		p.logger.Error(errInvalidCaptureAmount.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidCaptureAmount.Error()})
+		return
+	}
+
+	authorized := payment
+	payment.Status = models.Capturing
+	payment.CapturedAmount = amount
+	payment.BankReference = payment.NewBankReference(bank.OperationCapture)
+	if err := p.store.UpdatePayment(&payment, authorized.Status); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(updateErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	captureResult, err := p.sendCaptureRequest(payment)
+	switch {
+	case errors.Is(err, bank.ErrBankUnavailable) && !errors.Is(err, bank.ErrCircuitOpen):
+		// the capture may have reached the bank, so the payment stays capturing until it is reconciled
+		p.logger.Error(err.Error())
+		context.JSON(http.StatusAccepted, newCaptureResponse(payment, released))
+		return
+	case err != nil:
+		p.logger.Error(err.Error())
+		p.restoreAuthorization(authorized, payment.Status, err.Error())
+		context.AbortWithStatusJSON(bankErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	case !captureResult.Success:
+		p.logger.Error(captureResult.Message)
+		p.restoreAuthorization(authorized, payment.Status, captureResult.Message)
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": captureResult.Message})
+		return
+	}
+
+	capturing := payment
+	payment.Status = models.Processed
+	payment.BankMessage = captureResult.Message
+	if err := p.store.UpdatePayment(&payment, capturing.Status); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(updateErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	p.recordAudit(merchant, audit.PaymentCaptured, authorized, payment)
+
+	context.JSON(http.StatusOK, newCaptureResponse(payment, released))
+}
+
+// CancelPayment handles the HTTP POST request to cancel an authorized payment before it is captured.
+// It voids the authorization with the acquiring bank, releasing the hold, and returns the cancelled redirect URL.
+// The payment is stored as cancelling before the bank is called, and when the outcome of the call is unknown the
+// cancellation is accepted and settled by the reconciliation.
+func (p *PaymentHandler) CancelPayment(context *gin.Context) {
+	p.logger.Info("Cancelling payment")
+
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
+	paymentID, err := parsePaymentID(context.Param("paymentID"))
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment, err := p.store.FindPayment(merchant.ID, paymentID)
 	if err != nil {
 		p.logger.Error(err.Error())
 		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	creditCard, err := p.createCreditCard(paymentRequest.PaymentSource.CardInfo, customer.ID)
+	if err := payment.Status.ValidateTransition(models.Cancelling); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	authorized := payment
+	payment.Status = models.Cancelling
+	payment.BankReference = payment.NewBankReference(bank.OperationVoid)
+	if err := p.store.UpdatePayment(&payment, authorized.Status); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(updateErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	voidResult, err := p.sendVoidRequest(payment)
+	switch {
+	case errors.Is(err, bank.ErrBankUnavailable) && !errors.Is(err, bank.ErrCircuitOpen):
+		// the void may have reached the bank, so the payment stays cancelling until it is reconciled
+		p.logger.Error(err.Error())
+		context.JSON(http.StatusAccepted, &models.CancelResponse{ID: payment.ID, Status: payment.Status})
+		return
+	case err != nil:
+		p.logger.Error(err.Error())
+		p.restoreAuthorization(authorized, payment.Status, err.Error())
+		context.AbortWithStatusJSON(bankErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	case !voidResult.Success:
+		p.logger.Error(voidResult.Message)
+		p.restoreAuthorization(authorized, payment.Status, voidResult.Message)
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errCancelDeclined.Error()})
+		return
+	}
+
+	cancelling := payment
+	payment.Status = models.Cancelled
+	payment.BankMessage = voidResult.Message
+	if err := p.store.UpdatePayment(&payment, cancelling.Status); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(updateErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	p.recordAudit(merchant, audit.PaymentCancelled, authorized, payment)
+
+	context.JSON(http.StatusOK, &models.CancelResponse{
+		ID:          payment.ID,
+		Status:      payment.Status,
+		RedirectUrl: p.getRedirectUrl(payment.CallbackUrls, payment.Status),
+	})
+}
+
+// handlePayment decodes and validates a payment request, sends it to the acquiring bank through the given sender
+// and stores the payment with the success status when the bank approves it. When the bank is unavailable the
+// payment is stored as pending and accepted without a final outcome.
+func (p *PaymentHandler) handlePayment(context *gin.Context, send transactionSender, successStatus models.PaymentStatus) {
+	paymentRequest := models.PaymentRequest{}
+	if err := context.BindJSON(&paymentRequest); err != nil {
+		p.logger.Error(err.Error())
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
+	amount, err := paymentRequest.Money()
 	if err != nil {
 		p.logger.Error(err.Error())
 		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if amount.IsNegative() || amount.IsZero() {
+		p.logger.Error(errInvalidPaymentAmount.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidPaymentAmount.Error()})
+		return
+	}
+	if !merchant.AcceptsCurrency(amount.Currency) {
+		p.logger.Error(errCurrencyNotAccepted.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errCurrencyNotAccepted.Error()})
+		return
+	}
+
+	if err := p.orderConflict(merchant.ID, paymentRequest.OrderToken); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if paymentRequest.PaymentSource.CardToken != "" && paymentRequest.Customer.ID == 0 {
+		p.logger.Error(errCardTokenWithoutCustomer.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errCardTokenWithoutCustomer.Error()})
+		return
+	}
 
-	transactionResult, err := p.sendTransactionRequest(paymentRequest)
+	customer, err := p.getCustomerInfo(merchant.ID, paymentRequest.Customer)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var creditCard models.CreditCard
+	if paymentRequest.PaymentSource.CardToken != "" {
+		creditCard, err = p.getCreditCard(paymentRequest.PaymentSource.CardToken, customer)
+		if err != nil {
+			p.logger.Error(err.Error())
+			context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		creditCard, err = p.createCreditCard(paymentRequest.PaymentSource.CardInfo, customer)
+		if err != nil {
+			p.logger.Error(err.Error())
+			context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	processor, acquirer, err := p.routePayment(merchant, paymentRequest, creditCard, amount)
 	if err != nil {
 		p.logger.Error(err.Error())
 		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	payment, err := p.createPayment(paymentRequest, transactionResult, customer.ID)
+	// the payment is stored as pending before the bank is called, so that the order cannot be charged twice
+	payment, err := p.createPayment(paymentRequest, merchant.ID, amount, processor, customer.ID, creditCard.ID)
+	if errors.Is(err, storage.ErrOrderTokenExists) {
+		// another request for the same order stored its payment since the order was checked
+		if conflict := p.orderConflict(merchant.ID, paymentRequest.OrderToken); conflict != nil {
+			err = conflict
+		}
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		p.logger.Error(err.Error())
-		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error})
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	statusCode := http.StatusCreated
+	transactionResult, err := send(acquirer, newBankPaymentRequest(paymentRequest, payment, creditCard, amount))
+	switch {
+	case errors.Is(err, bank.ErrBankUnavailable):
+		// the outcome at the bank is unknown, so the payment is kept pending instead of being failed
+		statusCode = http.StatusAccepted
+		transactionResult = bank.PaymentResponse{Message: err.Error(), Processor: processor}
+	case err != nil:
+		p.logger.Error(err.Error())
+		payment.Status = models.Failed
+		payment.BankMessage = err.Error()
+		if updateErr := p.store.UpdatePayment(&payment, models.Pending); updateErr != nil {
+			p.logger.Error(updateErr.Error())
+		} else {
+			p.recordAudit(merchant, audit.PaymentCreated, nil, payment)
+		}
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		payment.Status = models.Failed
+		if transactionResult.Success {
+			payment.Status = successStatus
+		}
+		payment.AuthorizationCode = transactionResult.AuthorizationCode
+		payment.BankMessage = transactionResult.Message
+		if err := p.store.UpdatePayment(&payment, models.Pending); err != nil {
+			p.logger.Error(err.Error())
+			context.AbortWithStatusJSON(updateErrorStatusCode(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+	p.recordAudit(merchant, audit.PaymentCreated, nil, payment)
+
 	paymentResponse := p.generateResponse(payment, paymentRequest, merchant, customer, creditCard, transactionResult)
 
-	context.JSON(http.StatusCreated, &paymentResponse)
+	context.JSON(statusCode, &paymentResponse)
 }
 
 // GetPayment handles the HTTP GET request to retrieve payment information by ID.
-// It fetches the payment data from the database and sends back a response.
+// It fetches the payment data of the authenticated merchant from the database and sends back a response,
+// so payments of other merchants are not found.
 func (p *PaymentHandler) GetPayment(context *gin.Context) {
 	p.logger.Info("Getting payment")
 
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
 	paymentID := context.Param("paymentID")
 
-	paymentData, err := p.store.GetPayment(paymentID)
+	paymentData, err := p.store.GetPayment(merchant.ID, paymentID)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, &paymentData)
+}
+
+// GetPaymentByOrderToken handles the HTTP GET request to retrieve payment information by the order token the
+// merchant sent when processing it. Payments of other merchants with the same order token are not found.
+func (p *PaymentHandler) GetPaymentByOrderToken(context *gin.Context) {
+	p.logger.Info("Getting payment by order token")
+
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
+	paymentData, err := p.store.GetPaymentByOrderToken(merchant.ID, context.Param("orderToken"))
 	if err != nil {
 		p.logger.Error(err.Error())
 		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -99,20 +433,116 @@ func (p *PaymentHandler) GetPayment(context *gin.Context) {
 	context.JSON(http.StatusOK, &paymentData)
 }
 
+// ListPayments handles the HTTP GET request to list and search the payments of the authenticated merchant.
+// Payments are filtered by status, creation time, amount, customer email, order token and card last four digits,
+// sorted by creation time or amount, and returned a page at a time with the cursor of the next page.
+func (p *PaymentHandler) ListPayments(context *gin.Context) {
+	p.logger.Info("Listing payments")
+
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
+	filter, err := parsePaymentFilter(context, merchant.ID)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := defaultPaymentPageSize
+	if value := context.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPaymentPageSize {
+			p.logger.Error(errInvalidPaymentLimit.Error())
+			context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidPaymentLimit.Error()})
+			return
+		}
+	}
+
+	// one more payment than the page size is read to know whether there is a next page
+	payments, err := p.store.FindPayments(filter, limit+1)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.PaymentListResponse{Payments: payments}
+	if len(payments) > limit {
+		response.Payments = payments[:limit]
+		response.NextCursor = models.NewPaymentCursor(payments[limit-1]).Encode()
+	}
+	if response.Payments == nil {
+		response.Payments = []models.PaymentSummary{}
+	}
+
+	context.JSON(http.StatusOK, &response)
+}
+
+// routePayment chooses the processor of a payment from the processor requested in the payment source and the
+// routing rules of the merchant, returning its name and acquirer.
+func (p *PaymentHandler) routePayment(merchant models.Merchant, paymentRequest models.PaymentRequest, creditCard models.CreditCard, amount models.Money) (string, bank.Acquirer, error) {
+	p.logger.Info("Routing payment")
+
+	rules, err := p.store.GetRoutingRules(merchant.ID)
+	if err != nil {
+		p.logger.Error(err.Error())
+		return "", nil, err
+	}
+
+	return p.acquirers.Route(rules, bank.RouteRequest{
+		MerchantID: merchant.ID,
+		CardBrand:  creditCard.CardBrand,
+		Amount:     amount,
+		Processor:  paymentRequest.PaymentSource.Processor,
+	})
+}
+
 // sendTransactionRequest sends a transaction request to the acquiring bank for processing payment.
-// It constructs the request using the payment information and application configuration.
-func (p *PaymentHandler) sendTransactionRequest(paymentRequest models.PaymentRequest) (bank.PaymentResponse, error) {
+// It constructs the request using the payment information.
+func (p *PaymentHandler) sendTransactionRequest(acquirer bank.Acquirer, request bank.PaymentRequest) (bank.PaymentResponse, error) {
 	p.logger.Info("Sending transaction request")
 
-	request := bank.PaymentRequest{
-		Amount:      paymentRequest.Amount,
-		CardNumber:  paymentRequest.PaymentSource.CardInfo.CardNumber,
-		ExpiryMonth: paymentRequest.PaymentSource.CardInfo.ExpirationMonth,
-		ExpiryYear:  paymentRequest.PaymentSource.CardInfo.ExpirationYear,
-		Cvv:         paymentRequest.PaymentSource.CardInfo.CardCvv,
+	response, err := acquirer.ProcessPayment(request)
+	if err != nil {
+		p.logger.Error(err.Error())
+		return bank.PaymentResponse{}, err
+	}
+	return response, nil
+}
+
+// sendAuthorizationRequest sends an authorization request to the acquiring bank to hold the payment amount.
+func (p *PaymentHandler) sendAuthorizationRequest(acquirer bank.Acquirer, request bank.PaymentRequest) (bank.PaymentResponse, error) {
+	p.logger.Info("Sending authorization request")
+
+	response, err := acquirer.AuthorizePayment(request)
+	if err != nil {
+		p.logger.Error(err.Error())
+		return bank.PaymentResponse{}, err
 	}
-	acquiringBank := bank.NewAdquiringBank(p.config, p.logger)
-	response, err := acquiringBank.ProcessPayment(request)
+	return response, nil
+}
+
+// sendCaptureRequest sends a capture request for the captured amount of the payment, with its bank reference, to the
+// acquiring bank that authorized it.
+func (p *PaymentHandler) sendCaptureRequest(payment models.Payment) (bank.PaymentResponse, error) {
+	p.logger.Info("Sending capture request")
+
+	acquirer, err := p.acquirers.Get(payment.Processor)
+	if err != nil {
+		p.logger.Error(err.Error())
+		return bank.PaymentResponse{}, err
+	}
+
+	request := bank.CaptureRequest{
+		Reference:         payment.BankReference,
+		AuthorizationCode: payment.AuthorizationCode,
+		Amount:            payment.CapturedAmount,
+		Currency:          payment.CapturedAmount.CurrencyCode(),
+	}
+	response, err := acquirer.CapturePayment(request)
 	if err != nil {
 		p.logger.Error(err.Error())
 		return bank.PaymentResponse{}, err
@@ -120,25 +550,209 @@ func (p *PaymentHandler) sendTransactionRequest(paymentRequest models.PaymentReq
 	return response, nil
 }
 
-// getMerchantInfo retrieves merchant information from the database by ID.
-func (p *PaymentHandler) getMerchantInfo(id uint) (models.Merchant, error) {
-	p.logger.Info("Getting merchant info")
+// sendVoidRequest sends a void request, with the bank reference of the payment, to the acquiring bank that authorized
+// it to release its hold.
+func (p *PaymentHandler) sendVoidRequest(payment models.Payment) (bank.PaymentResponse, error) {
+	p.logger.Info("Sending void request")
+
+	acquirer, err := p.acquirers.Get(payment.Processor)
+	if err != nil {
+		p.logger.Error(err.Error())
+		return bank.PaymentResponse{}, err
+	}
 
-	merchant, err := p.store.GetMerchant(id)
+	request := bank.VoidRequest{
+		Reference:         payment.BankReference,
+		AuthorizationCode: payment.AuthorizationCode,
+	}
+	response, err := acquirer.VoidPayment(request)
 	if err != nil {
 		p.logger.Error(err.Error())
-		return models.Merchant{}, err
+		return bank.PaymentResponse{}, err
+	}
+	return response, nil
+}
+
+// restoreAuthorization moves a capturing or cancelling payment back to the authorized state it was in when the
+// acquiring bank did not capture or void it, keeping the message of the bank. A payment that cannot be restored is
+// logged and left for the reconciliation, which restores it with the outcome reported by the bank.
+func (p *PaymentHandler) restoreAuthorization(authorized models.Payment, from models.PaymentStatus, message string) {
+	authorized.BankMessage = message
+	if err := p.store.UpdatePayment(&authorized, from); err != nil {
+		p.logger.Error(err.Error())
+	}
+}
+
+// newCaptureResponse builds the response of a capture of the payment that released the given amount.
+func newCaptureResponse(payment models.Payment, released models.Money) *models.CaptureResponse {
+	return &models.CaptureResponse{
+		ID:               payment.ID,
+		Status:           payment.Status,
+		Currency:         payment.Currency,
+		AuthorizedAmount: payment.Amount,
+		CapturedAmount:   payment.CapturedAmount,
+		ReleasedAmount:   released,
+	}
+}
+
+// newBankPaymentRequest builds the acquiring bank request from the payment request, the pending payment, its parsed
+// amount and the stored card. The card is referred to by its vault token, which the acquirer resolves when calling
+// the bank, and the payment by its reference, with which its outcome is reconciled when the bank call fails.
+func newBankPaymentRequest(paymentRequest models.PaymentRequest, payment models.Payment, creditCard models.CreditCard, amount models.Money) bank.PaymentRequest {
+	return bank.PaymentRequest{
+		Reference:   payment.Reference(),
+		Amount:      amount,
+		Currency:    amount.Currency,
+		CardToken:   creditCard.Token,
+		ExpiryMonth: creditCard.ExpirationMonth,
+		ExpiryYear:  creditCard.ExpirationYear,
+		Cvv:         paymentRequest.PaymentSource.CardInfo.CardCvv,
 	}
-	return merchant, nil
 }
 
-// getCustomerInfo retrieves or creates customer information based on the provided details.
-func (p *PaymentHandler) getCustomerInfo(c models.Customer) (models.Customer, error) {
+// recordAudit records a change the merchant made to a payment in the audit trail. Before is nil for a new payment.
+// The change already happened, so a failure to record it is logged without failing the request.
+func (p *PaymentHandler) recordAudit(merchant models.Merchant, action audit.Action, before interface{}, after models.Payment) {
+	event := audit.Event{
+		Actor:      audit.MerchantActor(merchant.ID),
+		MerchantID: merchant.ID,
+		Action:     action,
+		PaymentID:  after.ID,
+		Before:     before,
+		After:      after,
+	}
+	if err := p.audit.Record(event); err != nil {
+		p.logger.Error(err.Error())
+	}
+}
+
+// updateErrorStatusCode maps an error returned while changing the status of a payment to an HTTP status code.
+// Transitions rejected by the state machine or lost to a concurrent request, and refunds settled by the
+// reconciliation meanwhile, are reported as a conflict.
+func updateErrorStatusCode(err error) int {
+	if errors.Is(err, models.ErrInvalidStatusTransition) || errors.Is(err, storage.ErrPaymentStatusConflict) ||
+		errors.Is(err, storage.ErrRefundAlreadySettled) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// authenticatedMerchant returns the merchant authenticated by the request API key, aborting the request
+// when there is none.
+func authenticatedMerchant(context *gin.Context, logger *slog.Logger) (models.Merchant, bool) {
+	merchant, err := middleware.AuthenticatedMerchant(context)
+	if err != nil {
+		logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return models.Merchant{}, false
+	}
+	return merchant, true
+}
+
+// bankErrorStatusCode maps an error returned by an acquiring bank call to an HTTP status code.
+// An unavailable bank is reported as a temporary condition so that the client can retry later.
+func bankErrorStatusCode(err error) int {
+	if errors.Is(err, bank.ErrBankUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// parsePaymentFilter builds the filter of the payments of the merchant from the query parameters of the request.
+// Statuses are given as a comma separated list, and the amounts in major units of the given currency.
+func parsePaymentFilter(context *gin.Context, merchantID uint) (models.PaymentFilter, error) {
+	filter := models.PaymentFilter{
+		MerchantID:    merchantID,
+		Currency:      strings.ToUpper(context.Query("currency")),
+		CustomerEmail: context.Query("customer_email"),
+		OrderToken:    context.Query("order_token"),
+		CardLastFour:  context.Query("card_last_four"),
+	}
+
+	if value := context.Query("status"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			var status models.PaymentStatus
+			if status = status.ConvertStringToPaymentStatus(strings.TrimSpace(name)); status == 0 {
+				return models.PaymentFilter{}, fmt.Errorf("%w: %s", errInvalidPaymentStatus, name)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	for name, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := context.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return models.PaymentFilter{}, errInvalidPaymentTime
+			}
+			*bound = parsed
+		}
+	}
+
+	for name, bound := range map[string]*models.Money{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if value := context.Query(name); value != "" {
+			if filter.Currency == "" {
+				return models.PaymentFilter{}, errAmountWithoutCurrency
+			}
+			amount, err := models.ParseMoney(value, filter.Currency)
+			if err != nil {
+				return models.PaymentFilter{}, err
+			}
+			*bound = amount
+		}
+	}
+
+	sort := context.DefaultQuery("sort", "-"+string(models.SortByCreatedAt))
+	filter.Descending = strings.HasPrefix(sort, "-")
+	switch filter.Sort = models.PaymentSort(strings.TrimPrefix(sort, "-")); filter.Sort {
+	case models.SortByCreatedAt, models.SortByAmount:
+	default:
+		return models.PaymentFilter{}, errInvalidPaymentSort
+	}
+
+	if value := context.Query("cursor"); value != "" {
+		cursor, err := models.ParsePaymentCursor(value)
+		if err != nil {
+			return models.PaymentFilter{}, err
+		}
+		filter.After = &cursor
+	}
+	return filter, nil
+}
+
+// parsePaymentID converts the payment ID path parameter into a numeric ID.
+func parsePaymentID(paymentID string) (uint, error) {
+	id, err := strconv.Atoi(paymentID)
+	if err != nil || id <= 0 {
+		return 0, errInvalidPaymentID
+	}
+	return uint(id), nil
+}
+
+// orderConflict returns the error reporting that the merchant already has an active payment for the order token,
+// telling apart an order that was already paid from one whose payment is still in progress. It returns nil when
+// the order has no payment yet, or when its latest payment failed or was cancelled, so that it can be paid again.
+func (p *PaymentHandler) orderConflict(merchantID uint, orderToken string) error {
+	payment, err := p.store.FindPaymentByOrderToken(merchantID, orderToken)
+	switch {
+	case err != nil, !payment.Status.IsActive():
+		return nil
+	case payment.Status.IsSuccessful():
+		return errOrderAlreadyPaid
+	default:
+		return storage.ErrOrderTokenExists
+	}
+}
+
+// getCustomerInfo retrieves or creates customer information of the merchant based on the provided details.
+// Customers of other merchants are not found.
+func (p *PaymentHandler) getCustomerInfo(merchantID uint, c models.Customer) (models.Customer, error) {
 	p.logger.Info("Getting customer info")
 
 	customer := models.Customer{
-		Name:  c.Name,
-		Email: c.Email,
+		MerchantID: merchantID,
+		Name:       c.Name,
+		Email:      c.Email,
 	}
 
 	if c.ID == 0 {
@@ -148,7 +762,7 @@ func (p *PaymentHandler) getCustomerInfo(c models.Customer) (models.Customer, er
 		}
 	} else {
 		var err error
-		customer, err = p.store.GetCustomer(c.ID)
+		customer, err = p.store.GetCustomer(merchantID, c.ID)
 		if err != nil {
 			p.logger.Error(err.Error())
 			return models.Customer{}, err
@@ -158,22 +772,27 @@ func (p *PaymentHandler) getCustomerInfo(c models.Customer) (models.Customer, er
 	return customer, nil
 }
 
-// createPayment creates a payment record in the database based on the payment request and transaction result.
-func (p *PaymentHandler) createPayment(paymentRequest models.PaymentRequest, transactionResult bank.PaymentResponse, customerID uint) (models.Payment, error) {
+// createPayment creates a pending payment record of the merchant in the database based on the payment request,
+// before it is sent to the acquiring bank.
+func (p *PaymentHandler) createPayment(
+	paymentRequest models.PaymentRequest,
+	merchantID uint,
+	amount models.Money,
+	processor string,
+	customerID uint,
+	creditCardID uint) (models.Payment, error) {
 	p.logger.Info("Creating payment")
 
-	var status models.PaymentStatus
-	if transactionResult.Success {
-		status = models.Succeeded
-	} else {
-		status = models.Failed
-	}
 	payment := models.Payment{
-		OrderToken: paymentRequest.OrderToken,
-		MerchantID: paymentRequest.MerchandID,
-		Amount:     paymentRequest.Amount,
-		Status:     status,
-		CustomerID: customerID,
+		OrderToken:   paymentRequest.OrderToken,
+		MerchantID:   merchantID,
+		Amount:       amount,
+		Currency:     amount.Currency,
+		Status:       models.Pending,
+		CustomerID:   customerID,
+		CreditCardID: &creditCardID,
+		Processor:    processor,
+		CallbackUrls: paymentRequest.CallbackUrls,
 	}
 
 	if err := p.store.CreatePayment(&payment); err != nil {
@@ -184,44 +803,29 @@ func (p *PaymentHandler) createPayment(paymentRequest models.PaymentRequest, tra
 	return payment, nil
 }
 
-// createCreditCard creates a credit card record in the database based on the provided card information and customer ID.
-func (p *PaymentHandler) createCreditCard(cardInfo models.CardInfo, customerID uint) (models.CreditCard, error) {
+// createCreditCard saves the card of the payment for the customer, reusing the card the customer already saved
+// with the same card number.
+func (p *PaymentHandler) createCreditCard(cardInfo models.CardInfo, customer models.Customer) (models.CreditCard, error) {
 	p.logger.Info("Creating credit card")
 
-	err := utils.ValidateCreditCard(cardInfo.CardNumber)
+	creditCard, _, err := saveCreditCard(p.store, p.cards, cardInfo, customer)
 	if err != nil {
 		p.logger.Error(err.Error())
 		return models.CreditCard{}, err
 	}
+	return creditCard, nil
+}
 
-	creditCardToken, err := utils.TokenizeCreditCard(cardInfo.CardNumber)
-	if err != nil {
-		p.logger.Error(err.Error())
-		return models.CreditCard{}, err
-	}
+// getCreditCard retrieves the saved card of the customer with the given card token.
+// Cards saved by other merchants are not found, even for a token they share.
+func (p *PaymentHandler) getCreditCard(cardToken string, customer models.Customer) (models.CreditCard, error) {
+	p.logger.Info("Getting saved credit card")
 
-	lastFourDigits, err := utils.GetLastFourDigits(cardInfo.CardNumber)
+	creditCard, err := p.store.GetCreditCard(customer.MerchantID, customer.ID, cardToken)
 	if err != nil {
 		p.logger.Error(err.Error())
 		return models.CreditCard{}, err
 	}
-
-	creditCard := models.CreditCard{
-		Token:           creditCardToken,
-		ExpirationMonth: cardInfo.ExpirationMonth,
-		ExpirationYear:  cardInfo.ExpirationYear,
-		CardHolder:      cardInfo.CardHolder,
-		CardType:        cardInfo.CardType,
-		CardBrand:       utils.GetCreditCardBrand(cardInfo.CardNumber),
-		LastFour:        lastFourDigits,
-		CustomerID:      customerID,
-	}
-
-	if err := p.store.CreateCreditCard(&creditCard); err != nil {
-		p.logger.Error(err.Error())
-		return models.CreditCard{}, err
-	}
-
 	return creditCard, nil
 }
 
@@ -240,16 +844,17 @@ func (p *PaymentHandler) generateResponse(
 		Status:     payment.Status,
 		PaymentInfo: models.PaymentInfo{
 			Amount:     payment.Amount,
+			Currency:   payment.Currency,
 			MethodType: paymentRequest.PaymentSource.MethodType,
 			Processor:  transactionResult.Processor,
 			CardDetails: models.CardDetails{
-				CardType:       paymentRequest.PaymentSource.CardInfo.CardType,
+				CardType:       creditCard.CardType,
 				CardBrand:      creditCard.CardBrand,
-				CardHolder:     paymentRequest.PaymentSource.CardInfo.CardHolder,
+				CardHolder:     creditCard.CardHolder,
 				LastFourDigits: creditCard.LastFour,
 			},
 		},
-		RedirectUrl: p.getRedirectUrl(paymentRequest, payment.Status),
+		RedirectUrl: p.getRedirectUrl(payment.CallbackUrls, payment.Status),
 		Merchant: models.MerchantResponse{
 			Name:  merchant.Name,
 			Email: merchant.Email,
@@ -264,16 +869,18 @@ func (p *PaymentHandler) generateResponse(
 	return paymentResponse
 }
 
-// getRedirectUrl determines the redirect URL based on the payment status and callback URLs in the payment request.
-func (p *PaymentHandler) getRedirectUrl(paymentRequest models.PaymentRequest, status models.PaymentStatus) string {
+// getRedirectUrl determines the redirect URL based on the payment status and the callback URLs of the payment.
+func (p *PaymentHandler) getRedirectUrl(callbackUrls models.CallbackUrls, status models.PaymentStatus) string {
 	p.logger.Info("Getting redirection URL")
 
 	var redirectUrl string
 	switch status {
-	case models.Succeeded:
-		redirectUrl = paymentRequest.CallbackUrls.Success
+	case models.Succeeded, models.Authorized:
+		redirectUrl = callbackUrls.Success
 	case models.Failed:
-		redirectUrl = paymentRequest.CallbackUrls.Failed
+		redirectUrl = callbackUrls.Failed
+	case models.Cancelled:
+		redirectUrl = callbackUrls.Cancelled
 	}
 	return redirectUrl
 }
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/bank"
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestPaymentHandler returns a payment handler over the store whose acquirers are never reached by the tests.
+func newTestPaymentHandler(store *fakeRepository) *PaymentHandler {
+	cfg := config.Application{DefaultProcessor: "test-bank"}
+	return NewPaymentHandler(store, cfg, bank.NewRegistry(cfg, nil, testLogger()), nil, audit.NewLogger(store, testLogger()), testLogger())
+}
+
+func TestGetPaymentIsScopedToMerchant(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey string
+		status int
+	}{
+		{name: "owner", apiKey: merchantAKey, status: http.StatusOK},
+		{name: "other merchant", apiKey: merchantBKey, status: http.StatusNotFound},
+		{name: "unknown key", apiKey: "unknown", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			handler := newTestPaymentHandler(store)
+
+			recorder := serve(t, store, http.MethodGet, "/payments/:paymentID", "/payments/100", tt.apiKey, "", handler.GetPayment)
+			assertStatus(t, recorder, tt.status)
+		})
+	}
+}
+
+func TestGetPaymentByOrderTokenIsScopedToMerchant(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey string
+		status int
+	}{
+		{name: "owner", apiKey: merchantAKey, status: http.StatusOK},
+		{name: "other merchant", apiKey: merchantBKey, status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			handler := newTestPaymentHandler(store)
+
+			recorder := serve(t, store, http.MethodGet, "/payments/by-order/:orderToken", "/payments/by-order/order-a", tt.apiKey, "", handler.GetPaymentByOrderToken)
+			assertStatus(t, recorder, tt.status)
+		})
+	}
+}
+
+func TestOrderConflictAllowsNewAttemptAfterFailedPayment(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []models.PaymentStatus
+		want     error
+	}{
+		{name: "no payment", want: nil},
+		{name: "pending", statuses: []models.PaymentStatus{models.Pending}, want: storage.ErrOrderTokenExists},
+		{name: "failed", statuses: []models.PaymentStatus{models.Failed}, want: nil},
+		{name: "cancelled", statuses: []models.PaymentStatus{models.Cancelled}, want: nil},
+		{name: "succeeded", statuses: []models.PaymentStatus{models.Succeeded}, want: errOrderAlreadyPaid},
+		{name: "refunded", statuses: []models.PaymentStatus{models.Refunded}, want: errOrderAlreadyPaid},
+		{name: "retried after failure", statuses: []models.PaymentStatus{models.Failed, models.Pending}, want: storage.ErrOrderTokenExists},
+		{name: "paid after failure", statuses: []models.PaymentStatus{models.Failed, models.Authorized}, want: errOrderAlreadyPaid},
+		{name: "failed again", statuses: []models.PaymentStatus{models.Failed, models.Failed}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			for i, status := range tt.statuses {
+				payment := models.Payment{MerchantID: 1, OrderToken: "order-retry", Status: status}
+				payment.ID = uint(200 + i)
+				store.payments = append(store.payments, payment)
+			}
+			handler := newTestPaymentHandler(store)
+
+			if err := handler.orderConflict(1, "order-retry"); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestProcessPaymentRejectsCustomersAndCardsOfOtherMerchants(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "customer of another merchant",
+			body: `{"order_token":"order-b","amount":"10.00","currency":"USD","customer":{"id":10},
+				"payment_source":{"card_info":{"card_number":"4242424242424242"}}}`,
+		},
+		{
+			name: "saved card of another merchant",
+			body: `{"order_token":"order-b","amount":"10.00","currency":"USD","customer":{"id":11},
+				"payment_source":{"card_token":"card-token-a"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			handler := newTestPaymentHandler(store)
+
+			recorder := serve(t, store, http.MethodPost, "/merchants/payment/process", "/merchants/payment/process", merchantBKey, tt.body, handler.ProcessPayment)
+			assertStatus(t, recorder, http.StatusNotFound)
+			if store.createdPayments != 0 {
+				t.Fatalf("expected no payment to be created, got %d", store.createdPayments)
+			}
+		})
+	}
+}
+
+func TestCancelPaymentRejectsIllegalTransitions(t *testing.T) {
+	tests := []struct {
+		name   string
+		status models.PaymentStatus
+	}{
+		{name: "pending", status: models.Pending},
+		{name: "succeeded", status: models.Succeeded},
+		{name: "processed", status: models.Processed},
+		{name: "capturing", status: models.Capturing},
+		{name: "cancelling", status: models.Cancelling},
+		{name: "cancelled", status: models.Cancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			store.payments[0].Status = tt.status
+			handler := newTestPaymentHandler(store)
+
+			recorder := serve(t, store, http.MethodPost, "/merchants/payment/:paymentID/cancel", "/merchants/payment/100/cancel", merchantAKey, "", handler.CancelPayment)
+			assertStatus(t, recorder, http.StatusConflict)
+
+			expected := (&models.StatusTransitionError{From: tt.status, To: models.Cancelling}).Error()
+			if !strings.Contains(recorder.Body.String(), expected) {
+				t.Fatalf("expected error %q, got %s", expected, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestCaptureAndCancelStorePaymentWithBankOutcome(t *testing.T) {
+	unavailable := fmt.Errorf("%w: timeout", bank.ErrBankUnavailable)
+	tests := []struct {
+		name     string
+		target   string
+		handler  func(*PaymentHandler) gin.HandlerFunc
+		acquirer *fakeAcquirer
+		status   int
+		stored   models.PaymentStatus
+	}{
+		{
+			name:     "capture approved",
+			target:   "/merchants/payment/100/capture",
+			handler:  func(h *PaymentHandler) gin.HandlerFunc { return h.CapturePayment },
+			acquirer: &fakeAcquirer{response: bank.PaymentResponse{Success: true}},
+			status:   http.StatusOK,
+			stored:   models.Processed,
+		},
+		{
+			name:     "capture with unknown outcome",
+			target:   "/merchants/payment/100/capture",
+			handler:  func(h *PaymentHandler) gin.HandlerFunc { return h.CapturePayment },
+			acquirer: &fakeAcquirer{err: unavailable},
+			status:   http.StatusAccepted,
+			stored:   models.Capturing,
+		},
+		{
+			name:     "capture declined",
+			target:   "/merchants/payment/100/capture",
+			handler:  func(h *PaymentHandler) gin.HandlerFunc { return h.CapturePayment },
+			acquirer: &fakeAcquirer{response: bank.PaymentResponse{Message: "Authorization not found"}},
+			status:   http.StatusBadRequest,
+			stored:   models.Authorized,
+		},
+		{
+			name:     "capture not sent",
+			target:   "/merchants/payment/100/capture",
+			handler:  func(h *PaymentHandler) gin.HandlerFunc { return h.CapturePayment },
+			acquirer: &fakeAcquirer{err: bank.ErrCircuitOpen},
+			status:   http.StatusServiceUnavailable,
+			stored:   models.Authorized,
+		},
+		{
+			name:     "cancel approved",
+			target:   "/merchants/payment/100/cancel",
+			handler:  func(h *PaymentHandler) gin.HandlerFunc { return h.CancelPayment },
+			acquirer: &fakeAcquirer{response: bank.PaymentResponse{Success: true}},
+			status:   http.StatusOK,
+			stored:   models.Cancelled,
+		},
+		{
+			name:     "cancel with unknown outcome",
+			target:   "/merchants/payment/100/cancel",
+			handler:  func(h *PaymentHandler) gin.HandlerFunc { return h.CancelPayment },
+			acquirer: &fakeAcquirer{err: unavailable},
+			status:   http.StatusAccepted,
+			stored:   models.Cancelling,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			store.payments[0].Status = models.Authorized
+			store.payments[0].Amount = models.NewMoney(2000, "USD")
+			store.payments[0].Currency = "USD"
+			handler := newTestPaymentHandler(store)
+			handler.acquirers.Register("test-bank", tt.acquirer)
+
+			recorder := serve(t, store, http.MethodPost, "/merchants/payment/:paymentID/:action", tt.target, merchantAKey, "{}", tt.handler(handler))
+			assertStatus(t, recorder, tt.status)
+
+			stored := store.payments[0]
+			if stored.Status != tt.stored {
+				t.Fatalf("expected the payment to be %s, got %s", tt.stored, stored.Status)
+			}
+			if len(tt.acquirer.references) != 1 || tt.acquirer.references[0] == "" {
+				t.Fatalf("expected a single bank call with a reference, got %q", tt.acquirer.references)
+			}
+			if tt.stored != models.Authorized && stored.BankReference != tt.acquirer.references[0] {
+				t.Fatalf("expected the payment to keep the reference %q, got %q", tt.acquirer.references[0], stored.BankReference)
+			}
+		})
+	}
+}
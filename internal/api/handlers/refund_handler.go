@@ -5,8 +5,8 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
-	"strconv"
 
+	"github.com/arielcr/payment-gateway/internal/audit"
 	"github.com/arielcr/payment-gateway/internal/bank"
 	"github.com/arielcr/payment-gateway/internal/config"
 	"github.com/arielcr/payment-gateway/internal/models"
@@ -16,27 +16,42 @@ import (
 
 // RefundHandler handles HTTP requests related to processing refunds.
 type RefundHandler struct {
-	store  storage.Repository
-	config config.Application
-	logger *slog.Logger
+	store     storage.Repository
+	config    config.Application
+	acquirers *bank.Registry
+	audit     *audit.Logger
+	logger    *slog.Logger
 }
 
-// NewRefundHandler creates a new instance of RefundHandler with the provided store and config.
-func NewRefundHandler(store storage.Repository, config config.Application, logger *slog.Logger) *RefundHandler {
+// NewRefundHandler creates a new instance of RefundHandler with the provided store, config, acquirers and audit logger.
+func NewRefundHandler(store storage.Repository, config config.Application, acquirers *bank.Registry, auditLogger *audit.Logger, logger *slog.Logger) *RefundHandler {
 	return &RefundHandler{
-		store:  store,
-		config: config,
-		logger: logger,
+		store:     store,
+		config:    config,
+		acquirers: acquirers,
+		audit:     auditLogger,
+		logger:    logger,
 	}
 }
 
 // RefundPayment handles the HTTP POST request to process a refund for a payment.
 // It decodes the request body, sends a refund request to the acquiring bank, and updates the payment status.
+// The response holds the status of the refund and the resulting status of the payment. When the outcome at the
+// bank is unknown the refund is accepted as pending, and it is settled by the reconciliation.
 func (p *RefundHandler) RefundPayment(context *gin.Context) {
 	p.logger.Info("Refunding payment")
 
-	var status models.PaymentStatus
-	paymentID := context.Param("paymentID")
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
+	paymentID, err := parsePaymentID(context.Param("paymentID"))
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	refundRequest := models.RefundRequest{}
 	if err := context.BindJSON(&refundRequest); err != nil {
@@ -45,47 +60,156 @@ func (p *RefundHandler) RefundPayment(context *gin.Context) {
 		return
 	}
 
-	refundResult, err := p.sendRefundRequest(refundRequest)
+	payment, err := p.store.FindPayment(merchant.ID, paymentID)
 	if err != nil {
 		p.logger.Error(err.Error())
-		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	if refundResult.Success {
-		status = models.Refunded
-		_, err := p.createRefund(refundRequest, paymentID, status)
-		if err != nil {
-			p.logger.Error(err.Error())
-			context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
+	if err := payment.Status.ValidateTransition(models.Refunded); err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	refund, err := p.createRefund(refundRequest, payment)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(updateErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	p.recordAudit(merchant, audit.RefundCreated, nil, refund)
+
+	pending := refund
+	refundResult, err := p.sendRefundRequest(payment, refund)
+	if errors.Is(err, bank.ErrBankUnavailable) && !errors.Is(err, bank.ErrCircuitOpen) {
+		// a refund that may have reached the bank stays pending so that its amount is not refunded twice
+		p.logger.Error(err.Error())
+		context.JSON(http.StatusAccepted, newRefundResponse(refund, payment))
+		return
+	}
+	if err != nil {
+		p.logger.Error(err.Error())
+		if _, settleErr := p.store.SettleRefund(&refund, models.RefundFailed); settleErr != nil {
+			p.logger.Error(settleErr.Error())
+		} else {
+			p.recordAudit(merchant, audit.RefundSettled, pending, refund)
 		}
+		context.AbortWithStatusJSON(bankErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	context.JSON(http.StatusOK, &models.RefundResponse{Status: "refunded"})
+	refundStatus := models.RefundFailed
+	if refundResult.Success {
+		refundStatus = models.RefundSucceeded
+	}
+
+	payment, err = p.store.SettleRefund(&refund, refundStatus)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(updateErrorStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	p.recordAudit(merchant, audit.RefundSettled, pending, refund)
+
+	if !refundResult.Success {
+		p.logger.Error(refundResult.Message)
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": refundResult.Message})
+		return
+	}
+
+	context.JSON(http.StatusOK, newRefundResponse(refund, payment))
 }
 
-// createRefund creates a refund record in the database and updates the payment status based on the refund request.
-func (p *RefundHandler) createRefund(refundRequest models.RefundRequest, paymentID string, status models.PaymentStatus) (models.Refund, error) {
-	p.logger.Info("Creating refund")
+// GetRefunds handles the HTTP GET request to list the refunds of a payment.
+// Every refund is returned with its own status, together with the refunded and remaining amounts of the payment.
+func (p *RefundHandler) GetRefunds(context *gin.Context) {
+	p.logger.Info("Getting refunds")
+
+	merchant, ok := authenticatedMerchant(context, p.logger)
+	if !ok {
+		return
+	}
+
+	paymentID, err := parsePaymentID(context.Param("paymentID"))
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	id, err := strconv.Atoi(paymentID)
+	payment, err := p.store.FindPayment(merchant.ID, paymentID)
 	if err != nil {
 		p.logger.Error(err.Error())
-		return models.Refund{}, errors.New("invalid payment id")
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
-	refund := models.Refund{
-		Amount:    refundRequest.Amount,
-		Reason:    refundRequest.Reason,
-		PaymentID: uint(id),
+
+	refunds, err := p.store.GetRefunds(payment.ID)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := p.store.CreateRefund(&refund); err != nil {
+	response, err := models.SummarizeRefunds(payment, refunds)
+	if err != nil {
+		p.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, &response)
+}
+
+// recordAudit records a change the merchant made to a refund in the audit trail. Before is nil for a new refund.
+// The change already happened, so a failure to record it is logged without failing the request.
+func (p *RefundHandler) recordAudit(merchant models.Merchant, action audit.Action, before interface{}, after models.Refund) {
+	event := audit.Event{
+		Actor:      audit.MerchantActor(merchant.ID),
+		MerchantID: merchant.ID,
+		Action:     action,
+		PaymentID:  after.PaymentID,
+		RefundID:   after.ID,
+		Before:     before,
+		After:      after,
+	}
+	if err := p.audit.Record(event); err != nil {
+		p.logger.Error(err.Error())
+	}
+}
+
+// newRefundResponse builds the response of a refund of the payment.
+func newRefundResponse(refund models.Refund, payment models.Payment) *models.RefundResponse {
+	return &models.RefundResponse{
+		ID:            refund.ID,
+		Status:        refund.Status,
+		PaymentStatus: payment.Status,
+		Amount:        refund.Amount,
+		Currency:      refund.Currency,
+	}
+}
+
+// createRefund creates a pending refund record in the database for the payment.
+// The storage system rejects refunds exceeding the refundable balance of the payment.
+func (p *RefundHandler) createRefund(refundRequest models.RefundRequest, payment models.Payment) (models.Refund, error) {
+	p.logger.Info("Creating refund")
+
+	amount, err := refundRequest.MoneyIn(payment.Currency)
+	if err != nil {
 		p.logger.Error(err.Error())
 		return models.Refund{}, err
 	}
 
-	if err := p.store.UpdatePaymentStatus(uint(id), status); err != nil {
+	refund := models.Refund{
+		Amount:    amount,
+		Currency:  amount.Currency,
+		Reason:    refundRequest.Reason,
+		PaymentID: payment.ID,
+	}
+
+	if err := p.store.CreateRefund(&refund); err != nil {
 		p.logger.Error(err.Error())
 		return models.Refund{}, err
 	}
@@ -93,17 +217,24 @@ func (p *RefundHandler) createRefund(refundRequest models.RefundRequest, payment
 	return refund, nil
 }
 
-// sendRefundRequest sends a refund request to the acquiring bank for processing refund.
-// It constructs the request using the refund information and application configuration.
-func (p *RefundHandler) sendRefundRequest(refundRequest models.RefundRequest) (bank.PaymentResponse, error) {
+// sendRefundRequest sends a refund request to the acquiring bank that processed the payment.
+// It constructs the request using the refund information and reference.
+func (p *RefundHandler) sendRefundRequest(payment models.Payment, refund models.Refund) (bank.PaymentResponse, error) {
 	p.logger.Info("Sending refund request")
 
+	acquirer, err := p.acquirers.Get(payment.Processor)
+	if err != nil {
+		p.logger.Error(err.Error())
+		return bank.PaymentResponse{}, err
+	}
+
 	request := bank.RefundRequest{
-		Amount: refundRequest.Amount,
-		Reason: refundRequest.Reason,
+		Reference: refund.Reference(),
+		Amount:    refund.Amount,
+		Currency:  refund.Currency,
+		Reason:    refund.Reason,
 	}
-	acquiringBank := bank.NewAdquiringBank(p.config, p.logger)
-	response, err := acquiringBank.ProcessRefund(request)
+	response, err := acquirer.ProcessRefund(request)
 	if err != nil {
 		p.logger.Error(err.Error())
 		return bank.PaymentResponse{}, err
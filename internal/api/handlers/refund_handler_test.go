@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/bank"
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// newTestRefundHandler returns a refund handler over the store whose acquirers are never reached by the tests.
+func newTestRefundHandler(store *fakeRepository) *RefundHandler {
+	cfg := config.Application{DefaultProcessor: "test-bank"}
+	return NewRefundHandler(store, cfg, bank.NewRegistry(cfg, nil, testLogger()), audit.NewLogger(store, testLogger()), testLogger())
+}
+
+func TestGetRefundsIsScopedToMerchant(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey string
+		status int
+	}{
+		{name: "owner", apiKey: merchantAKey, status: http.StatusOK},
+		{name: "other merchant", apiKey: merchantBKey, status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			store.refunds = []models.Refund{{PaymentID: 100, Amount: models.Money{Currency: "USD"}, Status: models.RefundSucceeded}}
+			handler := newTestRefundHandler(store)
+
+			recorder := serve(t, store, http.MethodGet, "/payments/:paymentID/refunds", "/payments/100/refunds", tt.apiKey, "", handler.GetRefunds)
+			assertStatus(t, recorder, tt.status)
+		})
+	}
+}
+
+func TestRefundPaymentOfAnotherMerchantFails(t *testing.T) {
+	store := newFakeRepository()
+	handler := newTestRefundHandler(store)
+
+	body := `{"amount":"5.00","currency":"USD","reason":"requested by customer"}`
+	recorder := serve(t, store, http.MethodPost, "/merchants/payment/:paymentID/refund", "/merchants/payment/100/refund", merchantBKey, body, handler.RefundPayment)
+
+	assertStatus(t, recorder, http.StatusNotFound)
+	if store.createdRefunds != 0 {
+		t.Fatalf("expected no refund to be created, got %d", store.createdRefunds)
+	}
+}
+
+func TestRefundPaymentRespondsWithRefundStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		acquirer      *fakeAcquirer
+		status        int
+		refundStatus  models.RefundStatus
+		paymentStatus models.PaymentStatus
+	}{
+		{
+			name:          "approved",
+			acquirer:      &fakeAcquirer{response: bank.PaymentResponse{Success: true, Message: "Refund succeeded"}},
+			status:        http.StatusOK,
+			refundStatus:  models.RefundSucceeded,
+			paymentStatus: models.PartiallyRefunded,
+		},
+		{
+			name:          "unknown outcome",
+			acquirer:      &fakeAcquirer{err: fmt.Errorf("%w: timeout", bank.ErrBankUnavailable)},
+			status:        http.StatusAccepted,
+			refundStatus:  models.RefundPending,
+			paymentStatus: models.Succeeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			store.payments[0].Amount = models.NewMoney(2000, "USD")
+			store.payments[0].Currency = "USD"
+			handler := newTestRefundHandler(store)
+			handler.acquirers.Register("test-bank", tt.acquirer)
+
+			body := `{"amount":"5.00","currency":"USD","reason":"requested by customer"}`
+			recorder := serve(t, store, http.MethodPost, "/merchants/payment/:paymentID/refund", "/merchants/payment/100/refund", merchantAKey, body, handler.RefundPayment)
+			assertStatus(t, recorder, tt.status)
+
+			var response models.RefundResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Status != tt.refundStatus || response.PaymentStatus != tt.paymentStatus {
+				t.Fatalf("expected refund %s of a %s payment, got refund %s of a %s payment",
+					tt.refundStatus, tt.paymentStatus, response.Status, response.PaymentStatus)
+			}
+		})
+	}
+}
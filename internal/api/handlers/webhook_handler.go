@@ -0,0 +1,359 @@
+// Package handlers provides HTTP handlers for managing the webhook endpoints of merchants.
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/arielcr/payment-gateway/internal/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of the webhook deliveries returned at a time.
+const (
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 500
+)
+
+// maxSecretOverlap is the longest time the previous signing secrets can be kept when rotating the secret.
+const maxSecretOverlap = 7 * 24 * time.Hour
+
+// Define custom error messages
+var (
+	errInvalidWebhookID     = errors.New("invalid webhook id")
+	errInvalidDeliveryID    = errors.New("invalid delivery id")
+	errInvalidWebhookURL    = errors.New("webhook url must be an absolute https url")
+	errInvalidEventType     = errors.New("unknown event type")
+	errInvalidDeliveryLimit = errors.New("limit must be between 1 and 500")
+	errInvalidSecretOverlap = errors.New("overlap_seconds must be between 0 and 604800")
+)
+
+// WebhookHandler handles HTTP requests related to the webhook endpoints of merchants.
+type WebhookHandler struct {
+	store                 storage.Repository
+	allowHTTP             bool
+	allowPrivateAddresses bool
+	secretOverlap         time.Duration
+	logger                *slog.Logger
+}
+
+// NewWebhookHandler creates a new instance of WebhookHandler with the provided store and webhook configuration.
+func NewWebhookHandler(store storage.Repository, config config.Application, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		store:                 store,
+		allowHTTP:             config.Webhook.AllowHTTP,
+		allowPrivateAddresses: config.Webhook.AllowPrivateAddresses,
+		secretOverlap:         config.Webhook.SecretOverlap,
+		logger:                logger,
+	}
+}
+
+// CreateWebhook handles the HTTP POST request to register a webhook endpoint for the merchant.
+// When the merchant has no signing secret yet, one is created and returned in the response, and it is not
+// returned again.
+func (h *WebhookHandler) CreateWebhook(context *gin.Context) {
+	h.logger.Info("Creating webhook")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	webhookRequest := models.WebhookEndpointRequest{}
+	if err := context.BindJSON(&webhookRequest); err != nil {
+		h.logger.Error(err.Error())
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	eventTypes, err := h.validateWebhookRequest(context, webhookRequest)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secrets, err := h.store.GetWebhookSecrets(merchant.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var secret models.WebhookSecret
+	if len(secrets) == 0 {
+		if secret, err = h.rotateSecret(merchant, 0); err != nil {
+			h.logger.Error(err.Error())
+			context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	endpoint := models.WebhookEndpoint{
+		MerchantID: merchant.ID,
+		URL:        webhookRequest.URL,
+		EventTypes: eventTypes,
+	}
+	if err := h.store.CreateWebhookEndpoint(&endpoint); err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := newWebhookEndpointResponse(endpoint)
+	response.Secret = secret.Secret
+	context.JSON(http.StatusCreated, &response)
+}
+
+// GetWebhooks handles the HTTP GET request to list the webhook endpoints of the merchant.
+func (h *WebhookHandler) GetWebhooks(context *gin.Context) {
+	h.logger.Info("Getting webhooks")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	endpoints, err := h.store.GetWebhookEndpoints(merchant.ID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]models.WebhookEndpointResponse, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		response = append(response, newWebhookEndpointResponse(endpoint))
+	}
+	context.JSON(http.StatusOK, &response)
+}
+
+// DeleteWebhook handles the HTTP DELETE request to remove a webhook endpoint of the merchant.
+// Deliveries still pending for the endpoint are not sent.
+func (h *WebhookHandler) DeleteWebhook(context *gin.Context) {
+	h.logger.Info("Deleting webhook")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	endpointID, err := parseWebhookID(context.Param("webhookID"), errInvalidWebhookID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.DeleteWebhookEndpoint(merchant.ID, endpointID); err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+// GetDeliveries handles the HTTP GET request to list the most recent deliveries of a webhook endpoint of the merchant.
+func (h *WebhookHandler) GetDeliveries(context *gin.Context) {
+	h.logger.Info("Getting webhook deliveries")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	endpointID, err := parseWebhookID(context.Param("webhookID"), errInvalidWebhookID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := defaultDeliveryPageSize
+	if value := context.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxDeliveryPageSize {
+			h.logger.Error(errInvalidDeliveryLimit.Error())
+			context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidDeliveryLimit.Error()})
+			return
+		}
+	}
+
+	if _, err := h.store.GetWebhookEndpoint(merchant.ID, endpointID); err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	deliveries, err := h.store.GetWebhookDeliveries(merchant.ID, endpointID, limit)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.WebhookDeliveryListResponse{
+		EndpointID: endpointID,
+		Deliveries: deliveries,
+	}
+	context.JSON(http.StatusOK, &response)
+}
+
+// RedeliverWebhook handles the HTTP POST request to send the event of a webhook delivery of the merchant again.
+// A new pending delivery is created, which is sent on the next poll of the pending deliveries.
+func (h *WebhookHandler) RedeliverWebhook(context *gin.Context) {
+	h.logger.Info("Redelivering webhook")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := parseWebhookID(context.Param("deliveryID"), errInvalidDeliveryID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	delivery, err := h.store.GetWebhookDelivery(merchant.ID, deliveryID)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.store.GetWebhookEndpoint(merchant.ID, delivery.EndpointID); err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	redelivery, err := h.store.RedeliverWebhookDelivery(delivery)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusAccepted, &redelivery)
+}
+
+// RotateWebhookSecret handles the HTTP POST request to replace the webhook signing secret of the merchant.
+// Requests keep being signed with the previous secrets as well until the overlap elapses, so that the merchant can
+// switch its endpoints to the new secret, which is only returned in the response.
+func (h *WebhookHandler) RotateWebhookSecret(context *gin.Context) {
+	h.logger.Info("Rotating webhook secret")
+
+	merchant, ok := authenticatedMerchant(context, h.logger)
+	if !ok {
+		return
+	}
+
+	rotationRequest := models.WebhookSecretRotationRequest{}
+	if context.Request.ContentLength != 0 {
+		if err := context.BindJSON(&rotationRequest); err != nil {
+			h.logger.Error(err.Error())
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	overlap := h.secretOverlap
+	if rotationRequest.OverlapSeconds != 0 {
+		overlap = time.Duration(rotationRequest.OverlapSeconds) * time.Second
+		if overlap < 0 || overlap > maxSecretOverlap {
+			h.logger.Error(errInvalidSecretOverlap.Error())
+			context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidSecretOverlap.Error()})
+			return
+		}
+	}
+
+	secret, err := h.rotateSecret(merchant, overlap)
+	if err != nil {
+		h.logger.Error(err.Error())
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	previousSecretsExpireAt := secret.CreatedAt.Add(overlap)
+	response := models.WebhookSecretResponse{
+		ID:                      secret.ID,
+		Secret:                  secret.Secret,
+		CreatedAt:               secret.CreatedAt,
+		PreviousSecretsExpireAt: &previousSecretsExpireAt,
+	}
+	context.JSON(http.StatusCreated, &response)
+}
+
+// rotateSecret generates and stores a new signing secret for the merchant, expiring its previous secrets once the
+// overlap elapses.
+func (h *WebhookHandler) rotateSecret(merchant models.Merchant, overlap time.Duration) (models.WebhookSecret, error) {
+	value, err := webhook.GenerateSecret()
+	if err != nil {
+		return models.WebhookSecret{}, err
+	}
+
+	secret := models.WebhookSecret{
+		MerchantID: merchant.ID,
+		Secret:     value,
+	}
+	if err := h.store.RotateWebhookSecret(&secret, overlap); err != nil {
+		return models.WebhookSecret{}, err
+	}
+	return secret, nil
+}
+
+// validateWebhookRequest checks the URL and event types of a webhook endpoint, returning the event types in the
+// form they are stored. The host of the URL must resolve to public addresses only.
+func (h *WebhookHandler) validateWebhookRequest(context *gin.Context, webhookRequest models.WebhookEndpointRequest) (string, error) {
+	endpointURL, err := url.Parse(webhookRequest.URL)
+	if err != nil || endpointURL.Host == "" ||
+		(endpointURL.Scheme != "https" && !(h.allowHTTP && endpointURL.Scheme == "http")) {
+		return "", errInvalidWebhookURL
+	}
+	if !h.allowPrivateAddresses {
+		if err := webhook.CheckEndpointHost(context.Request.Context(), endpointURL.Hostname()); err != nil {
+			return "", err
+		}
+	}
+
+	eventTypes := make([]string, 0, len(webhookRequest.EventTypes))
+	for _, eventType := range webhookRequest.EventTypes {
+		if !models.IsEventType(eventType) {
+			return "", fmt.Errorf("%w: %s", errInvalidEventType, eventType)
+		}
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	return strings.Join(eventTypes, ","), nil
+}
+
+// parseWebhookID converts a webhook or delivery ID path parameter into a numeric ID, returning the given error
+// when it is not one.
+func parseWebhookID(value string, invalid error) (uint, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return 0, invalid
+	}
+	return uint(id), nil
+}
+
+// newWebhookEndpointResponse builds the response of a webhook endpoint, which does not include its secret.
+func newWebhookEndpointResponse(endpoint models.WebhookEndpoint) models.WebhookEndpointResponse {
+	return models.WebhookEndpointResponse{
+		ID:         endpoint.ID,
+		URL:        endpoint.URL,
+		EventTypes: endpoint.SubscribedEventTypes(),
+		CreatedAt:  endpoint.CreatedAt,
+	}
+}
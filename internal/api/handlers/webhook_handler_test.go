@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+)
+
+func TestCreateWebhookRejectsPrivateAddresses(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "loopback", url: "https://127.0.0.1/hooks"},
+		{name: "localhost", url: "https://localhost:8443/hooks"},
+		{name: "private", url: "https://10.0.0.8/hooks"},
+		{name: "link-local metadata", url: "https://169.254.169.254/latest/meta-data"},
+		{name: "ipv6 loopback", url: "https://[::1]/hooks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRepository()
+			handler := NewWebhookHandler(store, config.Application{}, testLogger())
+
+			recorder := serve(t, store, http.MethodPost, "/merchants/webhooks", "/merchants/webhooks", merchantAKey, `{"url":"`+tt.url+`"}`, handler.CreateWebhook)
+			assertStatus(t, recorder, http.StatusBadRequest)
+		})
+	}
+}
@@ -5,32 +5,43 @@ import (
 	"strings"
 
 	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
 	"github.com/arielcr/payment-gateway/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func Authenticate(config config.Application) gin.HandlerFunc {
+// Authenticate validates the bearer JWT of the request against the keys of the identity provider and copies
+// its claims into the gin context. The caller is granted the scopes of the scope claim and of its user type.
+func Authenticate(config config.Application, keys *utils.KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.Request.Header.Get("Authorization")
-		headerParts := strings.Split(authHeader, " ")
-		clientToken := headerParts[1]
-		if clientToken == "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "No Authorization Header Provided"})
-			c.Abort()
-			return
+		if authenticateToken(c, config, keys) {
+			c.Next()
 		}
+	}
+}
 
-		claims, err := utils.ValidateToken(clientToken, config)
-		if err != "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-			c.Abort()
-			return
-		}
-		c.Set("email", claims.Email)
-		c.Set("first_name", claims.First_name)
-		c.Set("last_name", claims.Last_name)
-		c.Set("uid", claims.Uid)
-		c.Set("user_type", claims.User_type)
-		c.Next()
+// authenticateToken validates the bearer JWT of the request and copies its claims and scopes into the gin context,
+// aborting the request when the token is missing or invalid. It reports whether the request was authenticated.
+func authenticateToken(c *gin.Context, config config.Application, keys *utils.KeySet) bool {
+	authHeader := c.Request.Header.Get("Authorization")
+	clientToken, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || clientToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No Authorization Header Provided"})
+		c.Abort()
+		return false
+	}
+
+	claims, err := utils.ValidateToken(clientToken, keys, config)
+	if err != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err})
+		c.Abort()
+		return false
 	}
+	c.Set("email", claims.Email)
+	c.Set("first_name", claims.First_name)
+	c.Set("last_name", claims.Last_name)
+	c.Set("uid", claims.Uid)
+	c.Set("user_type", claims.User_type)
+	c.Set(scopesContextKey, append(models.ParseScopes(claims.Scope), models.RoleScopes(claims.User_type)...))
+	return true
 }
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// scopesContextKey is the gin context key holding the scopes granted to the authenticated caller.
+const scopesContextKey = "scopes"
+
+var errInsufficientScope = errors.New("insufficient scope")
+
+// RequireScope rejects requests whose authenticated caller was not granted the given scope, or admin.
+// It must run after the middleware that authenticates the caller.
+func RequireScope(scope models.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, _ := c.Value(scopesContextKey).([]models.Scope)
+		if !models.HasScope(granted, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": errInsufficientScope.Error(),
+				"scope": scope,
+			})
+			return
+		}
+		c.Next()
+	}
+}
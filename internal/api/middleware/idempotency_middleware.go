@@ -0,0 +1,269 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader is the request header carrying the client supplied idempotency key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	errIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	errIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// responseRecorder keeps a copy of everything written to the response so it can be replayed.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+// Write writes the data to the response and to the recorded copy.
+func (r responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// Idempotency makes the wrapped endpoint safe to retry when the client sends an Idempotency-Key header.
+// The first request with a key is executed and its response stored, replays with the same body get the stored
+// response back, replays with a different body are rejected with 422 and concurrent replays with 409.
+// A request holds its key until it completes, renewing its lock while it runs however long its bank calls take, and
+// a replay arriving once the lock was not renewed for the lock timeout executes the request again, so that a key is
+// not blocked forever by a request that stopped before completing, such as when the gateway was restarted.
+// Keys are stored per authenticated merchant, so it must run after AuthenticateMerchant.
+func Idempotency(store storage.Repository, config config.Application, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			logger.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		merchant, err := AuthenticatedMerchant(c)
+		if err != nil {
+			logger.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		idempotencyKey := models.IdempotencyKey{
+			MerchantID:  merchant.ID,
+			Key:         key,
+			RequestHash: hashRequest(c.Request.Method, c.Request.URL.Path, body),
+			LockedAt:    time.Now(),
+		}
+
+		if err := store.CreateIdempotencyKey(&idempotencyKey); err != nil {
+			if !errors.Is(err, storage.ErrIdempotencyKeyExists) {
+				logger.Error(err.Error())
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			var reclaimed bool
+			if idempotencyKey, reclaimed = replayIdempotentRequest(c, store, idempotencyKey, config.Idempotency.LockTimeout, logger); !reclaimed {
+				return
+			}
+		}
+
+		stopRenewing := renewIdempotencyLock(store, idempotencyKey, config.Idempotency.LockTimeout, logger)
+
+		// a request that panics releases its key before the panic reaches the recovery middleware
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				stopRenewing()
+				if err := store.DeleteIdempotencyKey(&idempotencyKey); err != nil {
+					logger.Error(err.Error())
+				}
+				panic(recovered)
+			}
+		}()
+
+		recorder := responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+		c.Next()
+		stopRenewing()
+
+		// Server errors are not stored so the client can retry the request with the same key.
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := store.DeleteIdempotencyKey(&idempotencyKey); err != nil {
+				logger.Error(err.Error())
+			}
+			return
+		}
+
+		idempotencyKey.Completed = true
+		idempotencyKey.StatusCode = recorder.Status()
+		idempotencyKey.ResponseBody = recorder.body.String()
+		if err := store.UpdateIdempotencyKey(&idempotencyKey); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+}
+
+// replayIdempotentRequest answers a request whose idempotency key was already stored. When the request holding
+// the key never completed and its lock timed out, the key is taken over and returned with reclaimed set, and the
+// request must be executed again.
+func replayIdempotentRequest(c *gin.Context, store storage.Repository, request models.IdempotencyKey, lockTimeout time.Duration, logger *slog.Logger) (key models.IdempotencyKey, reclaimed bool) {
+	stored, err := store.GetIdempotencyKey(request.MerchantID, request.Key)
+	if err != nil {
+		logger.Error(err.Error())
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.IdempotencyKey{}, false
+	}
+
+	if stored.RequestHash != request.RequestHash {
+		logger.Error(errIdempotencyKeyReused.Error())
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": errIdempotencyKeyReused.Error()})
+		return models.IdempotencyKey{}, false
+	}
+
+	if stored.LockExpired(lockTimeout, time.Now()) {
+		reclaimed, err := store.ReclaimIdempotencyKey(&stored, time.Now().Add(-lockTimeout))
+		if err != nil {
+			logger.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return models.IdempotencyKey{}, false
+		}
+		if reclaimed {
+			logger.Warn("Reclaimed idempotency key of a request that did not complete", slog.String("key", stored.Key))
+			return stored, true
+		}
+	}
+
+	if !stored.Completed {
+		logger.Error(errIdempotencyKeyInProgress.Error())
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": errIdempotencyKeyInProgress.Error()})
+		return models.IdempotencyKey{}, false
+	}
+
+	logger.Info("Replaying idempotent response")
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.StatusCode, "application/json; charset=utf-8", []byte(stored.ResponseBody))
+	c.Abort()
+	return models.IdempotencyKey{}, false
+}
+
+// renewIdempotencyLock renews the lock of the idempotency key every third of the lock timeout until the returned
+// function is called, so that a replay cannot take the key over while the request holding it is still running.
+func renewIdempotencyLock(store storage.Repository, key models.IdempotencyKey, lockTimeout time.Duration, logger *slog.Logger) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(lockTimeout / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := store.RenewIdempotencyKey(&key); err != nil {
+					logger.Error(err.Error(), slog.String("key", key.Key))
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}
+}
+
+// hashRequest computes the fingerprint of a request used to detect a reused idempotency key.
+func hashRequest(method string, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte(path))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// IdempotencyKeyCleaner removes the idempotency keys older than their time to live on schedule, after which the
+// merchant can use the keys again.
+type IdempotencyKeyCleaner struct {
+	store    storage.Repository
+	interval time.Duration
+	ttl      time.Duration
+	logger   *slog.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewIdempotencyKeyCleaner creates a new instance of IdempotencyKeyCleaner with the provided store and idempotency configuration.
+func NewIdempotencyKeyCleaner(store storage.Repository, config config.Application, logger *slog.Logger) *IdempotencyKeyCleaner {
+	return &IdempotencyKeyCleaner{
+		store:    store,
+		interval: config.Idempotency.CleanupInterval,
+		ttl:      config.Idempotency.TTL,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start starts removing the expired idempotency keys every cleanup interval.
+func (k *IdempotencyKeyCleaner) Start() {
+	k.logger.Info("Starting idempotency key cleanup")
+
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+
+		ticker := time.NewTicker(k.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-k.stop:
+				return
+			case <-ticker.C:
+				k.cleanup()
+			}
+		}
+	}()
+}
+
+// Stop stops the cleanup, waiting for the one in progress.
+func (k *IdempotencyKeyCleaner) Stop() {
+	k.logger.Info("Stopping idempotency key cleanup")
+
+	close(k.stop)
+	k.wg.Wait()
+}
+
+// cleanup removes the idempotency keys created longer than the time to live ago.
+func (k *IdempotencyKeyCleaner) cleanup() {
+	removed, err := k.store.DeleteExpiredIdempotencyKeys(time.Now().Add(-k.ttl))
+	if err != nil {
+		k.logger.Error(err.Error())
+		return
+	}
+	k.logger.Info("Idempotency keys cleaned up", slog.Int64("idempotency_keys", removed))
+}
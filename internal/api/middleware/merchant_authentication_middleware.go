@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/arielcr/payment-gateway/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the request header carrying the API key of the merchant.
+const APIKeyHeader = "X-Api-Key"
+
+// MerchantIDHeader is the request header selecting the merchant whose records staff authenticated with a JWT read.
+const MerchantIDHeader = "X-Merchant-Id"
+
+// Gin context keys holding the authenticated merchant and the API key it authenticated with.
+const (
+	merchantContextKey = "merchant"
+	apiKeyContextKey   = "api_key"
+)
+
+var (
+	errMissingAPIKey         = errors.New("no API key provided")
+	errInvalidAPIKey         = errors.New("invalid API key")
+	errMerchantNotAuthorized = errors.New("request is not authenticated as a merchant")
+	errApiKeyNotAuthorized   = errors.New("request is not authenticated with an API key")
+	errInvalidMerchantID     = errors.New("invalid merchant id")
+	errMerchantNotFound      = errors.New("merchant not found")
+)
+
+// AuthenticateMerchant authenticates the merchant of the request by one of its API keys, which are stored hashed,
+// and injects the merchant and the key into the gin context for the handlers together with the scopes granted to
+// the key.
+func AuthenticateMerchant(store storage.Repository, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader(APIKeyHeader)
+		if apiKey == "" {
+			logger.Error(errMissingAPIKey.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errMissingAPIKey.Error()})
+			return
+		}
+
+		key, err := store.GetMerchantApiKey(models.HashApiToken(apiKey))
+		if err != nil {
+			logger.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errInvalidAPIKey.Error()})
+			return
+		}
+
+		merchant, err := store.GetMerchant(key.MerchantID)
+		if err != nil {
+			logger.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errInvalidAPIKey.Error()})
+			return
+		}
+
+		c.Set(merchantContextKey, merchant)
+		c.Set(apiKeyContextKey, key)
+		c.Set(scopesContextKey, key.GrantedScopes())
+		c.Next()
+	}
+}
+
+// AuthenticateMerchantOrStaff authenticates requests carrying an API key like AuthenticateMerchant, and other
+// requests by the bearer JWT of a staff member acting on the merchant selected by the MerchantIDHeader. The selected
+// merchant is injected into the gin context like the merchant of an API key, so that handlers only reach its
+// records, and the caller is granted the scopes of its token, which the routes must still require.
+func AuthenticateMerchantOrStaff(store storage.Repository, config config.Application, keys *utils.KeySet, logger *slog.Logger) gin.HandlerFunc {
+	authenticateMerchant := AuthenticateMerchant(store, logger)
+	return func(c *gin.Context) {
+		if c.GetHeader(APIKeyHeader) != "" {
+			authenticateMerchant(c)
+			return
+		}
+
+		if !authenticateToken(c, config, keys) {
+			return
+		}
+
+		merchantID, err := strconv.ParseUint(c.GetHeader(MerchantIDHeader), 10, 0)
+		if err != nil {
+			logger.Error(errInvalidMerchantID.Error())
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidMerchantID.Error()})
+			return
+		}
+
+		merchant, err := store.GetMerchant(uint(merchantID))
+		if err != nil {
+			logger.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errMerchantNotFound.Error()})
+			return
+		}
+
+		c.Set(merchantContextKey, merchant)
+		c.Next()
+	}
+}
+
+// AuthenticatedMerchant returns the merchant injected into the gin context by AuthenticateMerchant.
+func AuthenticatedMerchant(c *gin.Context) (models.Merchant, error) {
+	merchant, ok := c.Value(merchantContextKey).(models.Merchant)
+	if !ok {
+		return models.Merchant{}, errMerchantNotAuthorized
+	}
+	return merchant, nil
+}
+
+// AuthenticatedApiKey returns the API key injected into the gin context by AuthenticateMerchant.
+func AuthenticatedApiKey(c *gin.Context) (models.MerchantApiKey, error) {
+	key, ok := c.Value(apiKeyContextKey).(models.MerchantApiKey)
+	if !ok {
+		return models.MerchantApiKey{}, errApiKeyNotAuthorized
+	}
+	return key, nil
+}
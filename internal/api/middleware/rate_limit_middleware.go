@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitClass identifies a group of routes sharing the same rate limit of a merchant.
+type RateLimitClass string
+
+// Rate limit classes of the merchant routes.
+const (
+	PaymentRoutes RateLimitClass = "payments"
+	ReadRoutes    RateLimitClass = "reads"
+)
+
+var errRateLimitExceeded = errors.New("rate limit exceeded")
+
+// tokenBucket holds the tokens left to a merchant for a class of routes.
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// bucketIdleTimeout is how long a bucket goes unused before it is evicted. Buckets refill within a minute, so an
+// evicted bucket was already full and is recreated full.
+const bucketIdleTimeout = time.Minute
+
+// RateLimiter keeps in memory a token bucket per merchant and class of routes.
+// Buckets hold as many tokens as the limit per minute and refill continuously at that rate, and the buckets of
+// merchants that stopped sending requests are evicted so that they do not pile up.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter with full buckets.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets: map[string]*tokenBucket{},
+		sweptAt: time.Now(),
+		now:     time.Now,
+	}
+}
+
+// Take takes a token from the bucket of the key for the given limit per minute. It returns whether the request
+// is allowed, the tokens remaining, and how long until a token is available and until the bucket is full again.
+func (l *RateLimiter) Take(key string, limit int) (allowed bool, remaining int, retryAfter time.Duration, reset time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	capacity := float64(limit)
+	perSecond := capacity / time.Minute.Seconds()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updatedAt: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*perSecond)
+	bucket.updatedAt = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		allowed = true
+	} else {
+		retryAfter = secondsToDuration((1 - bucket.tokens) / perSecond)
+	}
+	reset = secondsToDuration((capacity - bucket.tokens) / perSecond)
+	return allowed, int(bucket.tokens), retryAfter, reset
+}
+
+// sweep evicts the buckets left unused for the idle timeout, at most once per idle timeout.
+// It must be called with the lock held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < bucketIdleTimeout {
+		return
+	}
+	l.sweptAt = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updatedAt) >= bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit limits the requests of the authenticated merchant to the given class of routes with a token bucket.
+// Merchants use their own limit per minute when they have one and the configured default otherwise. Responses
+// carry the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers, and rejected requests get
+// a 429 with a Retry-After header. It must run after AuthenticateMerchant or AuthenticateMerchantOrStaff.
+func RateLimit(limiter *RateLimiter, class RateLimitClass, config config.Application, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		merchant, err := AuthenticatedMerchant(c)
+		if err != nil {
+			logger.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		limit := class.limit(merchant, config)
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		allowed, remaining, retryAfter, reset := limiter.Take(fmt.Sprintf("%d:%s", merchant.ID, class), limit)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+
+		if !allowed {
+			logger.Warn(errRateLimitExceeded.Error(), slog.Uint64("merchant_id", uint64(merchant.ID)), slog.String("class", string(class)))
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": errRateLimitExceeded.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// limit returns the limit per minute of the class for the merchant, falling back to the configured default.
+func (c RateLimitClass) limit(merchant models.Merchant, config config.Application) int {
+	switch c {
+	case PaymentRoutes:
+		if merchant.PaymentRateLimit > 0 {
+			return merchant.PaymentRateLimit
+		}
+		return config.RateLimit.PaymentsPerMinute
+	case ReadRoutes:
+		if merchant.ReadRateLimit > 0 {
+			return merchant.ReadRateLimit
+		}
+		return config.RateLimit.ReadsPerMinute
+	default:
+		return 0
+	}
+}
+
+// secondsToDuration converts a number of seconds into a duration.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ceilSeconds rounds a duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/arielcr/payment-gateway/internal/api/handlers"
 	"github.com/arielcr/payment-gateway/internal/api/middleware"
 	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/arielcr/payment-gateway/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,16 +20,39 @@ type Router struct {
 	Server         *gin.Engine
 	logger         *slog.Logger
 	Config         config.Application
+	store          storage.Repository
+	keys           *utils.KeySet
 	PaymentHandler *handlers.PaymentHandler
 	RefundHandler  *handlers.RefundHandler
+	CardHandler    *handlers.CardHandler
+	AuditHandler   *handlers.AuditHandler
+	WebhookHandler *handlers.WebhookHandler
+	ApiKeyHandler  *handlers.ApiKeyHandler
 }
 
-// NewRouter creates a new instance of Router with the provided port, payment handler, and refund handler.
-func NewRouter(config config.Application, paymentHandler *handlers.PaymentHandler, refundHandler *handlers.RefundHandler, logger *slog.Logger) *Router {
+// NewRouter creates a new instance of Router with the provided config, store, token key set, payment handler,
+// refund handler, card handler, audit handler, webhook handler and API key handler.
+func NewRouter(
+	config config.Application,
+	store storage.Repository,
+	keys *utils.KeySet,
+	paymentHandler *handlers.PaymentHandler,
+	refundHandler *handlers.RefundHandler,
+	cardHandler *handlers.CardHandler,
+	auditHandler *handlers.AuditHandler,
+	webhookHandler *handlers.WebhookHandler,
+	apiKeyHandler *handlers.ApiKeyHandler,
+	logger *slog.Logger) *Router {
 	return &Router{
 		Config:         config,
+		store:          store,
+		keys:           keys,
 		PaymentHandler: paymentHandler,
 		RefundHandler:  refundHandler,
+		CardHandler:    cardHandler,
+		AuditHandler:   auditHandler,
+		WebhookHandler: webhookHandler,
+		ApiKeyHandler:  apiKeyHandler,
 		logger:         logger,
 	}
 }
@@ -36,28 +62,118 @@ func (r *Router) InitializeEndpoints() {
 	r.logger.Info("Initializing endpoints")
 
 	server := gin.Default()
-
-	// Add authentication middleware
-	server.Use(middleware.Authenticate(r.Config))
+	limiter := middleware.NewRateLimiter()
 
 	// Health check endpoint
-	server.GET("/health", func(c *gin.Context) {
+	server.GET("/health", middleware.Authenticate(r.Config, r.keys), func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"status": http.StatusText(http.StatusOK),
 		})
 	})
 
-	// Merchant endpoints for processing payments and refunds
-	merchants := server.Group("/merchants")
+	// Merchant endpoints for processing payments and refunds, authenticated with the merchant API key
+	merchants := server.Group("/merchants", middleware.AuthenticateMerchant(r.store, r.logger))
 	{
-		merchants.POST("/payment/process", r.PaymentHandler.ProcessPayment)
-		merchants.POST("/payment/:paymentID/refund", r.RefundHandler.RefundPayment)
+		merchants.POST("/payment/process",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsWrite),
+			middleware.Idempotency(r.store, r.Config, r.logger),
+			r.PaymentHandler.ProcessPayment)
+		merchants.POST("/payment/authorize",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsWrite),
+			middleware.Idempotency(r.store, r.Config, r.logger),
+			r.PaymentHandler.AuthorizePayment)
+		merchants.POST("/payment/:paymentID/capture",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsWrite),
+			middleware.Idempotency(r.store, r.Config, r.logger),
+			r.PaymentHandler.CapturePayment)
+		merchants.POST("/payment/:paymentID/cancel",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsWrite),
+			middleware.Idempotency(r.store, r.Config, r.logger),
+			r.PaymentHandler.CancelPayment)
+		merchants.POST("/payment/:paymentID/refund",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeRefundsWrite),
+			middleware.Idempotency(r.store, r.Config, r.logger),
+			r.RefundHandler.RefundPayment)
+		merchants.POST("/webhooks",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeWebhooksWrite),
+			r.WebhookHandler.CreateWebhook)
+		merchants.POST("/webhooks/secrets/rotate",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeWebhooksWrite),
+			r.WebhookHandler.RotateWebhookSecret)
+		merchants.GET("/webhooks",
+			middleware.RateLimit(limiter, middleware.ReadRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsRead),
+			r.WebhookHandler.GetWebhooks)
+		merchants.DELETE("/webhooks/:webhookID",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeWebhooksWrite),
+			r.WebhookHandler.DeleteWebhook)
+		merchants.GET("/webhooks/:webhookID/deliveries",
+			middleware.RateLimit(limiter, middleware.ReadRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsRead),
+			r.WebhookHandler.GetDeliveries)
+		merchants.POST("/webhooks/deliveries/:deliveryID/redeliver",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeWebhooksWrite),
+			r.WebhookHandler.RedeliverWebhook)
+		merchants.POST("/api-keys",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeApiKeysWrite),
+			r.ApiKeyHandler.CreateApiKey)
+		merchants.GET("/api-keys",
+			middleware.RateLimit(limiter, middleware.ReadRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeApiKeysRead),
+			r.ApiKeyHandler.GetApiKeys)
+		merchants.DELETE("/api-keys/:keyID",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopeApiKeysWrite),
+			r.ApiKeyHandler.RevokeApiKey)
 	}
 
-	// Payment endpoint for retrieving payment information by ID
-	payments := server.Group("/payments")
+	// Payment endpoints for listing payments and retrieving payment information by ID, authenticated with the
+	// merchant API key or with the JWT of support staff selecting the merchant
+	payments := server.Group("/payments",
+		middleware.AuthenticateMerchantOrStaff(r.store, r.Config, r.keys, r.logger),
+		middleware.RateLimit(limiter, middleware.ReadRoutes, r.Config, r.logger),
+		middleware.RequireScope(models.ScopePaymentsRead))
 	{
+		payments.GET("", r.PaymentHandler.ListPayments)
 		payments.GET("/:paymentID", r.PaymentHandler.GetPayment)
+		payments.GET("/by-order/:orderToken", r.PaymentHandler.GetPaymentByOrderToken)
+		payments.GET("/:paymentID/refunds", r.RefundHandler.GetRefunds)
+	}
+
+	// Customer endpoints for managing the saved cards of the customers of a merchant, authenticated with the
+	// merchant API key
+	customers := server.Group("/customers", middleware.AuthenticateMerchant(r.store, r.logger))
+	{
+		customers.GET("/:customerID/cards",
+			middleware.RateLimit(limiter, middleware.ReadRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsRead),
+			r.CardHandler.GetCards)
+		customers.POST("/:customerID/cards",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsWrite),
+			r.CardHandler.AddCard)
+		customers.DELETE("/:customerID/cards/:cardID",
+			middleware.RateLimit(limiter, middleware.PaymentRoutes, r.Config, r.logger),
+			middleware.RequireScope(models.ScopePaymentsWrite),
+			r.CardHandler.DeleteCard)
+	}
+
+	// Admin endpoints for compliance staff, authenticated with a JWT
+	admin := server.Group("/admin", middleware.Authenticate(r.Config, r.keys))
+	{
+		admin.GET("/audit",
+			middleware.RequireScope(models.ScopeAuditRead),
+			r.AuditHandler.GetAuditEntries)
 	}
 
 	r.Server = server
@@ -10,8 +10,16 @@ import (
 
 	"github.com/arielcr/payment-gateway/internal/api"
 	"github.com/arielcr/payment-gateway/internal/api/handlers"
+	"github.com/arielcr/payment-gateway/internal/api/middleware"
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/bank"
 	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/messaging"
+	"github.com/arielcr/payment-gateway/internal/reconciliation"
 	"github.com/arielcr/payment-gateway/internal/storage"
+	"github.com/arielcr/payment-gateway/internal/utils"
+	"github.com/arielcr/payment-gateway/internal/vault"
+	"github.com/arielcr/payment-gateway/internal/webhook"
 )
 
 // Setup contains application metadata
@@ -70,7 +78,10 @@ func (s *Server) Run() error {
 	}
 
 	slog.Info("initializing router")
-	s.initializeRouter()
+	if err := s.initializeRouter(); err != nil {
+		s.logger.Error(err.Error())
+		return errStartingApplication
+	}
 	s.router.Start()
 
 	return nil
@@ -131,12 +142,35 @@ func (s *Server) initializeStorage() error {
 	return nil
 }
 
-// initializeRouter initializes the router with payment and refund handlers,
-// configures the endpoints, and assigns the router to the server.
-func (s *Server) initializeRouter() {
-	paymentHandler := handlers.NewPaymentHandler(s.store, s.config, s.logger)
-	refundHandler := handlers.NewRefundHandler(s.store, s.config, s.logger)
-	router := api.NewRouter(s.config, paymentHandler, refundHandler, s.logger)
+// initializeRouter initializes the router with payment, refund, card, audit and webhook handlers sharing the
+// registry of acquirers, the card vault and the audit logger, starts the message queue of the domain events with
+// the webhook dispatcher subscribed to it, the relay of the outbox to it, the webhook sender, the cleanup of the
+// idempotency keys and the reconciliation of the pending payments and refunds, loads the keys used to validate
+// tokens, configures the endpoints, and assigns the router to the server.
+// Returns an error if the card vault keys are not configured properly.
+func (s *Server) initializeRouter() error {
+	cards, err := vault.NewVault(s.store, s.config, s.logger)
+	if err != nil {
+		return err
+	}
+	keys := utils.NewKeySet(s.config.Token.KeySetSource, s.config.Token.RefreshInterval, s.logger)
+	acquirers := bank.NewRegistry(s.config, cards, s.logger)
+	auditLogger := audit.NewLogger(s.store, s.logger)
+	events := messaging.NewInProcessQueue(s.store, s.config, s.logger)
+	webhook.NewDispatcher(s.store, s.logger).Subscribe(events)
+	events.Start()
+	messaging.NewOutboxRelay(s.store, events, s.config, s.logger).Start()
+	webhook.NewSender(s.store, s.config, s.logger).Start()
+	middleware.NewIdempotencyKeyCleaner(s.store, s.config, s.logger).Start()
+	reconciliation.NewReconciler(s.store, acquirers, auditLogger, s.config, s.logger).Start()
+	paymentHandler := handlers.NewPaymentHandler(s.store, s.config, acquirers, cards, auditLogger, s.logger)
+	refundHandler := handlers.NewRefundHandler(s.store, s.config, acquirers, auditLogger, s.logger)
+	cardHandler := handlers.NewCardHandler(s.store, cards, s.logger)
+	auditHandler := handlers.NewAuditHandler(s.store, s.logger)
+	webhookHandler := handlers.NewWebhookHandler(s.store, s.config, s.logger)
+	apiKeyHandler := handlers.NewApiKeyHandler(s.store, s.logger)
+	router := api.NewRouter(s.config, s.store, keys, paymentHandler, refundHandler, cardHandler, auditHandler, webhookHandler, apiKeyHandler, s.logger)
 	router.InitializeEndpoints()
 	s.router = router
+	return nil
 }
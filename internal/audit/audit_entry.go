@@ -1 +1,125 @@
+// Package audit provides the audit trail of the gateway, which records who changed which payment or refund.
 package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// genesisHash is the previous hash of the first entry of the chain.
+var genesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Action identifies the change recorded by an audit entry.
+type Action string
+
+// Actions recorded on payments and refunds.
+const (
+	PaymentCreated    Action = "payment.created"
+	PaymentCaptured   Action = "payment.captured"
+	PaymentCancelled  Action = "payment.cancelled"
+	PaymentReconciled Action = "payment.reconciled"
+	RefundCreated     Action = "refund.created"
+	RefundSettled     Action = "refund.settled"
+)
+
+// ReconciliationActor is the actor of the changes made when settling pending payments and refunds with the
+// outcome reported by the acquiring bank.
+const ReconciliationActor = "system:reconciliation"
+
+// Entry represents an audit entry stored in the database.
+// Entries are only ever appended. Each one holds the hash of the previous entry and its own hash over its content
+// and that previous hash, so editing or deleting an entry breaks the chain from that entry onward.
+type Entry struct {
+	ID           uint            `gorm:"primaryKey" json:"-"`
+	Sequence     uint64          `gorm:"not null;uniqueIndex" json:"sequence"`
+	OccurredAt   time.Time       `gorm:"type:datetime(6);not null;index" json:"occurred_at"`
+	Actor        string          `gorm:"not null;index" json:"actor"`
+	MerchantID   uint            `gorm:"not null;index" json:"merchant_id"`
+	Action       Action          `gorm:"not null;index" json:"action"`
+	PaymentID    uint            `gorm:"not null;index" json:"payment_id"`
+	RefundID     uint            `gorm:"not null" json:"refund_id,omitempty"`
+	Before       json.RawMessage `gorm:"type:text" json:"before"`
+	After        json.RawMessage `gorm:"type:text" json:"after"`
+	PreviousHash string          `gorm:"type:char(64);not null" json:"previous_hash"`
+	Hash         string          `gorm:"type:char(64);not null" json:"hash"`
+}
+
+// TableName returns the table of the audit entries.
+func (Entry) TableName() string {
+	return "audit_entries"
+}
+
+// Filter selects audit entries by their fields, where zero fields select every entry.
+// Entries are selected after AfterSequence, which paginates through the trail in sequence order.
+type Filter struct {
+	Actor         string
+	MerchantID    uint
+	PaymentID     uint
+	Action        Action
+	From          time.Time
+	To            time.Time
+	AfterSequence uint64
+}
+
+// MerchantActor returns the actor of the changes made with the API key of a merchant.
+func MerchantActor(merchantID uint) string {
+	return fmt.Sprintf("merchant:%d", merchantID)
+}
+
+// Chain links the entry after the previous entry of the chain, or makes it the first one when previous is nil,
+// setting its sequence, previous hash and hash.
+func (e *Entry) Chain(previous *Entry) {
+	e.Sequence = 1
+	e.PreviousHash = genesisHash
+	if previous != nil {
+		e.Sequence = previous.Sequence + 1
+		e.PreviousHash = previous.Hash
+	}
+	e.Hash = e.computeHash()
+}
+
+// computeHash returns the SHA-256 hash of the content of the entry and the hash of the previous entry.
+// The time is hashed in UTC with microsecond precision, which is what the database keeps.
+func (e *Entry) computeHash() string {
+	content, err := json.Marshal(struct {
+		Sequence     uint64          `json:"sequence"`
+		OccurredAt   string          `json:"occurred_at"`
+		Actor        string          `json:"actor"`
+		MerchantID   uint            `json:"merchant_id"`
+		Action       Action          `json:"action"`
+		PaymentID    uint            `json:"payment_id"`
+		RefundID     uint            `json:"refund_id"`
+		Before       json.RawMessage `json:"before"`
+		After        json.RawMessage `json:"after"`
+		PreviousHash string          `json:"previous_hash"`
+	}{
+		Sequence:     e.Sequence,
+		OccurredAt:   e.OccurredAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		Actor:        e.Actor,
+		MerchantID:   e.MerchantID,
+		Action:       e.Action,
+		PaymentID:    e.PaymentID,
+		RefundID:     e.RefundID,
+		Before:       rawOrNull(e.Before),
+		After:        rawOrNull(e.After),
+		PreviousHash: e.PreviousHash,
+	})
+	if err != nil {
+		// the stored state is not valid JSON anymore, so the entry cannot match any hash
+		return ""
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+// rawOrNull returns the state as is, or JSON null when there is none.
+func rawOrNull(state json.RawMessage) json.RawMessage {
+	if len(state) == 0 {
+		return json.RawMessage("null")
+	}
+	return state
+}
@@ -1 +1,137 @@
 package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// verificationBatchSize is the number of entries read at a time while verifying the chain.
+const verificationBatchSize = 500
+
+// ErrChainBroken is returned when the audit entries were edited, deleted or reordered.
+var ErrChainBroken = errors.New("audit chain is broken")
+
+// Store defines the storage of the audit entries.
+type Store interface {
+	// AppendAuditEntry chains the entry after the last stored entry and stores it.
+	AppendAuditEntry(entry *Entry) error
+
+	// GetAuditEntries retrieves up to limit entries with a sequence greater than the given one, in sequence order.
+	GetAuditEntries(afterSequence uint64, limit int) ([]Entry, error)
+}
+
+// Event describes a change to record in the audit trail.
+// Before and After are the states of the payment or refund before and after the change, nil when there is none.
+type Event struct {
+	Actor      string
+	MerchantID uint
+	Action     Action
+	PaymentID  uint
+	RefundID   uint
+	Before     interface{}
+	After      interface{}
+}
+
+// Verification reports the result of verifying the audit chain.
+// Deleting the latest entries cannot be detected from the chain alone, so the head should be kept elsewhere and
+// compared with the one of the next verification.
+type Verification struct {
+	Entries  int    `json:"entries"`
+	Sequence uint64 `json:"sequence"`
+	Head     string `json:"head"`
+}
+
+// Logger records the changes made to payments and refunds in a hash-chained audit trail.
+type Logger struct {
+	store  Store
+	logger *slog.Logger
+}
+
+// NewLogger creates a new instance of Logger with the provided store.
+func NewLogger(store Store, logger *slog.Logger) *Logger {
+	return &Logger{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Record appends an entry for the event to the audit trail.
+func (l *Logger) Record(event Event) error {
+	l.logger.Info("Recording audit entry", slog.String("action", string(event.Action)))
+
+	before, err := marshalState(event.Before)
+	if err != nil {
+		l.logger.Error(err.Error())
+		return err
+	}
+	after, err := marshalState(event.After)
+	if err != nil {
+		l.logger.Error(err.Error())
+		return err
+	}
+
+	entry := Entry{
+		OccurredAt: time.Now().UTC().Truncate(time.Microsecond),
+		Actor:      event.Actor,
+		MerchantID: event.MerchantID,
+		Action:     event.Action,
+		PaymentID:  event.PaymentID,
+		RefundID:   event.RefundID,
+		Before:     before,
+		After:      after,
+	}
+	if err := l.store.AppendAuditEntry(&entry); err != nil {
+		l.logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Verify walks the whole audit chain, checking that the sequence has no gaps, that every entry points to the hash
+// of the previous one and that every hash matches the content of its entry. It returns ErrChainBroken for the
+// first entry that fails, or the number of entries and the head of the chain.
+func (l *Logger) Verify() (Verification, error) {
+	l.logger.Info("Verifying audit chain")
+
+	verification := Verification{Head: genesisHash}
+	for {
+		entries, err := l.store.GetAuditEntries(verification.Sequence, verificationBatchSize)
+		if err != nil {
+			l.logger.Error(err.Error())
+			return verification, err
+		}
+		if len(entries) == 0 {
+			return verification, nil
+		}
+
+		for _, entry := range entries {
+			switch {
+			case entry.Sequence != verification.Sequence+1:
+				err = fmt.Errorf("%w: entry %d follows entry %d", ErrChainBroken, entry.Sequence, verification.Sequence)
+			case entry.PreviousHash != verification.Head:
+				err = fmt.Errorf("%w: entry %d does not point to the previous entry", ErrChainBroken, entry.Sequence)
+			case entry.Hash != entry.computeHash():
+				err = fmt.Errorf("%w: entry %d does not match its hash", ErrChainBroken, entry.Sequence)
+			}
+			if err != nil {
+				l.logger.Error(err.Error())
+				return verification, err
+			}
+
+			verification.Entries++
+			verification.Sequence = entry.Sequence
+			verification.Head = entry.Hash
+		}
+	}
+}
+
+// marshalState encodes the state of a payment or refund, leaving it empty when there is none.
+func marshalState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
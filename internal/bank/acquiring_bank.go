@@ -4,46 +4,157 @@ package bank
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// Define custom error messages
+var (
+	// ErrBankUnavailable is returned when the acquiring bank could not be reached or did not answer in time,
+	// so the outcome of the operation is unknown.
+	ErrBankUnavailable = errors.New("acquiring bank is unavailable")
+
+	// ErrCircuitOpen is returned without calling the acquiring bank while its circuit breaker is open.
+	ErrCircuitOpen = fmt.Errorf("%w: circuit breaker is open", ErrBankUnavailable)
+
+	// ErrBankRejected is returned when the acquiring bank rejects the request itself.
+	ErrBankRejected = errors.New("acquiring bank rejected the request")
 )
 
 // PaymentRequest represents a payment request sent to the acquiring bank.
+// The card is given by its vault token, and its number is only resolved right before calling the bank.
+// The reference identifies the payment at the bank, which reports the outcome of the transaction it received with
+// a reference when asked for its status.
 type PaymentRequest struct {
-	Amount      float64 `json:"amount"`
-	CardNumber  string  `json:"card_number"`
-	ExpiryMonth string  `json:"expiry_month"`
-	ExpiryYear  string  `json:"expiry_year"`
-	Cvv         string  `json:"cvv"`
+	Reference   string       `json:"reference"`
+	Amount      models.Money `json:"amount"`
+	Currency    string       `json:"currency"`
+	CardToken   string       `json:"-"`
+	CardNumber  string       `json:"card_number"`
+	ExpiryMonth string       `json:"expiry_month"`
+	ExpiryYear  string       `json:"expiry_year"`
+	Cvv         string       `json:"cvv"`
 }
 
 // RefundRequest represents a refund request sent to the acquiring bank.
+// The reference identifies the refund at the bank, like the reference of a payment request.
 type RefundRequest struct {
-	Amount float64 `json:"amount"`
-	Reason string  `json:"card_number"`
+	Reference string       `json:"reference"`
+	Amount    models.Money `json:"amount"`
+	Currency  string       `json:"currency"`
+	Reason    string       `json:"card_number"`
+}
+
+// CaptureRequest represents a capture request for a previously authorized payment sent to the acquiring bank.
+// The reference identifies the capture at the bank, like the reference of a payment request.
+type CaptureRequest struct {
+	Reference         string       `json:"reference"`
+	AuthorizationCode string       `json:"authorization_code"`
+	Amount            models.Money `json:"amount"`
+	Currency          string       `json:"currency"`
+}
+
+// VoidRequest represents a request to release the hold of a previously authorized payment sent to the acquiring bank.
+// The reference identifies the void at the bank, like the reference of a payment request.
+type VoidRequest struct {
+	Reference         string `json:"reference"`
+	AuthorizationCode string `json:"authorization_code"`
+}
+
+// StatusRequest represents a request for the outcome of the transaction the acquiring bank received with a reference.
+type StatusRequest struct {
+	Reference string `json:"reference"`
+}
+
+// Operations reported by the acquiring bank for the transactions it received.
+const (
+	OperationProcess   = "process"
+	OperationAuthorize = "authorize"
+	OperationCapture   = "capture"
+	OperationVoid      = "void"
+	OperationRefund    = "refund"
+)
+
+// StatusResponse represents the outcome of a transaction reported by the acquiring bank. Found is false when the
+// bank never received a transaction with the reference, and Operation tells which kind of transaction it was.
+type StatusResponse struct {
+	PaymentResponse
+	Found     bool   `json:"found"`
+	Operation string `json:"operation,omitempty"`
 }
 
 // PaymentResponse represents the response received from the acquiring bank for a payment or refund request.
 type PaymentResponse struct {
-	Success   bool   `json:"success"`
-	Message   string `json:"message"`
-	Processor string `json:"processor"`
+	Success           bool   `json:"success"`
+	Message           string `json:"message"`
+	Processor         string `json:"processor"`
+	AuthorizationCode string `json:"authorization_code,omitempty"`
+}
+
+// Detokenizer resolves the card number stored behind a card token.
+type Detokenizer interface {
+	Detokenize(token string) (string, error)
+}
+
+// Acquirer processes card transactions with an acquiring bank.
+type Acquirer interface {
+	// ProcessPayment charges a payment in a single step.
+	ProcessPayment(request PaymentRequest) (PaymentResponse, error)
+
+	// AuthorizePayment holds the funds of a payment until it is captured or voided.
+	AuthorizePayment(request PaymentRequest) (PaymentResponse, error)
+
+	// CapturePayment charges all or part of an authorized payment, releasing the remainder.
+	CapturePayment(request CaptureRequest) (PaymentResponse, error)
+
+	// VoidPayment releases the hold of an authorized payment.
+	VoidPayment(request VoidRequest) (PaymentResponse, error)
+
+	// ProcessRefund returns funds of a charged payment.
+	ProcessRefund(request RefundRequest) (PaymentResponse, error)
+
+	// GetTransactionStatus reports the outcome of the payment, capture, void or refund the bank received with a
+	// reference.
+	GetTransactionStatus(request StatusRequest) (StatusResponse, error)
 }
 
 // AcquiringBank manages interactions with the acquiring bank's API.
+// Calls time out, are retried with exponential backoff when it is safe to do so, and stop being made
+// while the circuit breaker of the bank is open.
 type AcquiringBank struct {
-	config config.Application
-	logger *slog.Logger
+	host         string
+	client       *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	breaker      *CircuitBreaker
+	cards        Detokenizer
+	logger       *slog.Logger
+}
+
+// NewAdquiringBank creates a new instance of AcquiringBank for the bank simulator host of the provided configuration.
+func NewAdquiringBank(config config.Application, cards Detokenizer, logger *slog.Logger) *AcquiringBank {
+	return NewAcquiringBankWithHost(config, config.BankSimulatorHost, cards, logger)
 }
 
-// NewAdquiringBank creates a new instance of AcquiringBank with the provided configuration.
-func NewAdquiringBank(config config.Application, logger *slog.Logger) AcquiringBank {
-	return AcquiringBank{
-		config: config,
-		logger: logger,
+// NewAcquiringBankWithHost creates a new instance of AcquiringBank for the API at the provided host,
+// using the bank parameters of the provided configuration and resolving card tokens with the given detokenizer.
+func NewAcquiringBankWithHost(config config.Application, host string, cards Detokenizer, logger *slog.Logger) *AcquiringBank {
+	return &AcquiringBank{
+		host:         host,
+		client:       &http.Client{Timeout: config.Bank.Timeout},
+		maxRetries:   config.Bank.MaxRetries,
+		retryBackoff: config.Bank.RetryBackoff,
+		breaker:      NewCircuitBreaker(config.Bank.BreakerThreshold, config.Bank.BreakerTimeout),
+		cards:        cards,
+		logger:       logger,
 	}
 }
 
@@ -51,62 +162,152 @@ func NewAdquiringBank(config config.Application, logger *slog.Logger) AcquiringB
 func (a *AcquiringBank) ProcessPayment(request PaymentRequest) (PaymentResponse, error) {
 	a.logger.Info("Proccesing payment with bank")
 
-	payloadBytes, err := json.Marshal(request)
+	request, err := a.resolveCard(request)
 	if err != nil {
-		a.logger.Error(err.Error())
 		return PaymentResponse{}, err
 	}
+	var response PaymentResponse
+	err = a.send("/process", request, &response, false)
+	return response, err
+}
 
-	resp, err := http.Post(a.config.BankSimulatorHost+"/process", "application/json", bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		a.logger.Error(err.Error())
-		return PaymentResponse{}, err
-	}
-	defer resp.Body.Close()
+// AuthorizePayment sends an authorization request to the acquiring bank's API, placing a hold on the funds
+// without charging them, and returns the response.
+func (a *AcquiringBank) AuthorizePayment(request PaymentRequest) (PaymentResponse, error) {
+	a.logger.Info("Authorizing payment with bank")
 
-	responseBody, err := io.ReadAll(resp.Body)
+	request, err := a.resolveCard(request)
 	if err != nil {
-		a.logger.Error(err.Error())
 		return PaymentResponse{}, err
 	}
+	var response PaymentResponse
+	err = a.send("/authorize", request, &response, false)
+	return response, err
+}
+
+// CapturePayment sends a capture request for a previously authorized payment to the acquiring bank's API.
+// The bank releases any authorized amount that is not captured.
+func (a *AcquiringBank) CapturePayment(request CaptureRequest) (PaymentResponse, error) {
+	a.logger.Info("Capturing payment with bank")
 
+	// the bank answers a capture repeating the reference of a received one with its outcome, so it is not captured twice
 	var response PaymentResponse
-	if err := json.Unmarshal(responseBody, &response); err != nil {
-		a.logger.Error(err.Error())
-		return PaymentResponse{}, err
-	}
+	err := a.send("/capture", request, &response, true)
+	return response, err
+}
+
+// VoidPayment sends a void request for a previously authorized payment to the acquiring bank's API,
+// releasing the full hold without capturing any funds.
+func (a *AcquiringBank) VoidPayment(request VoidRequest) (PaymentResponse, error) {
+	a.logger.Info("Voiding payment with bank")
 
-	return response, nil
+	// the bank answers a void repeating the reference of a received one with its outcome
+	var response PaymentResponse
+	err := a.send("/void", request, &response, true)
+	return response, err
 }
 
 // ProcessRefund sends a refund request to the acquiring bank's API and returns the response.
 func (a *AcquiringBank) ProcessRefund(request RefundRequest) (PaymentResponse, error) {
 	a.logger.Info("Processing refund with bank")
 
+	var response PaymentResponse
+	err := a.send("/refund", request, &response, false)
+	return response, err
+}
+
+// GetTransactionStatus asks the acquiring bank's API for the outcome of the transaction it received with the
+// reference of the request.
+func (a *AcquiringBank) GetTransactionStatus(request StatusRequest) (StatusResponse, error) {
+	a.logger.Info("Getting transaction status from bank")
+
+	// asking for the status changes nothing at the bank, so it is always safe to repeat
+	var response StatusResponse
+	err := a.send("/status", request, &response, true)
+	return response, err
+}
+
+// resolveCard fills the card number of the request from its card token.
+func (a *AcquiringBank) resolveCard(request PaymentRequest) (PaymentRequest, error) {
+	if request.CardToken == "" {
+		return request, nil
+	}
+
+	cardNumber, err := a.cards.Detokenize(request.CardToken)
+	if err != nil {
+		a.logger.Error(err.Error())
+		return PaymentRequest{}, err
+	}
+	request.CardNumber = cardNumber
+	return request, nil
+}
+
+// send posts the JSON encoded request to the given path of the acquiring bank's API and decodes the response into
+// the given value. Requests that never reached the bank are always retried, while requests whose outcome is unknown
+// are only retried when the operation is idempotent.
+func (a *AcquiringBank) send(path string, request interface{}, response interface{}, idempotent bool) error {
+	if !a.breaker.Allow() {
+		a.logger.Error(ErrCircuitOpen.Error(), slog.String("host", a.host))
+		return ErrCircuitOpen
+	}
+
 	payloadBytes, err := json.Marshal(request)
 	if err != nil {
 		a.logger.Error(err.Error())
-		return PaymentResponse{}, err
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var notSent bool
+		notSent, err = a.post(path, payloadBytes, response)
+		if err == nil || attempt >= a.maxRetries || !(notSent || (idempotent && errors.Is(err, ErrBankUnavailable))) {
+			break
+		}
+
+		backoff := a.retryBackoff * time.Duration(1<<attempt)
+		a.logger.Warn("Retrying bank request", slog.String("error", err.Error()), slog.Duration("backoff", backoff))
+		time.Sleep(backoff)
+	}
+
+	if errors.Is(err, ErrBankUnavailable) {
+		a.breaker.Failure()
+	} else {
+		a.breaker.Success()
 	}
 
-	resp, err := http.Post(a.config.BankSimulatorHost+"/refund", "application/json", bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		a.logger.Error(err.Error())
-		return PaymentResponse{}, err
+		return err
+	}
+	return nil
+}
+
+// post makes a single call to the acquiring bank's API, decoding its response into the given value. It reports
+// whether the request failed before reaching the bank, which makes it safe to retry.
+func (a *AcquiringBank) post(path string, payload []byte, response interface{}) (bool, error) {
+	resp, err := a.client.Post(a.host+path, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		var opErr *net.OpError
+		notSent := errors.As(err, &opErr) && opErr.Op == "dial"
+		return notSent, fmt.Errorf("%w: %v", ErrBankUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		a.logger.Error(err.Error())
-		return PaymentResponse{}, err
+		return false, fmt.Errorf("%w: %v", ErrBankUnavailable, err)
 	}
 
-	var response PaymentResponse
-	if err := json.Unmarshal(responseBody, &response); err != nil {
-		a.logger.Error(err.Error())
-		return PaymentResponse{}, err
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return false, fmt.Errorf("%w: status %d", ErrBankUnavailable, resp.StatusCode)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return false, fmt.Errorf("%w: status %d", ErrBankRejected, resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(responseBody, response); err != nil {
+		return false, err
 	}
 
-	return response, nil
+	return false, nil
 }
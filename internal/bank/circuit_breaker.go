@@ -0,0 +1,82 @@
+package bank
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState represents the state of a circuit breaker.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker stops calls to an acquiring bank after too many consecutive failures.
+// Once open it rejects every call until the open timeout elapses, then lets a single trial call through:
+// a success closes the breaker again and a failure opens it for another timeout.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	state            breakerState
+	failures         int
+	failureThreshold int
+	openTimeout      time.Duration
+	openedAt         time.Time
+	now              func() time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker that opens after the given number of consecutive failures.
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+	}
+}
+
+// Allow reports whether a call can be made. A disabled breaker, with no failure threshold, allows every call.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// only the trial call is allowed until it reports its outcome
+		return false
+	default:
+		return true
+	}
+}
+
+// Success records a successful call, closing the breaker.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// Failure records a failed call, opening the breaker when the trial call fails or the threshold is reached.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failureThreshold <= 0 {
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.failureThreshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
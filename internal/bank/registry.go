@@ -0,0 +1,98 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// ErrUnknownProcessor is returned when a processor name is not registered.
+var ErrUnknownProcessor = errors.New("unknown processor")
+
+// RouteRequest contains the details of a payment used to choose its processor.
+type RouteRequest struct {
+	MerchantID uint
+	CardBrand  string
+	Amount     models.Money
+	// Processor is the processor explicitly requested by the merchant, if any.
+	Processor string
+}
+
+// Registry keeps the named acquirers the gateway can send payments to.
+type Registry struct {
+	acquirers        map[string]Acquirer
+	defaultProcessor string
+	logger           *slog.Logger
+}
+
+// NewRegistry creates a registry with the default processor pointing to the bank simulator host and every
+// additional processor of the provided configuration, each one with its own circuit breaker.
+// Card tokens of payment requests are resolved with the given detokenizer.
+func NewRegistry(config config.Application, cards Detokenizer, logger *slog.Logger) *Registry {
+	registry := &Registry{
+		acquirers:        map[string]Acquirer{},
+		defaultProcessor: config.DefaultProcessor,
+		logger:           logger,
+	}
+
+	registry.Register(config.DefaultProcessor, NewAdquiringBank(config, cards, logger))
+	for name, host := range config.Processors {
+		registry.Register(name, NewAcquiringBankWithHost(config, host, cards, logger))
+	}
+
+	return registry
+}
+
+// Register adds an acquirer to the registry under the given name, replacing any previous one.
+func (r *Registry) Register(name string, acquirer Acquirer) {
+	r.acquirers[name] = acquirer
+}
+
+// Get returns the acquirer registered under the given name. An empty name returns the default processor,
+// which handled every payment made before processors were stored.
+func (r *Registry) Get(name string) (Acquirer, error) {
+	if name == "" {
+		name = r.defaultProcessor
+	}
+	acquirer, ok := r.acquirers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProcessor, name)
+	}
+	return acquirer, nil
+}
+
+// Route chooses the processor of a payment. A processor explicitly requested is used as is, otherwise the
+// matching rule with the lowest priority wins, falling back to the default processor when none matches.
+func (r *Registry) Route(rules []models.RoutingRule, request RouteRequest) (string, Acquirer, error) {
+	name := request.Processor
+	if name == "" {
+		name = r.match(rules, request)
+	}
+
+	acquirer, err := r.Get(name)
+	if err != nil {
+		r.logger.Error(err.Error())
+		return "", nil, err
+	}
+	return name, acquirer, nil
+}
+
+// match returns the processor of the first matching rule, in priority order, or the default processor.
+func (r *Registry) match(rules []models.RoutingRule, request RouteRequest) string {
+	sorted := make([]models.RoutingRule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	for _, rule := range sorted {
+		if rule.Matches(request.MerchantID, request.CardBrand, request.Amount) {
+			return rule.Processor
+		}
+	}
+	return r.defaultProcessor
+}
@@ -2,6 +2,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/caarlos0/env/v10"
 )
 
@@ -12,12 +14,123 @@ const (
 
 // Application contains data related to application configuration parameters.
 type Application struct {
-	DryRun            bool   `env:"DRY_RUN" envDefault:"false"`
-	ApplicationPort   string `env:"APPLICATION_PORT" envDefault:":8080"`
-	BankSimulatorHost string `env:"BANK_SIMULATOR_HOST" envDefault:"http://bank-simulator:8090/payment"`
-	LogLevel          string `env:"LOG_ENVIRONMENT" envDefault:"development"`
-	SecretKey         string `env:"SECRET_KEY" envDefault:"123456"`
+	DryRun            bool              `env:"DRY_RUN" envDefault:"false"`
+	ApplicationPort   string            `env:"APPLICATION_PORT" envDefault:":8080"`
+	BankSimulatorHost string            `env:"BANK_SIMULATOR_HOST" envDefault:"http://bank-simulator:8090/payment"`
+	DefaultProcessor  string            `env:"DEFAULT_PROCESSOR" envDefault:"awesome-bank"`
+	Processors        map[string]string `env:"PROCESSORS" envSeparator:"," envKeyValSeparator:"="`
+	LogLevel          string            `env:"LOG_ENVIRONMENT" envDefault:"development"`
+	Bank              BankParameters
+	Token             TokenParameters
 	Repository        RepositoryParameters
+	Vault             VaultParameters
+	RateLimit         RateLimitParameters
+	Messaging         MessagingParameters
+	Outbox            OutboxParameters
+	Webhook           WebhookParameters
+	Idempotency       IdempotencyParameters
+	Reconciliation    ReconciliationParameters
+}
+
+// BankParameters contains data related to the resilience of the calls to the acquiring banks.
+type BankParameters struct {
+	Timeout          time.Duration `env:"BANK_TIMEOUT" envDefault:"10s"`
+	MaxRetries       int           `env:"BANK_MAX_RETRIES" envDefault:"2"`
+	RetryBackoff     time.Duration `env:"BANK_RETRY_BACKOFF" envDefault:"200ms"`
+	BreakerThreshold int           `env:"BANK_BREAKER_THRESHOLD" envDefault:"5"`
+	BreakerTimeout   time.Duration `env:"BANK_BREAKER_TIMEOUT" envDefault:"30s"`
+}
+
+// TokenParameters contains data related to the validation of the JWTs of the identity provider.
+// Keys are loaded from the JWKS at KeySetSource, a local file path or an http(s) URL, and only the listed
+// asymmetric algorithms are accepted.
+type TokenParameters struct {
+	KeySetSource    string        `env:"JWKS_SOURCE" envDefault:"/etc/gateway/jwks.json"`
+	RefreshInterval time.Duration `env:"JWKS_REFRESH_INTERVAL" envDefault:"15m"`
+	Algorithms      []string      `env:"TOKEN_ALGORITHMS" envSeparator:"," envDefault:"RS256,ES256"`
+	Issuer          string        `env:"TOKEN_ISSUER"`
+	Audience        string        `env:"TOKEN_AUDIENCE"`
+}
+
+// VaultParameters contains data related to the card vault.
+// Keys maps each key-encryption key ID to a hex encoded 256-bit key, and ActiveKey is the ID used to encrypt.
+// FingerprintKey is the hex encoded key used to fingerprint card numbers, which must not change on rotations.
+type VaultParameters struct {
+	Keys           map[string]string `env:"VAULT_KEYS" envSeparator:"," envKeyValSeparator:"="`
+	ActiveKey      string            `env:"VAULT_ACTIVE_KEY"`
+	FingerprintKey string            `env:"VAULT_FINGERPRINT_KEY"`
+}
+
+// RateLimitParameters contains the default requests per minute allowed to a merchant on the payment routes and
+// on the read routes, used for merchants without their own limits.
+type RateLimitParameters struct {
+	PaymentsPerMinute int `env:"RATE_LIMIT_PAYMENTS_PER_MINUTE" envDefault:"60"`
+	ReadsPerMinute    int `env:"RATE_LIMIT_READS_PER_MINUTE" envDefault:"300"`
+}
+
+// MessagingParameters contains data related to the delivery of the domain events to their subscribers.
+// Undelivered messages are polled every PollInterval and claimed for Lease while they are delivered, and failed
+// deliveries are retried after a backoff doubling from RetryBackoff up to MaxBackoff.
+type MessagingParameters struct {
+	Workers      int           `env:"MESSAGING_WORKERS" envDefault:"4"`
+	BufferSize   int           `env:"MESSAGING_BUFFER_SIZE" envDefault:"256"`
+	PollInterval time.Duration `env:"MESSAGING_POLL_INTERVAL" envDefault:"5s"`
+	Lease        time.Duration `env:"MESSAGING_LEASE" envDefault:"1m"`
+	RetryBackoff time.Duration `env:"MESSAGING_RETRY_BACKOFF" envDefault:"1s"`
+	MaxBackoff   time.Duration `env:"MESSAGING_MAX_BACKOFF" envDefault:"1h"`
+}
+
+// OutboxParameters contains data related to the relay of the outbox to the message queue.
+// Unsent entries are relayed every RelayInterval, BatchSize at a time, and claimed for Lease while they are
+// published so that several gateways do not relay the same entries. Every CleanupInterval the outbox entries and
+// messages that were sent and delivered longer than Retention ago are removed.
+type OutboxParameters struct {
+	RelayInterval   time.Duration `env:"OUTBOX_RELAY_INTERVAL" envDefault:"1s"`
+	BatchSize       int           `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+	Lease           time.Duration `env:"OUTBOX_LEASE" envDefault:"30s"`
+	CleanupInterval time.Duration `env:"OUTBOX_CLEANUP_INTERVAL" envDefault:"1h"`
+	Retention       time.Duration `env:"OUTBOX_RETENTION" envDefault:"168h"`
+}
+
+// WebhookParameters contains data related to the delivery of the events to the webhook endpoints of the merchants.
+// Pending deliveries are polled every PollInterval, BatchSize at a time, and claimed for Lease while Workers send
+// them with the given Timeout. Failed attempts are retried after a backoff doubling from RetryBackoff up to
+// MaxBackoff until MaxAttempts were made. Endpoints must use HTTPS unless AllowHTTP is set, and resolve to public
+// addresses unless AllowPrivateAddresses is set, which is meant for local development only. When a merchant rotates
+// its signing secret, the previous secrets keep signing the requests for SecretOverlap unless it asks otherwise.
+type WebhookParameters struct {
+	Workers       int           `env:"WEBHOOK_WORKERS" envDefault:"4"`
+	BatchSize     int           `env:"WEBHOOK_BATCH_SIZE" envDefault:"100"`
+	PollInterval  time.Duration `env:"WEBHOOK_POLL_INTERVAL" envDefault:"5s"`
+	Lease         time.Duration `env:"WEBHOOK_LEASE" envDefault:"1m"`
+	Timeout       time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	MaxAttempts   int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"10"`
+	RetryBackoff  time.Duration `env:"WEBHOOK_RETRY_BACKOFF" envDefault:"30s"`
+	MaxBackoff    time.Duration `env:"WEBHOOK_MAX_BACKOFF" envDefault:"6h"`
+	AllowHTTP     bool          `env:"WEBHOOK_ALLOW_HTTP" envDefault:"false"`
+	SecretOverlap time.Duration `env:"WEBHOOK_SECRET_OVERLAP" envDefault:"24h"`
+
+	AllowPrivateAddresses bool `env:"WEBHOOK_ALLOW_PRIVATE_ADDRESSES" envDefault:"false"`
+}
+
+// IdempotencyParameters contains data related to the idempotency keys of the merchants.
+// A request holds its key while it runs, renewing its lock every third of LockTimeout, and a retry can take the key
+// over once the lock was not renewed for LockTimeout, when the request stopped without completing. Keys are removed
+// TTL after they were created, every CleanupInterval.
+type IdempotencyParameters struct {
+	LockTimeout     time.Duration `env:"IDEMPOTENCY_LOCK_TIMEOUT" envDefault:"2m"`
+	TTL             time.Duration `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+	CleanupInterval time.Duration `env:"IDEMPOTENCY_CLEANUP_INTERVAL" envDefault:"1h"`
+}
+
+// ReconciliationParameters contains data related to the reconciliation of the payments and refunds left pending
+// when the outcome at the acquiring bank was unknown. Every Interval, the ones pending for longer than GracePeriod
+// are settled with the outcome reported by the bank, BatchSize at a time. The grace period must be longer than the
+// bank calls of a request with their retries.
+type ReconciliationParameters struct {
+	Interval    time.Duration `env:"RECONCILIATION_INTERVAL" envDefault:"1m"`
+	GracePeriod time.Duration `env:"RECONCILIATION_GRACE_PERIOD" envDefault:"5m"`
+	BatchSize   int           `env:"RECONCILIATION_BATCH_SIZE" envDefault:"100"`
 }
 
 // RepositoryParameters contains data related to a repository.
@@ -40,5 +153,50 @@ func Load() (Application, error) {
 		return cfg, err
 	}
 	cfg.Repository = repository
+	bank := BankParameters{}
+	if err := env.Parse(&bank); err != nil {
+		return cfg, err
+	}
+	cfg.Bank = bank
+	token := TokenParameters{}
+	if err := env.Parse(&token); err != nil {
+		return cfg, err
+	}
+	cfg.Token = token
+	vault := VaultParameters{}
+	if err := env.Parse(&vault); err != nil {
+		return cfg, err
+	}
+	cfg.Vault = vault
+	rateLimit := RateLimitParameters{}
+	if err := env.Parse(&rateLimit); err != nil {
+		return cfg, err
+	}
+	cfg.RateLimit = rateLimit
+	messaging := MessagingParameters{}
+	if err := env.Parse(&messaging); err != nil {
+		return cfg, err
+	}
+	cfg.Messaging = messaging
+	outbox := OutboxParameters{}
+	if err := env.Parse(&outbox); err != nil {
+		return cfg, err
+	}
+	cfg.Outbox = outbox
+	webhook := WebhookParameters{}
+	if err := env.Parse(&webhook); err != nil {
+		return cfg, err
+	}
+	cfg.Webhook = webhook
+	idempotency := IdempotencyParameters{}
+	if err := env.Parse(&idempotency); err != nil {
+		return cfg, err
+	}
+	cfg.Idempotency = idempotency
+	reconciliation := ReconciliationParameters{}
+	if err := env.Parse(&reconciliation); err != nil {
+		return cfg, err
+	}
+	cfg.Reconciliation = reconciliation
 	return cfg, nil
 }
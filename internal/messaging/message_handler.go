@@ -1 +1,17 @@
 package messaging
+
+// MessageHandler handles the messages of the event types it subscribed to.
+// Messages are delivered at least once, so handlers must tolerate receiving the same message again,
+// which they can recognize by its ID.
+type MessageHandler interface {
+	// Handle handles a message, returning an error to have it delivered again later.
+	Handle(message Message) error
+}
+
+// MessageHandlerFunc adapts a function to the MessageHandler interface.
+type MessageHandlerFunc func(message Message) error
+
+// Handle calls the function with the message.
+func (f MessageHandlerFunc) Handle(message Message) error {
+	return f(message)
+}
@@ -1 +1,269 @@
+// Package messaging provides the internal event bus, which delivers the domain events published by the handlers
+// to the subscribers of their type.
 package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// Define custom error messages
+var (
+	errHandlerPanicked = errors.New("message handler panicked")
+)
+
+// Message represents a published domain event stored in the database until it is delivered.
+// EventID is the ID of the outbox entry the event was relayed from, which identifies the event however many times
+// it is relayed, so that relaying an entry again does not store and deliver a second message.
+type Message struct {
+	ID            uint             `gorm:"primaryKey" json:"id"`
+	EventID       uint             `gorm:"not null;uniqueIndex" json:"event_id"`
+	Type          models.EventType `gorm:"not null;index" json:"type"`
+	MerchantID    uint             `gorm:"not null" json:"merchant_id"`
+	PaymentID     uint             `gorm:"not null;index" json:"payment_id"`
+	Payload       json.RawMessage  `gorm:"type:text;not null" json:"payload"`
+	Attempts      int              `gorm:"not null" json:"attempts"`
+	NextAttemptAt time.Time        `gorm:"not null;index:idx_messages_pending,priority:2" json:"next_attempt_at"`
+	DeliveredAt   *time.Time       `gorm:"index:idx_messages_pending,priority:1" json:"delivered_at"`
+	LastError     string           `json:"last_error"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+// TableName returns the table of the messages.
+func (Message) TableName() string {
+	return "messages"
+}
+
+// Decode unmarshals the payload of the message into the event of its type.
+func (m Message) Decode(event interface{}) error {
+	return json.Unmarshal(m.Payload, event)
+}
+
+// NewMessage creates the message of an event.
+func NewMessage(event models.Event) (Message, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Message{}, err
+	}
+
+	merchantID, paymentID := event.Subject()
+	return Message{
+		Type:       event.Type(),
+		MerchantID: merchantID,
+		PaymentID:  paymentID,
+		Payload:    payload,
+	}, nil
+}
+
+// MessageQueue publishes domain events and delivers them to the handlers subscribed to their type.
+type MessageQueue interface {
+	// PublishMessage publishes an event encoded in a message relayed from the outbox, which is delivered at least
+	// once to every handler subscribed to its type. Publishing the message of an event again does nothing.
+	PublishMessage(message Message) error
+
+	// Subscribe subscribes a handler to the events of the given type.
+	Subscribe(eventType models.EventType, handler MessageHandler)
+}
+
+// InProcessQueue is a MessageQueue delivering events to handlers running in the gateway itself.
+// Messages are stored before they are delivered, and a message is delivered again after a backoff until every
+// handler subscribed to its type handled it, including messages left undelivered by a previous run.
+// The messages of a payment are always delivered by the same worker, so they are handled in the order they were
+// published unless one of them has to be delivered again.
+type InProcessQueue struct {
+	repository   MessageRepository
+	pollInterval time.Duration
+	lease        time.Duration
+	retryBackoff time.Duration
+	maxBackoff   time.Duration
+	logger       *slog.Logger
+
+	mu       sync.RWMutex
+	handlers map[models.EventType][]MessageHandler
+
+	partitions []chan Message
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewInProcessQueue creates a new instance of InProcessQueue with the provided repository and messaging configuration.
+func NewInProcessQueue(repository MessageRepository, config config.Application, logger *slog.Logger) *InProcessQueue {
+	partitions := make([]chan Message, config.Messaging.Workers)
+	for i := range partitions {
+		partitions[i] = make(chan Message, config.Messaging.BufferSize)
+	}
+	return &InProcessQueue{
+		repository:   repository,
+		pollInterval: config.Messaging.PollInterval,
+		lease:        config.Messaging.Lease,
+		retryBackoff: config.Messaging.RetryBackoff,
+		maxBackoff:   config.Messaging.MaxBackoff,
+		logger:       logger,
+		handlers:     map[models.EventType][]MessageHandler{},
+		partitions:   partitions,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Subscribe subscribes a handler to the events of the given type.
+func (q *InProcessQueue) Subscribe(eventType models.EventType, handler MessageHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[eventType] = append(q.handlers[eventType], handler)
+}
+
+// PublishMessage stores the message and hands it to the worker of its payment. When the worker is busy, the message
+// is delivered by the next poll once its lease expires. When the message of the event is already stored, it is
+// delivered by the poll like any other message and is not handed to the worker again.
+func (q *InProcessQueue) PublishMessage(message Message) error {
+	q.logger.Info("Publishing message", slog.String("type", string(message.Type)), slog.Uint64("event_id", uint64(message.EventID)))
+
+	message.NextAttemptAt = time.Now().Add(q.lease)
+	if err := q.repository.CreateMessage(&message); err != nil {
+		if errors.Is(err, ErrMessageExists) {
+			q.logger.Info("message was already published", slog.Uint64("event_id", uint64(message.EventID)))
+			return nil
+		}
+		q.logger.Error(err.Error())
+		return err
+	}
+
+	select {
+	case q.partition(message) <- message:
+	default:
+		q.logger.Warn("message queue is full, delivering the message later", slog.Uint64("message_id", uint64(message.ID)))
+	}
+	return nil
+}
+
+// Start starts the workers delivering the messages and the poll of the messages due for a new attempt.
+func (q *InProcessQueue) Start() {
+	q.logger.Info("Starting message queue", slog.Int("workers", len(q.partitions)))
+
+	for _, partition := range q.partitions {
+		q.wg.Add(1)
+		go q.work(partition)
+	}
+	q.wg.Add(1)
+	go q.poll()
+}
+
+// Stop stops the workers and the poll, waiting for the messages being delivered.
+// Messages not delivered yet are delivered after the next start.
+func (q *InProcessQueue) Stop() {
+	q.logger.Info("Stopping message queue")
+
+	close(q.stop)
+	q.wg.Wait()
+}
+
+// work delivers the messages of a partition until the queue is stopped.
+func (q *InProcessQueue) work(partition chan Message) {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case message := <-partition:
+			q.deliver(message)
+		}
+	}
+}
+
+// partition returns the partition of the worker delivering the messages of the payment of the message.
+func (q *InProcessQueue) partition(message Message) chan Message {
+	return q.partitions[message.PaymentID%uint(len(q.partitions))]
+}
+
+// poll periodically claims the messages due for a new attempt and hands them to the workers.
+func (q *InProcessQueue) poll() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+
+		messages, err := q.repository.ClaimMessages(q.lease, cap(q.partitions[0]))
+		if err != nil {
+			q.logger.Error(err.Error())
+			continue
+		}
+		for _, message := range messages {
+			select {
+			case <-q.stop:
+				return
+			case q.partition(message) <- message:
+			}
+		}
+	}
+}
+
+// deliver hands the message to every handler subscribed to its type. It is marked as delivered when all of them
+// handled it, and scheduled for a new attempt after an exponential backoff otherwise.
+func (q *InProcessQueue) deliver(message Message) {
+	q.mu.RLock()
+	handlers := q.handlers[message.Type]
+	q.mu.RUnlock()
+
+	var failures []error
+	for _, handler := range handlers {
+		if err := q.handle(handler, message); err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	if len(failures) == 0 {
+		if err := q.repository.MarkMessageDelivered(&message); err != nil {
+			q.logger.Error(err.Error())
+		}
+		return
+	}
+
+	err := errors.Join(failures...)
+	q.logger.Error(err.Error(), slog.Uint64("message_id", uint64(message.ID)), slog.Int("attempts", message.Attempts+1))
+
+	message.Attempts++
+	message.NextAttemptAt = time.Now().Add(q.backoff(message.Attempts))
+	message.LastError = err.Error()
+	if err := q.repository.RescheduleMessage(&message); err != nil {
+		q.logger.Error(err.Error())
+	}
+}
+
+// handle calls the handler with the message, reporting a panic of the handler as an error.
+func (q *InProcessQueue) handle(handler MessageHandler, message Message) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%w: %v", errHandlerPanicked, recovered)
+		}
+	}()
+	return handler.Handle(message)
+}
+
+// backoff returns the delay before the next attempt of a message that failed the given number of times,
+// doubling from the retry backoff up to the maximum backoff.
+func (q *InProcessQueue) backoff(attempts int) time.Duration {
+	delay := q.retryBackoff
+	for i := 1; i < attempts && delay < q.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.maxBackoff {
+		return q.maxBackoff
+	}
+	return delay
+}
@@ -1 +1,26 @@
 package messaging
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMessageExists is returned when the message of an event is already stored.
+var ErrMessageExists = errors.New("message of the event already exists")
+
+// MessageRepository defines the storage of the messages published to the queue, which keeps them until every
+// subscriber handled them so that they survive failures of the subscribers and restarts of the gateway.
+type MessageRepository interface {
+	// CreateMessage stores a new message, returning ErrMessageExists when the message of its event is already stored.
+	CreateMessage(message *Message) error
+
+	// ClaimMessages retrieves up to limit undelivered messages whose next attempt is due, and postpones their next
+	// attempt by the lease so that they are not claimed again while they are being delivered.
+	ClaimMessages(lease time.Duration, limit int) ([]Message, error)
+
+	// MarkMessageDelivered records that every subscriber handled the message.
+	MarkMessageDelivered(message *Message) error
+
+	// RescheduleMessage saves the attempts, next attempt and last error of a message that failed to be handled.
+	RescheduleMessage(message *Message) error
+}
@@ -0,0 +1,195 @@
+package messaging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// OutboxEntry represents a domain event stored in the outbox in the same transaction as the change it reports,
+// so that the event is not lost when the gateway stops before publishing it. Its ID identifies the event from then
+// on. ClaimedUntil is set while a relay is publishing the entry, so that other relays leave it alone.
+type OutboxEntry struct {
+	ID           uint             `gorm:"primaryKey"`
+	Type         models.EventType `gorm:"not null"`
+	MerchantID   uint             `gorm:"not null"`
+	PaymentID    uint             `gorm:"not null;index"`
+	Payload      json.RawMessage  `gorm:"type:text;not null"`
+	SentAt       *time.Time       `gorm:"index:idx_outbox_entries_unsent,priority:1"`
+	ClaimedUntil *time.Time       `gorm:"index:idx_outbox_entries_unsent,priority:2"`
+	CreatedAt    time.Time
+}
+
+// TableName returns the table of the outbox entries.
+func (OutboxEntry) TableName() string {
+	return "outbox_entries"
+}
+
+// NewOutboxEntry creates the outbox entry of an event.
+func NewOutboxEntry(event models.Event) (OutboxEntry, error) {
+	message, err := NewMessage(event)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+	return OutboxEntry{
+		Type:       message.Type,
+		MerchantID: message.MerchantID,
+		PaymentID:  message.PaymentID,
+		Payload:    message.Payload,
+	}, nil
+}
+
+// Message returns the message to publish for the outbox entry, identified by the ID of the entry.
+func (e OutboxEntry) Message() Message {
+	return Message{
+		EventID:    e.ID,
+		Type:       e.Type,
+		MerchantID: e.MerchantID,
+		PaymentID:  e.PaymentID,
+		Payload:    e.Payload,
+	}
+}
+
+// OutboxRepository defines the storage of the outbox entries.
+type OutboxRepository interface {
+	// ClaimOutboxEntries retrieves up to limit outbox entries not sent yet nor claimed by another relay, oldest
+	// first, and claims them for the lease so that other relays do not publish them at the same time.
+	ClaimOutboxEntries(lease time.Duration, limit int) ([]OutboxEntry, error)
+
+	// MarkOutboxEntrySent records that the outbox entry was published to the message queue.
+	MarkOutboxEntrySent(entry *OutboxEntry) error
+
+	// DeleteSentOutboxEntries removes the outbox entries sent before the given time, returning how many were removed.
+	DeleteSentOutboxEntries(before time.Time) (int64, error)
+
+	// DeleteDeliveredMessages removes the messages delivered before the given time, returning how many were removed.
+	DeleteDeliveredMessages(before time.Time) (int64, error)
+}
+
+// OutboxRelay publishes the outbox entries to the message queue and removes them once they are no longer needed.
+// Entries are published oldest first, and an entry that fails to be published holds back the later entries of the
+// same payment until their claim expires, so the events of a payment reach the queue in the order they happened.
+type OutboxRelay struct {
+	repository      OutboxRepository
+	queue           MessageQueue
+	interval        time.Duration
+	lease           time.Duration
+	batchSize       int
+	cleanupInterval time.Duration
+	retention       time.Duration
+	logger          *slog.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewOutboxRelay creates a new instance of OutboxRelay with the provided repository, message queue and outbox configuration.
+func NewOutboxRelay(repository OutboxRepository, queue MessageQueue, config config.Application, logger *slog.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		repository:      repository,
+		queue:           queue,
+		interval:        config.Outbox.RelayInterval,
+		lease:           config.Outbox.Lease,
+		batchSize:       config.Outbox.BatchSize,
+		cleanupInterval: config.Outbox.CleanupInterval,
+		retention:       config.Outbox.Retention,
+		logger:          logger,
+		stop:            make(chan struct{}),
+	}
+}
+
+// Start starts relaying the outbox entries and cleaning up the sent ones on schedule.
+func (r *OutboxRelay) Start() {
+	r.logger.Info("Starting outbox relay")
+
+	r.wg.Add(2)
+	go r.schedule(r.interval, r.relay)
+	go r.schedule(r.cleanupInterval, r.cleanup)
+}
+
+// Stop stops the relay, waiting for the entries being relayed.
+func (r *OutboxRelay) Stop() {
+	r.logger.Info("Stopping outbox relay")
+
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// schedule runs the task every interval until the relay is stopped.
+func (r *OutboxRelay) schedule(interval time.Duration, task func()) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			task()
+		}
+	}
+}
+
+// relay publishes the unsent outbox entries, batch after batch until the outbox is drained.
+func (r *OutboxRelay) relay() {
+	for {
+		entries, err := r.repository.ClaimOutboxEntries(r.lease, r.batchSize)
+		if err != nil {
+			r.logger.Error(err.Error())
+			return
+		}
+
+		held := map[uint]bool{}
+		for i := range entries {
+			if held[entries[i].PaymentID] {
+				continue
+			}
+			if err := r.send(&entries[i]); err != nil {
+				r.logger.Error(err.Error(), slog.Uint64("outbox_entry_id", uint64(entries[i].ID)))
+				held[entries[i].PaymentID] = true
+			}
+		}
+
+		if len(entries) < r.batchSize || len(held) > 0 {
+			return
+		}
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+	}
+}
+
+// send publishes an outbox entry and marks it as sent. When the gateway stops in between, the entry is published
+// again once its claim expires, and the queue recognizes its event and does not store a second message.
+func (r *OutboxRelay) send(entry *OutboxEntry) error {
+	if err := r.queue.PublishMessage(entry.Message()); err != nil {
+		return err
+	}
+	return r.repository.MarkOutboxEntrySent(entry)
+}
+
+// cleanup removes the outbox entries and the messages that were sent and delivered longer than the retention ago.
+func (r *OutboxRelay) cleanup() {
+	before := time.Now().Add(-r.retention)
+
+	entries, err := r.repository.DeleteSentOutboxEntries(before)
+	if err != nil {
+		r.logger.Error(err.Error())
+		return
+	}
+	messages, err := r.repository.DeleteDeliveredMessages(before)
+	if err != nil {
+		r.logger.Error(err.Error())
+		return
+	}
+
+	r.logger.Info("Outbox cleaned up", slog.Int64("outbox_entries", entries), slog.Int64("messages", messages))
+}
@@ -6,14 +6,21 @@ import (
 )
 
 // CreditCard represents a credit card entity stored in the database.
+// The card number is kept in the card vault behind the token, and the fingerprint identifies the same card
+// number across the saved cards of a customer. Cards belong to the merchant of their customer.
+// A customer has a single saved card per card number, and ActiveFingerprint is the fingerprint of cards that are not
+// deleted, generated by the database to enforce it.
 type CreditCard struct {
-	gorm.Model             // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
-	Token           string `gorm:"not null" json:"token" validate:"required"`
-	ExpirationMonth string `gorm:"not null" json:"expiration_date" validate:"required"`
-	ExpirationYear  string `gorm:"not null" json:"expiration_year" validate:"required"`
-	CardHolder      string `gorm:"not null" json:"card_holder" validate:"required"`
-	CardType        string `gorm:"not null" json:"card_type" validate:"required"`
-	CardBrand       string `gorm:"not null" json:"card_brand" validate:"required"`
-	LastFour        string `gorm:"not null" json:"last_four" validate:"required"`
-	CustomerID      uint   `gorm:"not null" json:"customer_id" validate:"required"`
+	gorm.Model                // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	Token             string  `gorm:"not null" json:"token" validate:"required"`
+	ExpirationMonth   string  `gorm:"not null" json:"expiration_date" validate:"required"`
+	ExpirationYear    string  `gorm:"not null" json:"expiration_year" validate:"required"`
+	CardHolder        string  `gorm:"not null" json:"card_holder" validate:"required"`
+	CardType          string  `gorm:"not null" json:"card_type" validate:"required"`
+	CardBrand         string  `gorm:"not null" json:"card_brand" validate:"required"`
+	LastFour          string  `gorm:"not null" json:"last_four" validate:"required"`
+	MerchantID        uint    `gorm:"not null;index;uniqueIndex:idx_credit_cards_customer_active_fingerprint,priority:1" json:"-"`
+	CustomerID        uint    `gorm:"not null;index:idx_customer_fingerprint;uniqueIndex:idx_credit_cards_customer_active_fingerprint,priority:2" json:"customer_id" validate:"required"`
+	Fingerprint       string  `gorm:"not null;index:idx_customer_fingerprint" json:"-"`
+	ActiveFingerprint *string `gorm:"->;uniqueIndex:idx_credit_cards_customer_active_fingerprint,priority:3" json:"-"`
 }
@@ -0,0 +1,70 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedCurrency is returned for currencies that are not ISO 4217 codes known by the gateway.
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// currencyExponents maps ISO 4217 currency codes to the number of decimal digits of their minor unit.
+var currencyExponents = map[string]int{
+	"ARS": 2,
+	"AUD": 2,
+	"BHD": 3,
+	"BRL": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CLP": 0,
+	"CNY": 2,
+	"COP": 2,
+	"CRC": 2,
+	"DOP": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"GTQ": 2,
+	"HNL": 2,
+	"INR": 2,
+	"IQD": 3,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"LYD": 3,
+	"MXN": 2,
+	"NIO": 2,
+	"OMR": 3,
+	"PAB": 2,
+	"PEN": 2,
+	"PYG": 0,
+	"TND": 3,
+	"USD": 2,
+	"UYU": 2,
+	"VND": 0,
+}
+
+// CurrencyExponent returns the number of decimal digits of the minor unit of an ISO 4217 currency.
+func CurrencyExponent(currency string) (int, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+	return exponent, nil
+}
+
+// NormalizeCurrency upper-cases a currency code, defaulting to DefaultCurrency when empty,
+// and checks that it is supported.
+func NormalizeCurrency(currency string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	if code == "" {
+		code = DefaultCurrency
+	}
+	if _, err := CurrencyExponent(code); err != nil {
+		return "", err
+	}
+	return code, nil
+}
@@ -6,8 +6,10 @@ import (
 )
 
 // Customer represents a customer entity stored in the database.
+// Customers belong to the merchant that created them, and are not found by other merchants.
 type Customer struct {
 	gorm.Model        // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	MerchantID uint   `gorm:"not null;index" json:"-"`
 	Name       string `gorm:"not null" json:"name" validate:"required"`
 	Email      string `gorm:"not null" json:"email" validate:"required"`
 }
@@ -0,0 +1,385 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventType identifies a domain event of the gateway.
+type EventType string
+
+// Types of the domain events published by the gateway.
+const (
+	EventPaymentSucceeded  EventType = "payment.succeeded"
+	EventPaymentFailed     EventType = "payment.failed"
+	EventPaymentAuthorized EventType = "payment.authorized"
+	EventPaymentCancelled  EventType = "payment.cancelled"
+	EventRefundCreated     EventType = "refund.created"
+	EventRefundSettled     EventType = "refund.settled"
+)
+
+// EventTypes lists every type of domain event.
+var EventTypes = []EventType{
+	EventPaymentSucceeded,
+	EventPaymentFailed,
+	EventPaymentAuthorized,
+	EventPaymentCancelled,
+	EventRefundCreated,
+	EventRefundSettled,
+}
+
+// Event is a domain event published when a payment or a refund changes.
+type Event interface {
+	// Type returns the type of the event.
+	Type() EventType
+
+	// Subject returns the merchant and the payment the event is about.
+	Subject() (merchantID uint, paymentID uint)
+}
+
+// PaymentSucceeded is published when the acquiring bank approves a payment, or captures an authorized one.
+type PaymentSucceeded struct {
+	PaymentID  uint          `json:"payment_id"`
+	MerchantID uint          `json:"merchant_id"`
+	OrderToken string        `json:"order_token"`
+	Amount     Money         `json:"amount"`
+	Currency   string        `json:"currency"`
+	Status     PaymentStatus `json:"status"`
+	Processor  string        `json:"processor"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// PaymentFailed is published when the acquiring bank declines a payment.
+type PaymentFailed struct {
+	PaymentID  uint          `json:"payment_id"`
+	MerchantID uint          `json:"merchant_id"`
+	OrderToken string        `json:"order_token"`
+	Amount     Money         `json:"amount"`
+	Currency   string        `json:"currency"`
+	Status     PaymentStatus `json:"status"`
+	Processor  string        `json:"processor"`
+	Reason     string        `json:"reason"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// PaymentAuthorized is published when the acquiring bank holds the amount of a payment until it is captured.
+type PaymentAuthorized struct {
+	PaymentID  uint          `json:"payment_id"`
+	MerchantID uint          `json:"merchant_id"`
+	OrderToken string        `json:"order_token"`
+	Amount     Money         `json:"amount"`
+	Currency   string        `json:"currency"`
+	Status     PaymentStatus `json:"status"`
+	Processor  string        `json:"processor"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// PaymentCancelled is published when an authorized payment is cancelled and its hold released.
+type PaymentCancelled struct {
+	PaymentID  uint          `json:"payment_id"`
+	MerchantID uint          `json:"merchant_id"`
+	OrderToken string        `json:"order_token"`
+	Amount     Money         `json:"amount"`
+	Currency   string        `json:"currency"`
+	Status     PaymentStatus `json:"status"`
+	Processor  string        `json:"processor"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// RefundCreated is published when a refund of a payment is requested.
+type RefundCreated struct {
+	RefundID   uint         `json:"refund_id"`
+	PaymentID  uint         `json:"payment_id"`
+	MerchantID uint         `json:"merchant_id"`
+	Amount     Money        `json:"amount"`
+	Currency   string       `json:"currency"`
+	Reason     string       `json:"reason"`
+	Status     RefundStatus `json:"status"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// RefundSettled is published when the acquiring bank accepts or declines a refund, with the resulting status of
+// the payment.
+type RefundSettled struct {
+	RefundID      uint          `json:"refund_id"`
+	PaymentID     uint          `json:"payment_id"`
+	MerchantID    uint          `json:"merchant_id"`
+	Amount        Money         `json:"amount"`
+	Currency      string        `json:"currency"`
+	Reason        string        `json:"reason"`
+	Status        RefundStatus  `json:"status"`
+	PaymentStatus PaymentStatus `json:"payment_status"`
+	OccurredAt    time.Time     `json:"occurred_at"`
+}
+
+// NewPaymentSucceeded creates the event of a payment approved or captured by the acquiring bank.
+func NewPaymentSucceeded(payment Payment) PaymentSucceeded {
+	amount := payment.SettledAmount()
+	return PaymentSucceeded{
+		PaymentID:  payment.ID,
+		MerchantID: payment.MerchantID,
+		OrderToken: payment.OrderToken,
+		Amount:     amount,
+		Currency:   amount.CurrencyCode(),
+		Status:     payment.Status,
+		Processor:  payment.Processor,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// NewPaymentFailed creates the event of a payment declined by the acquiring bank, with the message of the bank
+// as the reason.
+func NewPaymentFailed(payment Payment) PaymentFailed {
+	return PaymentFailed{
+		PaymentID:  payment.ID,
+		MerchantID: payment.MerchantID,
+		OrderToken: payment.OrderToken,
+		Amount:     payment.Amount,
+		Currency:   payment.Amount.CurrencyCode(),
+		Status:     payment.Status,
+		Processor:  payment.Processor,
+		Reason:     payment.BankMessage,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// PaymentEvents returns the events of a payment that just moved to its current status.
+func PaymentEvents(payment Payment) []Event {
+	switch payment.Status {
+	case Succeeded, Processed:
+		return []Event{NewPaymentSucceeded(payment)}
+	case Failed:
+		return []Event{NewPaymentFailed(payment)}
+	case Authorized:
+		return []Event{NewPaymentAuthorized(payment)}
+	case Cancelled:
+		return []Event{NewPaymentCancelled(payment)}
+	default:
+		return nil
+	}
+}
+
+// PaymentTransitionEvents returns the events of a payment that just moved from the given status to its current
+// status. A payment moving back to authorized because its capture or void did not happen has no events, since it
+// was already authorized before.
+func PaymentTransitionEvents(payment Payment, from PaymentStatus) []Event {
+	if payment.Status == Authorized && (from == Capturing || from == Cancelling) {
+		return nil
+	}
+	return PaymentEvents(payment)
+}
+
+// NewPaymentAuthorized creates the event of a payment authorized by the acquiring bank.
+func NewPaymentAuthorized(payment Payment) PaymentAuthorized {
+	return PaymentAuthorized{
+		PaymentID:  payment.ID,
+		MerchantID: payment.MerchantID,
+		OrderToken: payment.OrderToken,
+		Amount:     payment.Amount,
+		Currency:   payment.Amount.CurrencyCode(),
+		Status:     payment.Status,
+		Processor:  payment.Processor,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// NewPaymentCancelled creates the event of an authorized payment that was cancelled.
+func NewPaymentCancelled(payment Payment) PaymentCancelled {
+	return PaymentCancelled{
+		PaymentID:  payment.ID,
+		MerchantID: payment.MerchantID,
+		OrderToken: payment.OrderToken,
+		Amount:     payment.Amount,
+		Currency:   payment.Amount.CurrencyCode(),
+		Status:     payment.Status,
+		Processor:  payment.Processor,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// NewRefundSettled creates the event of a refund settled by the acquiring bank for the payment.
+func NewRefundSettled(refund Refund, payment Payment) RefundSettled {
+	return RefundSettled{
+		RefundID:      refund.ID,
+		PaymentID:     refund.PaymentID,
+		MerchantID:    payment.MerchantID,
+		Amount:        refund.Amount,
+		Currency:      refund.Amount.CurrencyCode(),
+		Reason:        refund.Reason,
+		Status:        refund.Status,
+		PaymentStatus: payment.Status,
+		OccurredAt:    time.Now().UTC(),
+	}
+}
+
+// NewRefundCreated creates the event of a refund requested for a payment of the merchant.
+func NewRefundCreated(refund Refund, merchantID uint) RefundCreated {
+	return RefundCreated{
+		RefundID:   refund.ID,
+		PaymentID:  refund.PaymentID,
+		MerchantID: merchantID,
+		Amount:     refund.Amount,
+		Currency:   refund.Amount.CurrencyCode(),
+		Reason:     refund.Reason,
+		Status:     refund.Status,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// Type returns the type of the event.
+func (e PaymentSucceeded) Type() EventType {
+	return EventPaymentSucceeded
+}
+
+// Subject returns the merchant and the payment the event is about.
+func (e PaymentSucceeded) Subject() (uint, uint) {
+	return e.MerchantID, e.PaymentID
+}
+
+// UnmarshalJSON unmarshals the event, parsing its amount in its currency.
+func (e *PaymentSucceeded) UnmarshalJSON(data []byte) error {
+	type payload PaymentSucceeded
+	event := payload{}
+	if err := presetCurrency(data, &event.Amount); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	*e = PaymentSucceeded(event)
+	return nil
+}
+
+// Type returns the type of the event.
+func (e PaymentFailed) Type() EventType {
+	return EventPaymentFailed
+}
+
+// Subject returns the merchant and the payment the event is about.
+func (e PaymentFailed) Subject() (uint, uint) {
+	return e.MerchantID, e.PaymentID
+}
+
+// UnmarshalJSON unmarshals the event, parsing its amount in its currency.
+func (e *PaymentFailed) UnmarshalJSON(data []byte) error {
+	type payload PaymentFailed
+	event := payload{}
+	if err := presetCurrency(data, &event.Amount); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	*e = PaymentFailed(event)
+	return nil
+}
+
+// Type returns the type of the event.
+func (e PaymentAuthorized) Type() EventType {
+	return EventPaymentAuthorized
+}
+
+// Subject returns the merchant and the payment the event is about.
+func (e PaymentAuthorized) Subject() (uint, uint) {
+	return e.MerchantID, e.PaymentID
+}
+
+// UnmarshalJSON unmarshals the event, parsing its amount in its currency.
+func (e *PaymentAuthorized) UnmarshalJSON(data []byte) error {
+	type payload PaymentAuthorized
+	event := payload{}
+	if err := presetCurrency(data, &event.Amount); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	*e = PaymentAuthorized(event)
+	return nil
+}
+
+// Type returns the type of the event.
+func (e PaymentCancelled) Type() EventType {
+	return EventPaymentCancelled
+}
+
+// Subject returns the merchant and the payment the event is about.
+func (e PaymentCancelled) Subject() (uint, uint) {
+	return e.MerchantID, e.PaymentID
+}
+
+// UnmarshalJSON unmarshals the event, parsing its amount in its currency.
+func (e *PaymentCancelled) UnmarshalJSON(data []byte) error {
+	type payload PaymentCancelled
+	event := payload{}
+	if err := presetCurrency(data, &event.Amount); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	*e = PaymentCancelled(event)
+	return nil
+}
+
+// Type returns the type of the event.
+func (e RefundCreated) Type() EventType {
+	return EventRefundCreated
+}
+
+// Subject returns the merchant and the payment the event is about.
+func (e RefundCreated) Subject() (uint, uint) {
+	return e.MerchantID, e.PaymentID
+}
+
+// UnmarshalJSON unmarshals the event, parsing its amount in its currency.
+func (e *RefundCreated) UnmarshalJSON(data []byte) error {
+	type payload RefundCreated
+	event := payload{}
+	if err := presetCurrency(data, &event.Amount); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	*e = RefundCreated(event)
+	return nil
+}
+
+// Type returns the type of the event.
+func (e RefundSettled) Type() EventType {
+	return EventRefundSettled
+}
+
+// Subject returns the merchant and the payment the event is about.
+func (e RefundSettled) Subject() (uint, uint) {
+	return e.MerchantID, e.PaymentID
+}
+
+// UnmarshalJSON unmarshals the event, parsing its amount in its currency.
+func (e *RefundSettled) UnmarshalJSON(data []byte) error {
+	type payload RefundSettled
+	event := payload{}
+	if err := presetCurrency(data, &event.Amount); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	*e = RefundSettled(event)
+	return nil
+}
+
+// presetCurrency sets the currency of an event payload on its amount before the payload is unmarshalled,
+// since amounts are encoded in major units and can only be parsed knowing the number of decimals of their currency.
+func presetCurrency(data []byte, amount *Money) error {
+	var currency struct {
+		Currency string `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &currency); err != nil {
+		return err
+	}
+	amount.Currency = currency.Currency
+	return nil
+}
@@ -0,0 +1,28 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey represents a client supplied idempotency key stored in the database.
+// It keeps a hash of the original request and, once completed, the response that was sent back.
+// LockedAt is when the request executing with the key took it, so that a key left behind by a request that never
+// completed can be taken over once its lock times out.
+type IdempotencyKey struct {
+	gorm.Model             // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	MerchantID   uint      `gorm:"not null;uniqueIndex:idx_merchant_key" json:"merchant_id"`
+	Key          string    `gorm:"not null;uniqueIndex:idx_merchant_key" json:"key"`
+	RequestHash  string    `gorm:"not null" json:"request_hash"`
+	Completed    bool      `gorm:"not null" json:"completed"`
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `gorm:"type:text" json:"response_body"`
+	LockedAt     time.Time `gorm:"not null" json:"locked_at"`
+}
+
+// LockExpired reports whether the request holding an uncompleted key took it longer than the timeout ago.
+func (k IdempotencyKey) LockExpired(timeout time.Duration, now time.Time) bool {
+	return !k.Completed && now.Sub(k.LockedAt) > timeout
+}
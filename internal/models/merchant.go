@@ -2,18 +2,50 @@
 package models
 
 import (
+	"strings"
+
 	"gorm.io/gorm"
 )
 
 // Merchant represents a merchant entity stored in the database.
+// The merchant authenticates with the API keys stored as MerchantApiKey records. The rate limits are requests per
+// minute, where zero uses the gateway default.
 type Merchant struct {
 	gorm.Model         // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
-	ApiToken    string `gorm:"not null" json:"api_token" validate:"required"`
 	Name        string `gorm:"not null" json:"name" validate:"required"`
 	Email       string `gorm:"not null" json:"email" validate:"required"`
 	Country     string `json:"country"`
 	Address     string `json:"address"`
 	PhoneNumber string `json:"phone_number"`
+	Currencies  string `gorm:"not null" json:"currencies"`
+
+	PaymentRateLimit int `gorm:"not null" json:"payment_rate_limit"`
+	ReadRateLimit    int `gorm:"not null" json:"read_rate_limit"`
+}
+
+// AcceptedCurrencies returns the ISO 4217 codes of the currencies the merchant accepts payments in,
+// stored as a comma separated list. Merchants without a list only accept the default currency.
+func (m Merchant) AcceptedCurrencies() []string {
+	var currencies []string
+	for _, currency := range strings.Split(m.Currencies, ",") {
+		if code := strings.ToUpper(strings.TrimSpace(currency)); code != "" {
+			currencies = append(currencies, code)
+		}
+	}
+	if len(currencies) == 0 {
+		return []string{DefaultCurrency}
+	}
+	return currencies
+}
+
+// AcceptsCurrency reports whether the merchant accepts payments in the given currency.
+func (m Merchant) AcceptsCurrency(currency string) bool {
+	for _, accepted := range m.AcceptedCurrencies() {
+		if accepted == currency {
+			return true
+		}
+	}
+	return false
 }
 
 // MerchantResponse represents a response model for merchant data.
@@ -0,0 +1,58 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix prefixes the merchant API keys so that they are recognizable.
+const apiKeyPrefix = "pgk_"
+
+// MerchantApiKey represents an API key a merchant authenticates with. A merchant can hold several keys, each
+// granted its own space separated Scopes, so that it can hand out keys with fewer permissions and revoke them
+// independently. KeyHash holds the hash of the key, never the key itself.
+type MerchantApiKey struct {
+	gorm.Model        // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	MerchantID uint   `gorm:"not null;index" json:"-"`
+	Name       string `gorm:"not null" json:"name"`
+	KeyHash    string `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     string `gorm:"not null" json:"scopes"`
+}
+
+// GenerateApiKey generates a random API key for a merchant.
+func GenerateApiKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// HashApiToken returns the hash of a merchant API key as it is stored in the database.
+func HashApiToken(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(hash[:])
+}
+
+// GrantedScopes returns the scopes granted to the API key.
+// Keys without a list are granted the default merchant scopes, and scopes that cannot be granted to merchant keys,
+// such as admin, are ignored for keys stored with them before they were restricted.
+func (k MerchantApiKey) GrantedScopes() []Scope {
+	scopes := ParseScopes(k.Scopes)
+	if len(scopes) == 0 {
+		return DefaultMerchantScopes
+	}
+
+	granted := make([]Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		if IsKnownScope(scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
@@ -0,0 +1,233 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency assumed for amounts that do not carry one.
+const DefaultCurrency = "USD"
+
+// Define custom error messages
+var (
+	ErrCurrencyMismatch = errors.New("amounts have different currencies")
+	ErrAmountOverflow   = errors.New("amount is out of range")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// Money represents an exact amount of money as an integer number of minor units of a currency.
+// It is stored in the database as the number of minor units and encoded in JSON as a decimal number.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// NewMoney creates an amount of money from a number of minor units of the given currency.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal amount in major units, such as "70.25", into an exact amount of money.
+// Amounts with more decimal digits than the minor unit of the currency are rejected, and an empty amount is zero.
+func ParseMoney(amount string, currency string) (Money, error) {
+	money := Money{Currency: currency}
+
+	minorUnitDigits, err := CurrencyExponent(money.CurrencyCode())
+	if err != nil {
+		return Money{}, err
+	}
+
+	text := strings.TrimSpace(amount)
+	if text == "" {
+		return money, nil
+	}
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(text, "-")
+
+	whole, fraction, hasPoint := strings.Cut(text, ".")
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	if len(fraction) > minorUnitDigits {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimals for %s", ErrInvalidAmount, amount, minorUnitDigits, money.CurrencyCode())
+	}
+	fraction += strings.Repeat("0", minorUnitDigits-len(fraction))
+
+	units, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, ErrAmountOverflow
+	}
+	if negative {
+		units = -units
+	}
+	money.Amount = units
+	return money, nil
+}
+
+// CurrencyCode returns the currency of the amount, or the default currency when it has none.
+func (m Money) CurrencyCode() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether the amount is lower than zero.
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add returns the sum of both amounts, failing when the currencies differ or the result overflows.
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.checkCurrency(other); err != nil {
+		return Money{}, err
+	}
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currencyWith(other)}, nil
+}
+
+// Sub returns the difference of both amounts, failing when the currencies differ or the result overflows.
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.checkCurrency(other); err != nil {
+		return Money{}, err
+	}
+	if (other.Amount < 0 && m.Amount > math.MaxInt64+other.Amount) ||
+		(other.Amount > 0 && m.Amount < math.MinInt64+other.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currencyWith(other)}, nil
+}
+
+// Cmp compares both amounts, returning -1, 0 or +1 when the amount is lower than, equal to or greater than
+// the other one. It fails when the currencies differ.
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.checkCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Decimal returns the amount in major units as an exact decimal string with as many decimal digits as the
+// minor unit of its currency, such as "70.25" for USD or "1200" for JPY.
+func (m Money) Decimal() string {
+	units := m.Amount
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatUint(absolute(units), 10)
+	minorUnitDigits, err := CurrencyExponent(m.CurrencyCode())
+	if err != nil || minorUnitDigits == 0 {
+		return sign + digits
+	}
+	if len(digits) <= minorUnitDigits {
+		digits = strings.Repeat("0", minorUnitDigits-len(digits)+1) + digits
+	}
+	split := len(digits) - minorUnitDigits
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+// String converts the amount to its string representation, such as "70.25 USD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.CurrencyCode()
+}
+
+// MarshalJSON marshals the amount to JSON as a decimal number in major units.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON unmarshals a decimal number in major units, keeping the currency already set on the amount.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" || text == "" {
+		m.Amount = 0
+		return nil
+	}
+	money, err := ParseMoney(text, m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+// Value converts the amount to its number of minor units to store it in the database.
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan scans a number of minor units into the amount.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		m.Amount = v
+		return nil
+	case []byte:
+		units, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return err
+		}
+		m.Amount = units
+		return nil
+	case nil:
+		m.Amount = 0
+		return nil
+	default:
+		return fmt.Errorf("unsupported Scan type: %T", value)
+	}
+}
+
+// checkCurrency fails when both amounts have different currencies.
+func (m Money) checkCurrency(other Money) error {
+	if m.CurrencyCode() != other.CurrencyCode() {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.CurrencyCode(), other.CurrencyCode())
+	}
+	return nil
+}
+
+// currencyWith returns the currency of the result of an operation between both amounts.
+func (m Money) currencyWith(other Money) string {
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+// absolute returns the absolute value of a number of minor units without overflowing.
+func absolute(units int64) uint64 {
+	if units < 0 {
+		return uint64(-(units + 1)) + 1
+	}
+	return uint64(units)
+}
+
+// isDigits reports whether the text is made only of decimal digits.
+func isDigits(text string) bool {
+	for _, r := range text {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name        string
+		a, b        Money
+		expected    Money
+		expectedErr error
+	}{
+		{name: "sum", a: NewMoney(1050, "USD"), b: NewMoney(250, "USD"), expected: NewMoney(1300, "USD")},
+		{name: "negative operand", a: NewMoney(1050, "USD"), b: NewMoney(-2000, "USD"), expected: NewMoney(-950, "USD")},
+		{name: "default currency", a: NewMoney(100, ""), b: NewMoney(100, "USD"), expected: NewMoney(200, "USD")},
+		{name: "largest amount", a: NewMoney(math.MaxInt64-1, "USD"), b: NewMoney(1, "USD"), expected: NewMoney(math.MaxInt64, "USD")},
+		{name: "overflow", a: NewMoney(math.MaxInt64, "USD"), b: NewMoney(1, "USD"), expectedErr: ErrAmountOverflow},
+		{name: "underflow", a: NewMoney(math.MinInt64, "USD"), b: NewMoney(-1, "USD"), expectedErr: ErrAmountOverflow},
+		{name: "currency mismatch", a: NewMoney(100, "USD"), b: NewMoney(100, "EUR"), expectedErr: ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && sum != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, sum)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name        string
+		a, b        Money
+		expected    Money
+		expectedErr error
+	}{
+		{name: "difference", a: NewMoney(1050, "USD"), b: NewMoney(250, "USD"), expected: NewMoney(800, "USD")},
+		{name: "negative result", a: NewMoney(250, "USD"), b: NewMoney(1050, "USD"), expected: NewMoney(-800, "USD")},
+		{name: "smallest amount", a: NewMoney(math.MinInt64+1, "USD"), b: NewMoney(1, "USD"), expected: NewMoney(math.MinInt64, "USD")},
+		{name: "underflow", a: NewMoney(math.MinInt64, "USD"), b: NewMoney(1, "USD"), expectedErr: ErrAmountOverflow},
+		{name: "overflow", a: NewMoney(math.MaxInt64, "USD"), b: NewMoney(-1, "USD"), expectedErr: ErrAmountOverflow},
+		{name: "currency mismatch", a: NewMoney(100, "JPY"), b: NewMoney(100, "USD"), expectedErr: ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			difference, err := tt.a.Sub(tt.b)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if err == nil && difference != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, difference)
+			}
+		})
+	}
+}
+
+func TestMoneyMarshalJSON(t *testing.T) {
+	tests := []struct {
+		money    Money
+		expected string
+	}{
+		{money: NewMoney(7025, "USD"), expected: "70.25"},
+		{money: NewMoney(5, "USD"), expected: "0.05"},
+		{money: NewMoney(-5, "USD"), expected: "-0.05"},
+		{money: NewMoney(0, "USD"), expected: "0.00"},
+		{money: NewMoney(1200, "JPY"), expected: "1200"},
+		{money: NewMoney(1234, "KWD"), expected: "1.234"},
+		{money: NewMoney(7025, ""), expected: "70.25"},
+		{money: NewMoney(math.MinInt64, "USD"), expected: "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.money)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("expected %v to marshal to %s, got %s", tt.money, tt.expected, data)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json        string
+		currency    string
+		expected    int64
+		expectedErr error
+	}{
+		{json: "70.25", currency: "USD", expected: 7025},
+		{json: `"70.25"`, currency: "USD", expected: 7025},
+		{json: "70.2", currency: "USD", expected: 7020},
+		{json: "70", currency: "USD", expected: 7000},
+		{json: "-0.05", currency: "USD", expected: -5},
+		{json: "1200", currency: "JPY", expected: 1200},
+		{json: "1.234", currency: "BHD", expected: 1234},
+		{json: "null", currency: "USD", expected: 0},
+		{json: "70.255", currency: "USD", expectedErr: ErrInvalidAmount},
+		{json: "1200.5", currency: "JPY", expectedErr: ErrInvalidAmount},
+		{json: "1e3", currency: "USD", expectedErr: ErrInvalidAmount},
+		{json: `"70."`, currency: "USD", expectedErr: ErrInvalidAmount},
+		{json: `".5"`, currency: "USD", expectedErr: ErrInvalidAmount},
+		{json: "92233720368547758.08", currency: "USD", expectedErr: ErrAmountOverflow},
+	}
+
+	for _, tt := range tests {
+		money := Money{Currency: tt.currency}
+		err := json.Unmarshal([]byte(tt.json), &money)
+		if !errors.Is(err, tt.expectedErr) {
+			t.Errorf("expected %s in %s to fail with %v, got %v", tt.json, tt.currency, tt.expectedErr, err)
+			continue
+		}
+		if err == nil && (money.Amount != tt.expected || money.Currency != tt.currency) {
+			t.Errorf("expected %s in %s to unmarshal to %d, got %v", tt.json, tt.currency, tt.expected, money)
+		}
+	}
+}
+
+func TestMoneyRoundTripsThroughJSON(t *testing.T) {
+	for _, money := range []Money{NewMoney(7025, "USD"), NewMoney(1200, "JPY"), NewMoney(1234, "KWD"), NewMoney(-1, "EUR")} {
+		data, err := json.Marshal(money)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := Money{Currency: money.Currency}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded != money {
+			t.Errorf("expected %v after a round trip, got %v", money, decoded)
+		}
+	}
+}
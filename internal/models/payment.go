@@ -2,6 +2,8 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -19,26 +21,96 @@ const (
 	Refunded
 	Processed
 	Authorized
+	PartiallyRefunded
+	Capturing
+	Cancelling
 )
 
+// ErrInvalidStatusTransition is matched by every StatusTransitionError.
+var ErrInvalidStatusTransition = errors.New("invalid payment status transition")
+
+// paymentTransitions lists, for every payment status, the statuses a payment can move to.
+// Statuses without an entry are final. An authorized payment is capturing or cancelling while its capture or void is
+// sent to the acquiring bank, and moves back to authorized when the bank did not capture or void it.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	Pending:           {Succeeded, Failed, Authorized},
+	Authorized:        {Capturing, Cancelling},
+	Capturing:         {Processed, Authorized},
+	Cancelling:        {Cancelled, Authorized},
+	Succeeded:         {Refunded, PartiallyRefunded},
+	Processed:         {Refunded, PartiallyRefunded},
+	PartiallyRefunded: {Refunded, PartiallyRefunded},
+}
+
+// StatusTransitionError reports a payment status change that is not allowed by the state machine.
+type StatusTransitionError struct {
+	From PaymentStatus
+	To   PaymentStatus
+}
+
+// Error returns the description of the illegal transition.
+func (e *StatusTransitionError) Error() string {
+	return fmt.Sprintf("payment cannot move from %s to %s", e.From, e.To)
+}
+
+// Unwrap allows matching the error with ErrInvalidStatusTransition.
+func (e *StatusTransitionError) Unwrap() error {
+	return ErrInvalidStatusTransition
+}
+
 // Payment represents a payment entity stored in the database.
+// CreditCardID links the card the payment was made with, and is nil for payments made before cards were linked.
+// BankReference is the reference of the last capture or void of the payment sent to the acquiring bank, with
+// which a capturing or cancelling payment is reconciled when the outcome of the call was unknown.
+// A merchant has a single active payment per order token, and ActiveOrderToken is the order token of active
+// payments, generated by the database to enforce it.
 type Payment struct {
-	gorm.Model               // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
-	OrderToken string        `gorm:"not null" json:"order_token" validate:"required"`
-	CustomerID uint          `gorm:"not null" json:"customer_id"`
-	MerchantID uint          `gorm:"not null" json:"merchant_id" validate:"required"`
-	Amount     float64       `gorm:"not null" json:"amount" validate:"required"`
-	Status     PaymentStatus `gorm:"not null" json:"status" validate:"required"`
+	gorm.Model                      // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	OrderToken        string        `gorm:"not null;index:idx_payments_merchant_order_token,priority:2" json:"order_token" validate:"required"`
+	ActiveOrderToken  *string       `gorm:"->;uniqueIndex:idx_payments_merchant_active_order_token,priority:2" json:"-"`
+	CustomerID        uint          `gorm:"not null" json:"customer_id"`
+	CreditCardID      *uint         `json:"credit_card_id"`
+	MerchantID        uint          `gorm:"not null;index:idx_payments_merchant_order_token,priority:1;uniqueIndex:idx_payments_merchant_active_order_token,priority:1" json:"merchant_id" validate:"required"`
+	Amount            Money         `gorm:"type:bigint;not null" json:"amount" validate:"required"`
+	Currency          string        `gorm:"type:char(3);not null" json:"currency" validate:"required"`
+	Status            PaymentStatus `gorm:"not null" json:"status" validate:"required"`
+	CapturedAmount    Money         `gorm:"type:bigint;not null;default:0" json:"captured_amount"`
+	AuthorizationCode string        `json:"authorization_code"`
+	Processor         string        `json:"processor"`
+	BankMessage       string        `json:"bank_message"`
+	CallbackUrls      CallbackUrls  `gorm:"embedded;embeddedPrefix:callback_" json:"callback_urls"`
+	BankReference     string        `json:"-"`
 }
 
 // PaymentData represents data for a payment used in responses.
+// Card is nil for payments made before cards were linked to payments, and StatusHistory lists the statuses the
+// payment moved through, oldest first.
 type PaymentData struct {
-	OrderToken string           `json:"order_token"`
-	Amount     float64          `json:"amount"`
-	Status     PaymentStatus    `json:"status"`
-	CreatedAt  time.Time        `json:"created_at"`
-	Customer   CustomerResponse `json:"customer"`
-	Merchant   MerchantResponse `json:"merchant"`
+	ID                uint                  `json:"id"`
+	OrderToken        string                `json:"order_token"`
+	Amount            Money                 `json:"amount"`
+	Currency          string                `json:"currency"`
+	Status            PaymentStatus         `json:"status"`
+	CapturedAmount    Money                 `json:"captured_amount"`
+	Processor         string                `json:"processor"`
+	AuthorizationCode string                `json:"authorization_code"`
+	BankMessage       string                `json:"bank_message"`
+	Card              *CardDetails          `json:"card,omitempty"`
+	RefundedAmount    Money                 `json:"refunded_amount"`
+	RemainingAmount   Money                 `json:"remaining_amount"`
+	Refunds           []RefundData          `json:"refunds"`
+	StatusHistory     []PaymentStatusChange `json:"status_history"`
+	CreatedAt         time.Time             `json:"created_at"`
+	Customer          CustomerResponse      `json:"customer"`
+	Merchant          MerchantResponse      `json:"merchant"`
+}
+
+// PaymentStatusChange records a status a payment moved to, and is stored with every status change of the payment.
+type PaymentStatusChange struct {
+	ID        uint          `gorm:"primaryKey" json:"-"`
+	PaymentID uint          `gorm:"not null;index" json:"-"`
+	Status    PaymentStatus `gorm:"not null" json:"status"`
+	CreatedAt time.Time     `json:"changed_at"`
 }
 
 // String converts a PaymentStatus to its string representation.
@@ -58,16 +130,101 @@ func (s PaymentStatus) String() string {
 		return "processed"
 	case Authorized:
 		return "authorized"
+	case PartiallyRefunded:
+		return "partially_refunded"
+	case Capturing:
+		return "capturing"
+	case Cancelling:
+		return "cancelling"
 	default:
 		return "unknown"
 	}
 }
 
+// BeforeCreate stores the currency of the payment amount in the currency column.
+func (p *Payment) BeforeCreate(tx *gorm.DB) error {
+	p.Currency = p.Amount.CurrencyCode()
+	return nil
+}
+
+// AfterFind sets the currency column on the payment amounts, which only store minor units.
+func (p *Payment) AfterFind(tx *gorm.DB) error {
+	p.Amount.Currency = p.Currency
+	p.CapturedAmount.Currency = p.Currency
+	return nil
+}
+
+// Reference returns the reference identifying the payment at the acquiring bank.
+func (p Payment) Reference() string {
+	return fmt.Sprintf("payment-%d", p.ID)
+}
+
+// NewBankReference returns a new reference identifying a capture or void of the payment at the acquiring bank.
+// Every attempt gets its own reference, so that a capture retried after a declined one is not answered with the
+// outcome of the declined one.
+func (p Payment) NewBankReference(operation string) string {
+	return fmt.Sprintf("payment-%d-%s-%d", p.ID, operation, time.Now().UnixNano())
+}
+
+// SettledAmount returns the amount charged to the customer, which is the captured amount for captured payments
+// and the full amount otherwise. Refunds can never add up to more than this amount.
+func (p Payment) SettledAmount() Money {
+	if !p.CapturedAmount.IsZero() {
+		return p.CapturedAmount
+	}
+	return p.Amount
+}
+
+// IsActive reports whether a payment in this status holds its order, which cannot be paid by another payment.
+// Failed and cancelled payments do not, so the order can be paid again.
+func (s PaymentStatus) IsActive() bool {
+	return s != Failed && s != Cancelled
+}
+
+// IsSuccessful reports whether the acquiring bank accepted a payment in this status, including payments refunded
+// since then.
+func (s PaymentStatus) IsSuccessful() bool {
+	switch s {
+	case Succeeded, Authorized, Capturing, Cancelling, Processed, PartiallyRefunded, Refunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanTransitionTo reports whether a payment in this status can move to the next status.
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, allowed := range paymentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns a StatusTransitionError when a payment in this status cannot move to the next status.
+func (s PaymentStatus) ValidateTransition(next PaymentStatus) error {
+	if !s.CanTransitionTo(next) {
+		return &StatusTransitionError{From: s, To: next}
+	}
+	return nil
+}
+
 // MarshalJSON marshals a PaymentStatus to JSON.
 func (s PaymentStatus) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`"%s"`, s.String())), nil
 }
 
+// UnmarshalJSON unmarshals a PaymentStatus from its JSON string representation.
+func (ps *PaymentStatus) UnmarshalJSON(data []byte) error {
+	var status string
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	*ps = ps.ConvertStringToPaymentStatus(status)
+	return nil
+}
+
 // Scan scans a value into a PaymentStatus.
 func (ps *PaymentStatus) Scan(value interface{}) error {
 	switch v := value.(type) {
@@ -96,6 +253,12 @@ func (ps *PaymentStatus) ConvertStringToPaymentStatus(status string) PaymentStat
 		return Processed
 	case "authorized":
 		return Authorized
+	case "partially_refunded":
+		return PartiallyRefunded
+	case "capturing":
+		return Capturing
+	case "cancelling":
+		return Cancelling
 	default:
 		return 0
 	}
@@ -0,0 +1,91 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// PaymentSort represents the column payments are listed by.
+type PaymentSort string
+
+const (
+	SortByCreatedAt PaymentSort = "created_at"
+	SortByAmount    PaymentSort = "amount"
+)
+
+// ErrInvalidPaymentCursor is returned when a payment cursor was not issued by the gateway.
+var ErrInvalidPaymentCursor = errors.New("invalid cursor")
+
+// PaymentFilter represents the criteria to list the payments of a merchant, where zero values match every payment.
+// The time range includes From and excludes To, and the amount range includes both bounds, which are only compared
+// with payments in their currency. Payments are sorted by Sort and then by ID, and listed after the After cursor.
+type PaymentFilter struct {
+	MerchantID    uint
+	Statuses      []PaymentStatus
+	From          time.Time
+	To            time.Time
+	Currency      string
+	MinAmount     Money
+	MaxAmount     Money
+	CustomerEmail string
+	OrderToken    string
+	CardLastFour  string
+	Sort          PaymentSort
+	Descending    bool
+	After         *PaymentCursor
+}
+
+// PaymentCursor represents the position of a payment in a list of payments, whichever column it is sorted by.
+type PaymentCursor struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Amount    int64     `json:"amount"`
+}
+
+// PaymentSummary represents a payment in a list of payments.
+type PaymentSummary struct {
+	ID            uint          `json:"id"`
+	OrderToken    string        `json:"order_token"`
+	Amount        Money         `json:"amount"`
+	Currency      string        `json:"currency"`
+	Status        PaymentStatus `json:"status"`
+	Processor     string        `json:"processor"`
+	CustomerID    uint          `json:"customer_id"`
+	CustomerEmail string        `json:"customer_email"`
+	CardBrand     string        `json:"card_brand"`
+	CardLastFour  string        `json:"card_last_four"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// NewPaymentCursor returns the cursor listing the payments after the given one.
+func NewPaymentCursor(payment PaymentSummary) PaymentCursor {
+	return PaymentCursor{
+		ID:        payment.ID,
+		CreatedAt: payment.CreatedAt,
+		Amount:    payment.Amount.Amount,
+	}
+}
+
+// Encode returns the opaque form of the cursor returned to clients.
+func (c PaymentCursor) Encode() string {
+	// a cursor only holds numbers and a time, so marshalling it cannot fail
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParsePaymentCursor parses a cursor returned by Encode.
+func ParsePaymentCursor(value string) (PaymentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return PaymentCursor{}, ErrInvalidPaymentCursor
+	}
+
+	var cursor PaymentCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return PaymentCursor{}, ErrInvalidPaymentCursor
+	}
+	return cursor, nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// paymentStatuses lists every payment status.
+var paymentStatuses = []PaymentStatus{Pending, Succeeded, Failed, Cancelled, Refunded, Processed, Authorized, PartiallyRefunded, Capturing, Cancelling}
+
+func TestPaymentTransitions(t *testing.T) {
+	// failed, cancelled and refunded payments are final
+	allowed := map[PaymentStatus][]PaymentStatus{
+		Pending:           {Succeeded, Failed, Authorized},
+		Authorized:        {Capturing, Cancelling},
+		Capturing:         {Processed, Authorized},
+		Cancelling:        {Cancelled, Authorized},
+		Succeeded:         {Refunded, PartiallyRefunded},
+		Processed:         {Refunded, PartiallyRefunded},
+		PartiallyRefunded: {Refunded, PartiallyRefunded},
+		Failed:            nil,
+		Cancelled:         nil,
+		Refunded:          nil,
+	}
+
+	for _, from := range paymentStatuses {
+		for _, to := range paymentStatuses {
+			expected := false
+			for _, next := range allowed[from] {
+				if next == to {
+					expected = true
+				}
+			}
+
+			t.Run(from.String()+" to "+to.String(), func(t *testing.T) {
+				if can := from.CanTransitionTo(to); can != expected {
+					t.Fatalf("CanTransitionTo = %t, expected %t", can, expected)
+				}
+
+				err := from.ValidateTransition(to)
+				if expected {
+					if err != nil {
+						t.Fatalf("expected the transition to be valid, got %v", err)
+					}
+					return
+				}
+
+				var transitionErr *StatusTransitionError
+				if !errors.As(err, &transitionErr) || transitionErr.From != from || transitionErr.To != to {
+					t.Fatalf("expected a StatusTransitionError from %s to %s, got %v", from, to, err)
+				}
+				if !errors.Is(err, ErrInvalidStatusTransition) {
+					t.Fatalf("expected the error to match ErrInvalidStatusTransition, got %v", err)
+				}
+			})
+		}
+	}
+}
@@ -2,13 +2,146 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// RefundStatus represents the status of a refund.
+type RefundStatus int
+
+const (
+	RefundPending RefundStatus = iota + 1
+	RefundSucceeded
+	RefundFailed
+)
+
 // Refund represents a refund entity stored in the database.
 type Refund struct {
-	gorm.Model         // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
-	PaymentID  uint    `gorm:"not null" json:"payment_id" validate:"required"`
-	Amount     float64 `gorm:"not null" json:"amount" validate:"required"`
-	Reason     string  `gorm:"not null" json:"reason" validate:"required"`
+	gorm.Model              // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	PaymentID  uint         `gorm:"not null" json:"payment_id" validate:"required"`
+	Amount     Money        `gorm:"type:bigint;not null" json:"amount" validate:"required"`
+	Currency   string       `gorm:"type:char(3);not null" json:"currency" validate:"required"`
+	Reason     string       `gorm:"not null" json:"reason" validate:"required"`
+	Status     RefundStatus `gorm:"not null" json:"status" validate:"required"`
+}
+
+// RefundData represents data for a refund used in responses.
+type RefundData struct {
+	ID        uint         `json:"id"`
+	Amount    Money        `json:"amount"`
+	Reason    string       `json:"reason"`
+	Status    RefundStatus `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// SummarizeRefunds lists the refunds of a payment with the refunded amount and the balance left to refund,
+// which excludes refunds still pending with the acquiring bank.
+func SummarizeRefunds(payment Payment, refunds []Refund) (RefundListResponse, error) {
+	summary := RefundListResponse{
+		PaymentID:       payment.ID,
+		PaymentStatus:   payment.Status,
+		Currency:        payment.Currency,
+		SettledAmount:   payment.SettledAmount(),
+		RefundedAmount:  NewMoney(0, payment.Amount.Currency),
+		RemainingAmount: payment.SettledAmount(),
+		Refunds:         make([]RefundData, 0, len(refunds)),
+	}
+
+	for _, refund := range refunds {
+		var err error
+		switch refund.Status {
+		case RefundSucceeded:
+			if summary.RefundedAmount, err = summary.RefundedAmount.Add(refund.Amount); err != nil {
+				return RefundListResponse{}, err
+			}
+			fallthrough
+		case RefundPending:
+			if summary.RemainingAmount, err = summary.RemainingAmount.Sub(refund.Amount); err != nil {
+				return RefundListResponse{}, err
+			}
+		}
+		summary.Refunds = append(summary.Refunds, RefundData{
+			ID:        refund.ID,
+			Amount:    refund.Amount,
+			Reason:    refund.Reason,
+			Status:    refund.Status,
+			CreatedAt: refund.CreatedAt,
+		})
+	}
+
+	return summary, nil
+}
+
+// Reference returns the reference identifying the refund at the acquiring bank.
+func (r Refund) Reference() string {
+	return fmt.Sprintf("refund-%d", r.ID)
+}
+
+// BeforeCreate stores the currency of the refund amount in the currency column.
+func (r *Refund) BeforeCreate(tx *gorm.DB) error {
+	r.Currency = r.Amount.CurrencyCode()
+	return nil
+}
+
+// AfterFind sets the currency column on the refund amount, which only stores minor units.
+func (r *Refund) AfterFind(tx *gorm.DB) error {
+	r.Amount.Currency = r.Currency
+	return nil
+}
+
+// String converts a RefundStatus to its string representation.
+func (s RefundStatus) String() string {
+	switch s {
+	case RefundPending:
+		return "pending"
+	case RefundSucceeded:
+		return "succeeded"
+	case RefundFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON marshals a RefundStatus to JSON.
+func (s RefundStatus) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%s"`, s.String())), nil
+}
+
+// UnmarshalJSON unmarshals a RefundStatus from its JSON string representation.
+func (rs *RefundStatus) UnmarshalJSON(data []byte) error {
+	var status string
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	*rs = rs.ConvertStringToRefundStatus(status)
+	return nil
+}
+
+// Scan scans a value into a RefundStatus.
+func (rs *RefundStatus) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		*rs = rs.ConvertStringToRefundStatus(string(v))
+		return nil
+	default:
+		return fmt.Errorf("unsupported Scan type: %T", value)
+	}
+}
+
+// ConvertStringToRefundStatus converts a string to a RefundStatus.
+func (rs *RefundStatus) ConvertStringToRefundStatus(status string) RefundStatus {
+	switch status {
+	case "pending":
+		return RefundPending
+	case "succeeded":
+		return RefundSucceeded
+	case "failed":
+		return RefundFailed
+	default:
+		return 0
+	}
 }
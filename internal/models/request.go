@@ -1,26 +1,101 @@
 // Package models provides data models used throughout the application.
 package models
 
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrCurrencyNotAccepted is returned when a request amount is not in the currency of the payment it refers to.
+var ErrCurrencyNotAccepted = errors.New("currency does not match the payment currency")
+
 // PaymentRequest represents a request for making a payment.
+// The merchant of the payment is the one authenticated by the request API key.
 type PaymentRequest struct {
 	OrderToken    string        `json:"order_token"`
 	PaymentSource PaymentSource `json:"payment_source"`
-	Amount        float64       `json:"amount"`
+	Amount        json.Number   `json:"amount"`
+	Currency      string        `json:"currency"`
 	Customer      Customer      `json:"customer"`
 	CallbackUrls  CallbackUrls  `json:"callback_urls"`
-	MerchandID    uint          `json:"merchand_id"` // se podria mandar como header
 }
 
 // RefundRequest represents a request for refunding a payment.
 type RefundRequest struct {
-	Amount float64 `json:"amount"`
-	Reason string  `json:"reason"`
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+	Reason   string      `json:"reason"`
+}
+
+// CaptureRequest represents a request for capturing an authorized payment.
+// An amount of zero captures the full authorized amount.
+type CaptureRequest struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// WebhookEndpointRequest represents a request for registering a webhook endpoint.
+// An empty list of event types subscribes the endpoint to every event type.
+type WebhookEndpointRequest struct {
+	URL        string      `json:"url"`
+	EventTypes []EventType `json:"event_types"`
+}
+
+// WebhookSecretRotationRequest represents a request for rotating the webhook signing secret of a merchant.
+// OverlapSeconds is how long requests keep being signed with the previous secrets as well, where zero uses the
+// gateway default.
+type WebhookSecretRotationRequest struct {
+	OverlapSeconds int64 `json:"overlap_seconds"`
+}
+
+// ApiKeyRequest represents a request for creating an API key of a merchant.
+// The scopes of the new key must be granted to the key creating it.
+type ApiKeyRequest struct {
+	Name   string  `json:"name"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// Money parses the amount of the payment request in its currency, which defaults to DefaultCurrency.
+// The amount cannot have more decimals than the minor unit of the currency.
+func (r PaymentRequest) Money() (Money, error) {
+	currency, err := NormalizeCurrency(r.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return ParseMoney(r.Amount.String(), currency)
+}
+
+// MoneyIn parses the amount of the refund request in the currency of the refunded payment.
+func (r RefundRequest) MoneyIn(currency string) (Money, error) {
+	return parseAmountIn(r.Amount, r.Currency, currency)
+}
+
+// MoneyIn parses the amount of the capture request in the currency of the captured payment.
+func (r CaptureRequest) MoneyIn(currency string) (Money, error) {
+	return parseAmountIn(r.Amount, r.Currency, currency)
+}
+
+// parseAmountIn parses a request amount in the currency of an existing payment, rejecting requests
+// that name a different currency.
+func parseAmountIn(amount json.Number, requested string, currency string) (Money, error) {
+	if requested != "" {
+		code, err := NormalizeCurrency(requested)
+		if err != nil {
+			return Money{}, err
+		}
+		if code != currency {
+			return Money{}, ErrCurrencyNotAccepted
+		}
+	}
+	return ParseMoney(amount.String(), currency)
 }
 
 // PaymentSource represents the payment source information.
+// A saved card of the customer can be charged by its card token instead of sending the card information.
 type PaymentSource struct {
 	MethodType string   `json:"method_type"`
 	Processor  string   `json:"processor"`
+	CardToken  string   `json:"card_token"`
 	CardInfo   CardInfo `json:"card_info"`
 }
 
@@ -1,7 +1,11 @@
 // Package models provides data models used throughout the application.
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/audit"
+)
 
 // PaymentResponse represents the response after processing a payment.
 type PaymentResponse struct {
@@ -15,9 +19,17 @@ type PaymentResponse struct {
 	CreatedAt   time.Time        `json:"created_at"`
 }
 
+// PaymentListResponse represents a page of the payments of a merchant with the cursor of the next page,
+// which is empty on the last page.
+type PaymentListResponse struct {
+	Payments   []PaymentSummary `json:"payments"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
 // PaymentInfo represents information about the payment.
 type PaymentInfo struct {
-	Amount      float64     `json:"amount"`
+	Amount      Money       `json:"amount"`
+	Currency    string      `json:"currency"`
 	MethodType  string      `json:"method_type"`
 	CardDetails CardDetails `json:"card_details"`
 	Processor   string      `json:"processor"`
@@ -32,6 +44,100 @@ type CardDetails struct {
 }
 
 // RefundResponse represents the response after processing a refund.
+// Status holds the status of the refund, and PaymentStatus the resulting status of the refunded payment.
 type RefundResponse struct {
-	Status string `json:"status"`
+	ID            uint          `json:"id"`
+	Status        RefundStatus  `json:"status"`
+	PaymentStatus PaymentStatus `json:"payment_status"`
+	Amount        Money         `json:"amount"`
+	Currency      string        `json:"currency"`
+}
+
+// RefundListResponse represents the refunds of a payment together with its refundable balance.
+type RefundListResponse struct {
+	PaymentID       uint          `json:"payment_id"`
+	PaymentStatus   PaymentStatus `json:"payment_status"`
+	Currency        string        `json:"currency"`
+	SettledAmount   Money         `json:"settled_amount"`
+	RefundedAmount  Money         `json:"refunded_amount"`
+	RemainingAmount Money         `json:"remaining_amount"`
+	Refunds         []RefundData  `json:"refunds"`
+}
+
+// CaptureResponse represents the response after capturing an authorized payment.
+type CaptureResponse struct {
+	ID               uint          `json:"id"`
+	Status           PaymentStatus `json:"status"`
+	Currency         string        `json:"currency"`
+	AuthorizedAmount Money         `json:"authorized_amount"`
+	CapturedAmount   Money         `json:"captured_amount"`
+	ReleasedAmount   Money         `json:"released_amount"`
+}
+
+// CancelResponse represents the response after cancelling an authorized payment.
+type CancelResponse struct {
+	ID          uint          `json:"id"`
+	Status      PaymentStatus `json:"status"`
+	RedirectUrl string        `json:"redirect_url"`
+}
+
+// CardResponse represents a saved card of a customer.
+type CardResponse struct {
+	ID              uint      `json:"id"`
+	Token           string    `json:"card_token"`
+	CardType        string    `json:"card_type"`
+	CardBrand       string    `json:"card_brand"`
+	CardHolder      string    `json:"card_holder"`
+	LastFourDigits  string    `json:"last_four_digits"`
+	ExpirationMonth string    `json:"expiration_month"`
+	ExpirationYear  string    `json:"expiration_year"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CardListResponse represents the saved cards of a customer.
+type CardListResponse struct {
+	CustomerID uint           `json:"customer_id"`
+	Cards      []CardResponse `json:"cards"`
+}
+
+// AuditEntryListResponse represents a page of audit entries.
+// NextCursor is empty on the last page and is passed as the cursor of the next request otherwise.
+type AuditEntryListResponse struct {
+	Entries    []audit.Entry `json:"entries"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+// WebhookEndpointResponse represents a webhook endpoint of a merchant.
+// The signing secret of the merchant is only returned when registering the endpoint created it.
+type WebhookEndpointResponse struct {
+	ID         uint        `json:"id"`
+	URL        string      `json:"url"`
+	EventTypes []EventType `json:"event_types"`
+	Secret     string      `json:"secret,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// ApiKeyResponse represents an API key of a merchant.
+// The key itself is only returned when it is created, and it is not returned again.
+type ApiKeyResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []Scope   `json:"scopes"`
+	Key       string    `json:"key,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookSecretResponse represents a new webhook signing secret of a merchant, which is not returned again,
+// with the time the previous secrets expire.
+type WebhookSecretResponse struct {
+	ID                      uint       `json:"id"`
+	Secret                  string     `json:"secret"`
+	CreatedAt               time.Time  `json:"created_at"`
+	PreviousSecretsExpireAt *time.Time `json:"previous_secrets_expire_at,omitempty"`
+}
+
+// WebhookDeliveryListResponse represents the delivery log of a webhook endpoint, most recent first.
+type WebhookDeliveryListResponse struct {
+	EndpointID uint              `json:"endpoint_id"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
 }
@@ -0,0 +1,38 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RoutingRule represents a rule stored in the database that sends matching payments to a processor.
+// Empty criteria match every payment, and rules without a merchant apply to all merchants.
+type RoutingRule struct {
+	gorm.Model        // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	Processor  string `gorm:"not null" json:"processor" validate:"required"`
+	Priority   int    `gorm:"not null" json:"priority"`
+	MerchantID uint   `json:"merchant_id"`
+	CardBrand  string `json:"card_brand"`
+	Currency   string `json:"currency"`
+	MinAmount  int64  `json:"min_amount"`
+	MaxAmount  int64  `json:"max_amount"`
+}
+
+// Matches reports whether a payment of the merchant, card brand and amount satisfies every criteria of the rule.
+// Amount limits are in minor units of the payment currency.
+func (r RoutingRule) Matches(merchantID uint, cardBrand string, amount Money) bool {
+	switch {
+	case r.MerchantID != 0 && r.MerchantID != merchantID:
+		return false
+	case r.CardBrand != "" && r.CardBrand != cardBrand:
+		return false
+	case r.Currency != "" && r.Currency != amount.CurrencyCode():
+		return false
+	case r.MinAmount != 0 && amount.Amount < r.MinAmount:
+		return false
+	case r.MaxAmount != 0 && amount.Amount > r.MaxAmount:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,82 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"strings"
+)
+
+// Scope represents a permission granted to the caller of the API.
+type Scope string
+
+// Scopes of the API. The admin scope grants every other scope.
+const (
+	ScopePaymentsWrite Scope = "payments:write"
+	ScopePaymentsRead  Scope = "payments:read"
+	ScopeRefundsWrite  Scope = "refunds:write"
+	ScopeWebhooksWrite Scope = "webhooks:write"
+	ScopeAuditRead     Scope = "audit:read"
+	ScopeApiKeysRead   Scope = "api_keys:read"
+	ScopeApiKeysWrite  Scope = "api_keys:write"
+	ScopeAdmin         Scope = "admin"
+)
+
+// knownScopes are the scopes that can be granted to merchant API keys. The audit and admin scopes are only granted
+// to staff through their JWT.
+var knownScopes = map[Scope]bool{
+	ScopePaymentsWrite: true,
+	ScopePaymentsRead:  true,
+	ScopeRefundsWrite:  true,
+	ScopeWebhooksWrite: true,
+	ScopeApiKeysRead:   true,
+	ScopeApiKeysWrite:  true,
+}
+
+// DefaultMerchantScopes are the scopes of merchant API keys that do not list their own.
+var DefaultMerchantScopes = []Scope{ScopePaymentsWrite, ScopePaymentsRead, ScopeRefundsWrite}
+
+// roleScopes maps the user types of the identity provider to the scopes they are granted.
+var roleScopes = map[string][]Scope{
+	"ADMIN":      {ScopeAdmin},
+	"SUPPORT":    {ScopePaymentsRead},
+	"COMPLIANCE": {ScopeAuditRead},
+}
+
+// ParseScopes parses a space separated list of scopes, as found in the scope claim of a token.
+func ParseScopes(scopes string) []Scope {
+	var parsed []Scope
+	for _, scope := range strings.Fields(scopes) {
+		parsed = append(parsed, Scope(scope))
+	}
+	return parsed
+}
+
+// IsKnownScope reports whether the scope is one of the scopes that can be granted to merchant API keys.
+func IsKnownScope(scope Scope) bool {
+	return knownScopes[scope]
+}
+
+// RoleScopes returns the scopes granted to a user type of the identity provider.
+func RoleScopes(userType string) []Scope {
+	return roleScopes[strings.ToUpper(userType)]
+}
+
+// HasScope reports whether the granted scopes include the required one, either directly or through admin.
+func HasScope(granted []Scope, required Scope) bool {
+	for _, scope := range granted {
+		if scope == required || scope == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScopes reports whether the granted scopes include every required one, so that a caller can only grant the
+// scopes it holds.
+func HasScopes(granted []Scope, required []Scope) bool {
+	for _, scope := range required {
+		if !HasScope(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
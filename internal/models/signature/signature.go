@@ -0,0 +1,151 @@
+// Package signature provides the signing of the webhook requests sent by the gateway and their verification by the
+// services receiving them.
+//
+// The Gateway-Signature header of a request has the form "t=<timestamp>,v1=<signature>", where the timestamp is the
+// Unix time the request was signed and each v1 signature is the hex encoded HMAC-SHA256 of the timestamp, a dot
+// and the body, keyed with one of the signing secrets of the merchant. While a secret is being rotated the header
+// carries a signature for every active secret, so receivers keep verifying requests until they switch secrets.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// Header is the header carrying the signature of a webhook request.
+const Header = "Gateway-Signature"
+
+// DefaultTolerance is the age after which a signed request is rejected as a replay.
+const DefaultTolerance = 5 * time.Minute
+
+// Keys of the elements of the signature header.
+const (
+	timestampKey = "t"
+	signatureKey = "v1"
+)
+
+var (
+	// ErrMissingHeader is returned when a request has no signature header.
+	ErrMissingHeader = errors.New("missing signature header")
+
+	// ErrInvalidHeader is returned when the signature header has no timestamp or no v1 signature.
+	ErrInvalidHeader = errors.New("invalid signature header")
+
+	// ErrOutsideTolerance is returned when a request was signed longer than the tolerance ago, or in the future.
+	ErrOutsideTolerance = errors.New("signature timestamp is outside the tolerance window")
+
+	// ErrSignatureMismatch is returned when no signature of the header was computed with one of the secrets.
+	ErrSignatureMismatch = errors.New("no signature matches the body")
+
+	// ErrNoSigningSecrets is returned when there are no secrets to sign or verify a request with.
+	ErrNoSigningSecrets = errors.New("no signing secrets")
+)
+
+// Sign returns the signature header of a request body signed at the given time with every given secret.
+func Sign(body []byte, timestamp time.Time, secrets ...string) (string, error) {
+	if len(secrets) == 0 {
+		return "", ErrNoSigningSecrets
+	}
+
+	unix := timestamp.Unix()
+	elements := []string{timestampKey + "=" + strconv.FormatInt(unix, 10)}
+	for _, secret := range secrets {
+		elements = append(elements, signatureKey+"="+hex.EncodeToString(compute(secret, unix, body)))
+	}
+	return strings.Join(elements, ","), nil
+}
+
+// Verify checks that the signature header was computed over the body with one of the given secrets and that it was
+// signed within the tolerance of the current time, rejecting replays of older requests.
+func Verify(header string, body []byte, tolerance time.Duration, secrets ...string) error {
+	if header == "" {
+		return ErrMissingHeader
+	}
+	if len(secrets) == 0 {
+		return ErrNoSigningSecrets
+	}
+
+	timestamp, signatures, err := parse(header)
+	if err != nil {
+		return err
+	}
+
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrOutsideTolerance
+	}
+
+	for _, secret := range secrets {
+		expected := compute(secret, timestamp, body)
+		for _, signature := range signatures {
+			if hmac.Equal(expected, signature) {
+				return nil
+			}
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+// VerifyEvent verifies the signature of a webhook request body and decodes the event it carries.
+// The data of the event can then be decoded into the event of its type, such as a models.PaymentSucceeded.
+func VerifyEvent(header string, body []byte, tolerance time.Duration, secrets ...string) (models.WebhookEvent, error) {
+	if err := Verify(header, body, tolerance, secrets...); err != nil {
+		return models.WebhookEvent{}, err
+	}
+
+	var event models.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return models.WebhookEvent{}, err
+	}
+	return event, nil
+}
+
+// parse extracts the timestamp and the v1 signatures of a signature header. Elements with other keys are ignored,
+// so that signatures of future schemes can be added to the header.
+func parse(header string) (int64, [][]byte, error) {
+	var timestamp int64
+	var signatures [][]byte
+	for _, element := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(element), "=")
+		if !found {
+			return 0, nil, ErrInvalidHeader
+		}
+
+		switch key {
+		case timestampKey:
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, nil, ErrInvalidHeader
+			}
+			timestamp = parsed
+		case signatureKey:
+			signature, err := hex.DecodeString(value)
+			if err != nil {
+				return 0, nil, ErrInvalidHeader
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return 0, nil, ErrInvalidHeader
+	}
+	return timestamp, signatures, nil
+}
+
+// compute returns the HMAC-SHA256 of the timestamp and the body keyed with the secret.
+func compute(secret string, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,114 @@
+package signature
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var body = []byte(`{"id":42,"type":"payment.succeeded","data":{}}`)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		signedAt    time.Time
+		signWith    []string
+		verifyWith  []string
+		body        []byte
+		tolerance   time.Duration
+		expectedErr error
+		signErr     error
+	}{
+		{name: "round trip", signedAt: now, signWith: []string{"current"}, verifyWith: []string{"current"}},
+		{name: "within the tolerance", signedAt: now.Add(-4 * time.Minute), signWith: []string{"current"}, verifyWith: []string{"current"}},
+		{name: "older than the tolerance", signedAt: now.Add(-6 * time.Minute), signWith: []string{"current"}, verifyWith: []string{"current"}, expectedErr: ErrOutsideTolerance},
+		{name: "in the future beyond the tolerance", signedAt: now.Add(6 * time.Minute), signWith: []string{"current"}, verifyWith: []string{"current"}, expectedErr: ErrOutsideTolerance},
+		{name: "custom tolerance", signedAt: now.Add(-time.Minute), signWith: []string{"current"}, verifyWith: []string{"current"}, tolerance: 30 * time.Second, expectedErr: ErrOutsideTolerance},
+		{name: "receiver still on the previous secret", signedAt: now, signWith: []string{"next", "current"}, verifyWith: []string{"current"}},
+		{name: "receiver already on the next secret", signedAt: now, signWith: []string{"next", "current"}, verifyWith: []string{"next"}},
+		{name: "receiver accepting both secrets", signedAt: now, signWith: []string{"current"}, verifyWith: []string{"next", "current"}},
+		{name: "wrong secret", signedAt: now, signWith: []string{"current"}, verifyWith: []string{"other"}, expectedErr: ErrSignatureMismatch},
+		{name: "tampered body", signedAt: now, signWith: []string{"current"}, verifyWith: []string{"current"}, body: []byte(`{"id":43}`), expectedErr: ErrSignatureMismatch},
+		{name: "no verification secrets", signedAt: now, signWith: []string{"current"}, expectedErr: ErrNoSigningSecrets},
+		{name: "no signing secrets", signedAt: now, signErr: ErrNoSigningSecrets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := Sign(body, tt.signedAt, tt.signWith...)
+			if !errors.Is(err, tt.signErr) {
+				t.Fatalf("expected signing error %v, got %v", tt.signErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if count := strings.Count(header, signatureKey+"="); count != len(tt.signWith) {
+				t.Fatalf("expected %d v1 signatures, got %d in %q", len(tt.signWith), count, header)
+			}
+
+			verified := body
+			if tt.body != nil {
+				verified = tt.body
+			}
+			tolerance := DefaultTolerance
+			if tt.tolerance != 0 {
+				tolerance = tt.tolerance
+			}
+			if err := Verify(header, verified, tolerance, tt.verifyWith...); !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMalformedHeaders(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	valid, err := Sign(body, time.Now(), "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := strings.SplitN(valid, ",", 2)[1]
+
+	tests := []struct {
+		name        string
+		header      string
+		expectedErr error
+	}{
+		{name: "empty", header: "", expectedErr: ErrMissingHeader},
+		{name: "no timestamp", header: signature, expectedErr: ErrInvalidHeader},
+		{name: "no signature", header: "t=" + timestamp, expectedErr: ErrInvalidHeader},
+		{name: "element without value", header: "t=" + timestamp + "," + signature + ",v1", expectedErr: ErrInvalidHeader},
+		{name: "non numeric timestamp", header: "t=yesterday," + signature, expectedErr: ErrInvalidHeader},
+		{name: "non hex signature", header: "t=" + timestamp + ",v1=not-hex", expectedErr: ErrInvalidHeader},
+		{name: "garbage", header: "garbage", expectedErr: ErrInvalidHeader},
+		{name: "unknown schemes are ignored", header: valid + ",v0=deadbeef"},
+		{name: "spaces around elements", header: strings.ReplaceAll(valid, ",", ", ")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.header, body, DefaultTolerance, "current"); !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyEventDecodesTheEvent(t *testing.T) {
+	header, err := Sign(body, time.Now(), "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := VerifyEvent(header, body, DefaultTolerance, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != 42 || event.Type != "payment.succeeded" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
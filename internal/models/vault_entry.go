@@ -0,0 +1,17 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// VaultEntry represents an encrypted card number stored in the card vault behind its token.
+// The card number is encrypted with its own data key, which is in turn encrypted with the key-encryption key
+// identified by KeyID.
+type VaultEntry struct {
+	gorm.Model        // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	Token      string `gorm:"not null;uniqueIndex" json:"token"`
+	KeyID      string `gorm:"not null;index" json:"key_id"`
+	WrappedKey []byte `gorm:"not null" json:"-"`
+	Ciphertext []byte `gorm:"not null" json:"-"`
+}
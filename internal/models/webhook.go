@@ -0,0 +1,109 @@
+// Package models provides data models used throughout the application.
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookDeliveryStatus represents the status of the delivery of an event to a webhook endpoint.
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookEndpoint represents a URL registered by a merchant to be notified of its payment and refund events.
+// EventTypes is the comma separated list of event types the endpoint subscribed to, where empty means every type.
+type WebhookEndpoint struct {
+	gorm.Model        // Embedded gorm.Model for ID, created_at, updated_at, deleted_at fields.
+	MerchantID uint   `gorm:"not null;index" json:"merchant_id"`
+	URL        string `gorm:"not null" json:"url"`
+	EventTypes string `gorm:"not null" json:"event_types"`
+}
+
+// WebhookSecret represents a secret the webhook requests sent to the endpoints of a merchant are signed with.
+// A secret without expiration is the current one, and rotating it sets the expiration of the previous secrets so
+// that requests are signed with both until the merchant switches to the new one.
+type WebhookSecret struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	MerchantID uint       `gorm:"not null;index" json:"merchant_id"`
+	Secret     string     `gorm:"not null" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery represents the delivery of an event to a webhook endpoint, which is kept as the delivery log.
+// A delivery is attempted until the endpoint responds with a 2xx status or the attempts run out. Redelivery numbers
+// the manual redeliveries of the same event to the endpoint, the delivery dispatched for the event being 0. EventID
+// is the ID of the event sent, which is also the id of the WebhookEvent in the payload.
+type WebhookDelivery struct {
+	ID                 uint                  `gorm:"primaryKey" json:"id"`
+	EndpointID         uint                  `gorm:"not null;uniqueIndex:idx_webhook_deliveries_event,priority:1" json:"endpoint_id"`
+	EventID            uint                  `gorm:"not null;uniqueIndex:idx_webhook_deliveries_event,priority:2" json:"event_id"`
+	Redelivery         int                   `gorm:"not null;uniqueIndex:idx_webhook_deliveries_event,priority:3" json:"redelivery"`
+	MerchantID         uint                  `gorm:"not null;index" json:"merchant_id"`
+	EventType          EventType             `gorm:"not null" json:"event_type"`
+	Payload            json.RawMessage       `gorm:"type:text;not null" json:"payload"`
+	Status             WebhookDeliveryStatus `gorm:"not null;index:idx_webhook_deliveries_due,priority:1" json:"status"`
+	Attempts           int                   `gorm:"not null" json:"attempts"`
+	NextAttemptAt      time.Time             `gorm:"not null;index:idx_webhook_deliveries_due,priority:2" json:"next_attempt_at"`
+	LastResponseStatus int                   `json:"last_response_status"`
+	LastError          string                `json:"last_error"`
+	DeliveredAt        *time.Time            `json:"delivered_at"`
+	CreatedAt          time.Time             `json:"created_at"`
+	UpdatedAt          time.Time             `json:"updated_at"`
+}
+
+// WebhookEvent is the body of the requests sent to webhook endpoints.
+// Data holds the event of the given type, such as a PaymentSucceeded for payment.succeeded.
+type WebhookEvent struct {
+	ID        uint            `json:"id"`
+	Type      EventType       `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// IsActive reports whether the secret has not expired at the given time.
+func (w WebhookSecret) IsActive(now time.Time) bool {
+	return w.ExpiresAt == nil || w.ExpiresAt.After(now)
+}
+
+// SubscribedEventTypes returns the event types the endpoint subscribed to, or every event type when it lists none.
+func (w WebhookEndpoint) SubscribedEventTypes() []EventType {
+	var eventTypes []EventType
+	for _, eventType := range strings.Split(w.EventTypes, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			eventTypes = append(eventTypes, EventType(eventType))
+		}
+	}
+	if len(eventTypes) == 0 {
+		return EventTypes
+	}
+	return eventTypes
+}
+
+// Subscribes reports whether the endpoint subscribed to the given event type.
+func (w WebhookEndpoint) Subscribes(eventType EventType) bool {
+	for _, subscribed := range w.SubscribedEventTypes() {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEventType reports whether the given type is a type of domain event.
+func IsEventType(eventType EventType) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
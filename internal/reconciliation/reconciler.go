@@ -0,0 +1,285 @@
+// Package reconciliation provides the reconciliation of the payments and refunds left pending, and of the payments
+// left capturing or cancelling, when the outcome of their acquiring bank call was unknown.
+package reconciliation
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/bank"
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+)
+
+// Define custom error messages
+var (
+	errTransactionNotReceived = errors.New("acquiring bank did not receive the transaction")
+)
+
+// Repository defines the storage of the pending payments and refunds.
+type Repository interface {
+	// GetUnsettledPayments retrieves up to limit payments with an ID greater than the given one that are pending,
+	// capturing or cancelling since before the given time, in ID order.
+	GetUnsettledPayments(afterID uint, before time.Time, limit int) ([]models.Payment, error)
+
+	// UpdatePayment saves every field of an existing payment, provided its stored status is still the given one.
+	UpdatePayment(payment *models.Payment, from models.PaymentStatus) error
+
+	// GetPendingRefunds retrieves up to limit refunds with an ID greater than the given one that are pending since
+	// before the given time, in ID order.
+	GetPendingRefunds(afterID uint, before time.Time, limit int) ([]models.Refund, error)
+
+	// GetPaymentOfRefund retrieves the payment a refund belongs to.
+	GetPaymentOfRefund(refund models.Refund) (models.Payment, error)
+
+	// SettleRefund stores the final status of a pending refund, returning the updated payment.
+	SettleRefund(refund *models.Refund, status models.RefundStatus) (models.Payment, error)
+}
+
+// Reconciler settles the payments and refunds left pending, and the payments left capturing or cancelling, after a
+// bank call failed without a known outcome, with the outcome the acquiring bank reports for the reference of the
+// call. A payment or refund the bank never received is failed, a capture or void it never received or declined
+// leaves the payment authorized, and a transaction the bank cannot be asked about yet is left until the next run.
+type Reconciler struct {
+	repository  Repository
+	acquirers   *bank.Registry
+	audit       *audit.Logger
+	interval    time.Duration
+	gracePeriod time.Duration
+	batchSize   int
+	logger      *slog.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewReconciler creates a new instance of Reconciler with the provided repository, acquirers, audit logger and
+// reconciliation configuration.
+func NewReconciler(repository Repository, acquirers *bank.Registry, auditLogger *audit.Logger, config config.Application, logger *slog.Logger) *Reconciler {
+	return &Reconciler{
+		repository:  repository,
+		acquirers:   acquirers,
+		audit:       auditLogger,
+		interval:    config.Reconciliation.Interval,
+		gracePeriod: config.Reconciliation.GracePeriod,
+		batchSize:   config.Reconciliation.BatchSize,
+		logger:      logger,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start starts reconciling the unsettled payments and the pending refunds on schedule.
+func (r *Reconciler) Start() {
+	r.logger.Info("Starting reconciler")
+
+	r.wg.Add(1)
+	go r.schedule()
+}
+
+// Stop stops the reconciler, waiting for the transactions being reconciled.
+func (r *Reconciler) Stop() {
+	r.logger.Info("Stopping reconciler")
+
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// schedule reconciles every interval until the reconciler is stopped.
+func (r *Reconciler) schedule() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-r.gracePeriod)
+			r.reconcilePayments(before)
+			r.reconcileRefunds(before)
+		}
+	}
+}
+
+// reconcilePayments reconciles the payments unsettled since before the given time, batch after batch.
+func (r *Reconciler) reconcilePayments(before time.Time) {
+	var afterID uint
+	for {
+		payments, err := r.repository.GetUnsettledPayments(afterID, before, r.batchSize)
+		if err != nil {
+			r.logger.Error(err.Error())
+			return
+		}
+
+		for _, payment := range payments {
+			r.reconcilePayment(payment)
+			afterID = payment.ID
+		}
+
+		if len(payments) < r.batchSize || r.stopped() {
+			return
+		}
+	}
+}
+
+// reconcileRefunds reconciles the refunds pending since before the given time, batch after batch.
+func (r *Reconciler) reconcileRefunds(before time.Time) {
+	var afterID uint
+	for {
+		refunds, err := r.repository.GetPendingRefunds(afterID, before, r.batchSize)
+		if err != nil {
+			r.logger.Error(err.Error())
+			return
+		}
+
+		for _, refund := range refunds {
+			r.reconcileRefund(refund)
+			afterID = refund.ID
+		}
+
+		if len(refunds) < r.batchSize || r.stopped() {
+			return
+		}
+	}
+}
+
+// reconcilePayment moves an unsettled payment to the status matching the outcome reported by its acquiring bank for
+// its last call, which is the payment itself while it is pending and its capture or void otherwise.
+// A payment settled by another request meanwhile is left as it is.
+func (r *Reconciler) reconcilePayment(payment models.Payment) {
+	reference := payment.Reference()
+	if payment.Status != models.Pending {
+		reference = payment.BankReference
+	}
+
+	status, err := r.transactionStatus(payment.Processor, reference)
+	if err != nil {
+		r.logger.Error(err.Error(), slog.Uint64("payment_id", uint64(payment.ID)))
+		return
+	}
+
+	unsettled := payment
+	settlePayment(&payment, status)
+
+	if err := r.repository.UpdatePayment(&payment, unsettled.Status); err != nil {
+		if errors.Is(err, storage.ErrPaymentStatusConflict) {
+			r.logger.Info("Payment was settled meanwhile", slog.Uint64("payment_id", uint64(payment.ID)))
+			return
+		}
+		r.logger.Error(err.Error(), slog.Uint64("payment_id", uint64(payment.ID)))
+		return
+	}
+	r.logger.Info("Payment reconciled", slog.Uint64("payment_id", uint64(payment.ID)), slog.String("status", payment.Status.String()))
+
+	r.recordAudit(audit.Event{
+		MerchantID: payment.MerchantID,
+		Action:     audit.PaymentReconciled,
+		PaymentID:  payment.ID,
+		Before:     unsettled,
+		After:      payment,
+	})
+}
+
+// settlePayment moves an unsettled payment to the status matching the outcome the acquiring bank reported for its
+// last call. A pending payment is failed unless the bank approved it, and a capturing or cancelling payment is
+// authorized again unless the bank captured or voided it.
+func settlePayment(payment *models.Payment, status bank.StatusResponse) {
+	payment.BankMessage = status.Message
+	if !status.Found {
+		payment.BankMessage = errTransactionNotReceived.Error()
+	}
+	approved := status.Found && status.Success
+
+	switch {
+	case payment.Status == models.Capturing && approved:
+		payment.Status = models.Processed
+	case payment.Status == models.Cancelling && approved:
+		payment.Status = models.Cancelled
+	case payment.Status == models.Capturing || payment.Status == models.Cancelling:
+		payment.Status = models.Authorized
+		payment.CapturedAmount = models.NewMoney(0, payment.Currency)
+	case !approved:
+		payment.Status = models.Failed
+	case status.Operation == bank.OperationAuthorize:
+		payment.Status = models.Authorized
+		payment.AuthorizationCode = status.AuthorizationCode
+	default:
+		payment.Status = models.Succeeded
+		payment.AuthorizationCode = status.AuthorizationCode
+	}
+}
+
+// reconcileRefund settles a pending refund with the outcome reported by the acquiring bank of its payment.
+// A refund settled by another request meanwhile is left as it is.
+func (r *Reconciler) reconcileRefund(refund models.Refund) {
+	payment, err := r.repository.GetPaymentOfRefund(refund)
+	if err != nil {
+		r.logger.Error(err.Error(), slog.Uint64("refund_id", uint64(refund.ID)))
+		return
+	}
+
+	status, err := r.transactionStatus(payment.Processor, refund.Reference())
+	if err != nil {
+		r.logger.Error(err.Error(), slog.Uint64("refund_id", uint64(refund.ID)))
+		return
+	}
+
+	refundStatus := models.RefundFailed
+	if status.Found && status.Success {
+		refundStatus = models.RefundSucceeded
+	}
+
+	pending := refund
+	if _, err := r.repository.SettleRefund(&refund, refundStatus); err != nil {
+		if errors.Is(err, storage.ErrRefundAlreadySettled) {
+			r.logger.Info("Refund was settled meanwhile", slog.Uint64("refund_id", uint64(refund.ID)))
+			return
+		}
+		r.logger.Error(err.Error(), slog.Uint64("refund_id", uint64(refund.ID)))
+		return
+	}
+	r.logger.Info("Refund reconciled", slog.Uint64("refund_id", uint64(refund.ID)), slog.String("status", refund.Status.String()))
+
+	r.recordAudit(audit.Event{
+		MerchantID: payment.MerchantID,
+		Action:     audit.RefundSettled,
+		PaymentID:  refund.PaymentID,
+		RefundID:   refund.ID,
+		Before:     pending,
+		After:      refund,
+	})
+}
+
+// transactionStatus asks the acquiring bank of the processor for the outcome of the transaction with the reference.
+func (r *Reconciler) transactionStatus(processor string, reference string) (bank.StatusResponse, error) {
+	acquirer, err := r.acquirers.Get(processor)
+	if err != nil {
+		return bank.StatusResponse{}, err
+	}
+	return acquirer.GetTransactionStatus(bank.StatusRequest{Reference: reference})
+}
+
+// recordAudit records a change made by the reconciliation in the audit trail.
+// The change already happened, so a failure to record it is logged.
+func (r *Reconciler) recordAudit(event audit.Event) {
+	event.Actor = audit.ReconciliationActor
+	if err := r.audit.Record(event); err != nil {
+		r.logger.Error(err.Error())
+	}
+}
+
+// stopped reports whether the reconciler was asked to stop.
+func (r *Reconciler) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,51 @@
+package reconciliation
+
+import (
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/bank"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+func TestSettlePayment(t *testing.T) {
+	approved := func(operation string) bank.StatusResponse {
+		return bank.StatusResponse{PaymentResponse: bank.PaymentResponse{Success: true}, Found: true, Operation: operation}
+	}
+	declined := bank.StatusResponse{Found: true}
+	notFound := bank.StatusResponse{}
+
+	tests := []struct {
+		name   string
+		from   models.PaymentStatus
+		status bank.StatusResponse
+		want   models.PaymentStatus
+	}{
+		{name: "processed payment", from: models.Pending, status: approved(bank.OperationProcess), want: models.Succeeded},
+		{name: "authorized payment", from: models.Pending, status: approved(bank.OperationAuthorize), want: models.Authorized},
+		{name: "declined payment", from: models.Pending, status: declined, want: models.Failed},
+		{name: "payment not received", from: models.Pending, status: notFound, want: models.Failed},
+		{name: "captured", from: models.Capturing, status: approved(bank.OperationCapture), want: models.Processed},
+		{name: "capture declined", from: models.Capturing, status: declined, want: models.Authorized},
+		{name: "capture not received", from: models.Capturing, status: notFound, want: models.Authorized},
+		{name: "voided", from: models.Cancelling, status: approved(bank.OperationVoid), want: models.Cancelled},
+		{name: "void declined", from: models.Cancelling, status: declined, want: models.Authorized},
+		{name: "void not received", from: models.Cancelling, status: notFound, want: models.Authorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := models.Payment{Status: tt.from, Currency: "USD", CapturedAmount: models.NewMoney(500, "USD")}
+			settlePayment(&payment, tt.status)
+
+			if payment.Status != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, payment.Status)
+			}
+			if err := tt.from.ValidateTransition(payment.Status); err != nil {
+				t.Fatal(err)
+			}
+			if payment.Status == models.Authorized && tt.from != models.Pending && !payment.CapturedAmount.IsZero() {
+				t.Fatalf("expected an authorized payment to have nothing captured, got %v", payment.CapturedAmount)
+			}
+		})
+	}
+}
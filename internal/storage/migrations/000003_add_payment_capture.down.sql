@@ -0,0 +1,3 @@
+ALTER TABLE `payments`
+  DROP COLUMN `captured_amount`,
+  DROP COLUMN `authorization_code`;
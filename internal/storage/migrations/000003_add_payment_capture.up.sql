@@ -0,0 +1,3 @@
+ALTER TABLE `payments`
+  ADD COLUMN `captured_amount` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  ADD COLUMN `authorization_code` VARCHAR(100);
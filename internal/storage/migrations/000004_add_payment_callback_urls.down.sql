@@ -0,0 +1,5 @@
+ALTER TABLE `payments`
+  DROP COLUMN `callback_success`,
+  DROP COLUMN `callback_reject`,
+  DROP COLUMN `callback_cancelled`,
+  DROP COLUMN `callback_failed`;
@@ -0,0 +1,5 @@
+ALTER TABLE `payments`
+  ADD COLUMN `callback_success` VARCHAR(255),
+  ADD COLUMN `callback_reject` VARCHAR(255),
+  ADD COLUMN `callback_cancelled` VARCHAR(255),
+  ADD COLUMN `callback_failed` VARCHAR(255);
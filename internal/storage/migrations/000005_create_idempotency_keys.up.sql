@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `merchant_id` INT NOT NULL,
+  `key` VARCHAR(255) NOT NULL,
+  `request_hash` VARCHAR(64) NOT NULL,
+  `completed` BOOLEAN NOT NULL DEFAULT FALSE,
+  `status_code` INT,
+  `response_body` TEXT,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `deleted_at` TIMESTAMP,
+  UNIQUE KEY `idx_merchant_key` (`merchant_id`, `key`),
+  FOREIGN KEY (merchant_id) REFERENCES merchants(id)
+);
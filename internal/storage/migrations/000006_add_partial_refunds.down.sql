@@ -0,0 +1,7 @@
+ALTER TABLE `refunds`
+  DROP COLUMN `status`;
+
+UPDATE `payments` SET `status` = 'refunded' WHERE `status` = 'partially_refunded';
+
+ALTER TABLE `payments`
+  MODIFY `status` ENUM('pending', 'succeeded', 'failed', 'cancelled', 'refunded', 'processed', 'authorized') NOT NULL DEFAULT 'pending';
@@ -0,0 +1,6 @@
+ALTER TABLE `payments`
+  MODIFY `status` ENUM('pending', 'succeeded', 'failed', 'cancelled', 'refunded', 'processed', 'authorized', 'partially_refunded') NOT NULL DEFAULT 'pending';
+
+ALTER TABLE `refunds`
+  ADD COLUMN `status` ENUM('pending', 'succeeded', 'failed') NOT NULL DEFAULT 'succeeded',
+  ADD INDEX `idx_refunds_payment_status` (`payment_id`, `status`);
@@ -0,0 +1,17 @@
+ALTER TABLE `payments`
+  MODIFY `amount` DECIMAL(20, 2) NOT NULL,
+  MODIFY `captured_amount` DECIMAL(20, 2) NOT NULL DEFAULT 0;
+
+UPDATE `payments` SET `amount` = `amount` / 100, `captured_amount` = `captured_amount` / 100;
+
+ALTER TABLE `payments`
+  MODIFY `amount` DECIMAL(10, 2) NOT NULL,
+  MODIFY `captured_amount` DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+ALTER TABLE `refunds`
+  MODIFY `amount` DECIMAL(20, 2) NOT NULL;
+
+UPDATE `refunds` SET `amount` = `amount` / 100;
+
+ALTER TABLE `refunds`
+  MODIFY `amount` DECIMAL(10, 2) NOT NULL;
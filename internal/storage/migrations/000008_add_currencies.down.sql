@@ -0,0 +1,8 @@
+ALTER TABLE `merchants`
+  DROP COLUMN `currencies`;
+
+ALTER TABLE `refunds`
+  DROP COLUMN `currency`;
+
+ALTER TABLE `payments`
+  DROP COLUMN `currency`;
@@ -0,0 +1,8 @@
+ALTER TABLE `payments`
+  ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE `refunds`
+  ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE `merchants`
+  ADD COLUMN `currencies` VARCHAR(255) NOT NULL DEFAULT 'USD';
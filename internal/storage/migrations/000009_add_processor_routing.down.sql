@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS `routing_rules`;
+
+ALTER TABLE `payments`
+  DROP COLUMN `processor`;
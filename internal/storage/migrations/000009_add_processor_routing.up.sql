@@ -0,0 +1,17 @@
+ALTER TABLE `payments`
+  ADD COLUMN `processor` VARCHAR(100);
+
+CREATE TABLE IF NOT EXISTS `routing_rules` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `processor` VARCHAR(100) NOT NULL,
+  `priority` INT NOT NULL DEFAULT 0,
+  `merchant_id` INT NOT NULL DEFAULT 0,
+  `card_brand` VARCHAR(100),
+  `currency` CHAR(3),
+  `min_amount` BIGINT NOT NULL DEFAULT 0,
+  `max_amount` BIGINT NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `deleted_at` TIMESTAMP,
+  INDEX `idx_routing_rules_merchant_priority` (`merchant_id`, `priority`)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `vault_entries` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `token` VARCHAR(64) NOT NULL,
+  `key_id` VARCHAR(64) NOT NULL,
+  `wrapped_key` VARBINARY(128) NOT NULL,
+  `ciphertext` VARBINARY(128) NOT NULL,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `deleted_at` TIMESTAMP,
+  UNIQUE KEY `idx_vault_entries_token` (`token`),
+  INDEX `idx_vault_entries_key_id` (`key_id`)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE `credit_cards`
+  DROP INDEX `idx_customer_fingerprint`,
+  DROP COLUMN `fingerprint`;
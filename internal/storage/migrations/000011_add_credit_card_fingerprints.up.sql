@@ -0,0 +1,3 @@
+ALTER TABLE `credit_cards`
+  ADD COLUMN `fingerprint` VARCHAR(64) NOT NULL DEFAULT '',
+  ADD INDEX `idx_customer_fingerprint` (`customer_id`, `fingerprint`);
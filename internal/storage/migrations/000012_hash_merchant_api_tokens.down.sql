@@ -0,0 +1,4 @@
+-- API keys cannot be recovered from their hashes, so the stored tokens stay hashed.
+ALTER TABLE `merchants`
+  DROP INDEX `idx_merchants_api_token`,
+  MODIFY COLUMN `api_token` VARCHAR(100) NOT NULL;
@@ -0,0 +1,6 @@
+UPDATE `merchants`
+  SET `api_token` = SHA2(TRIM(BOTH '\n' FROM TRIM(`api_token`)), 256);
+
+ALTER TABLE `merchants`
+  MODIFY COLUMN `api_token` CHAR(64) NOT NULL,
+  ADD UNIQUE KEY `idx_merchants_api_token` (`api_token`);
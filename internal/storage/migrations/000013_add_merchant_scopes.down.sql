@@ -0,0 +1,2 @@
+ALTER TABLE `merchants`
+  DROP COLUMN `scopes`;
@@ -0,0 +1,2 @@
+ALTER TABLE `merchants`
+  ADD COLUMN `scopes` VARCHAR(255) NOT NULL DEFAULT 'payments:write payments:read refunds:write';
@@ -0,0 +1,3 @@
+ALTER TABLE `merchants`
+  DROP COLUMN `payment_rate_limit`,
+  DROP COLUMN `read_rate_limit`;
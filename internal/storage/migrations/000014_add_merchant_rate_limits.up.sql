@@ -0,0 +1,3 @@
+ALTER TABLE `merchants`
+  ADD COLUMN `payment_rate_limit` INT NOT NULL DEFAULT 0,
+  ADD COLUMN `read_rate_limit` INT NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS `audit_entries` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `sequence` BIGINT UNSIGNED NOT NULL,
+  `occurred_at` DATETIME(6) NOT NULL,
+  `actor` VARCHAR(128) NOT NULL,
+  `merchant_id` INT NOT NULL,
+  `action` VARCHAR(64) NOT NULL,
+  `payment_id` INT NOT NULL,
+  `refund_id` INT NOT NULL DEFAULT 0,
+  `before` TEXT,
+  `after` TEXT,
+  `previous_hash` CHAR(64) NOT NULL,
+  `hash` CHAR(64) NOT NULL,
+  UNIQUE KEY `idx_audit_entries_sequence` (`sequence`),
+  INDEX `idx_audit_entries_occurred_at` (`occurred_at`),
+  INDEX `idx_audit_entries_actor` (`actor`),
+  INDEX `idx_audit_entries_merchant_id` (`merchant_id`),
+  INDEX `idx_audit_entries_action` (`action`),
+  INDEX `idx_audit_entries_payment_id` (`payment_id`)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `messages` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `type` VARCHAR(64) NOT NULL,
+  `merchant_id` INT NOT NULL,
+  `payment_id` INT NOT NULL,
+  `payload` TEXT NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `delivered_at` TIMESTAMP NULL,
+  `last_error` TEXT,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_messages_type` (`type`),
+  INDEX `idx_messages_payment_id` (`payment_id`),
+  INDEX `idx_messages_pending` (`delivered_at`, `next_attempt_at`)
+);
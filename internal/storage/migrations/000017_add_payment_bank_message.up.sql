@@ -0,0 +1,2 @@
+ALTER TABLE `payments`
+  ADD COLUMN `bank_message` VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `outbox_entries` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `type` VARCHAR(64) NOT NULL,
+  `merchant_id` INT NOT NULL,
+  `payment_id` INT NOT NULL,
+  `payload` TEXT NOT NULL,
+  `sent_at` TIMESTAMP NULL,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_outbox_entries_payment_id` (`payment_id`),
+  INDEX `idx_outbox_entries_sent_at` (`sent_at`)
+);
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS `webhook_endpoints` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `merchant_id` INT NOT NULL,
+  `url` VARCHAR(2048) NOT NULL,
+  `secret` VARCHAR(100) NOT NULL,
+  `event_types` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `deleted_at` TIMESTAMP NULL,
+  INDEX `idx_webhook_endpoints_merchant_id` (`merchant_id`),
+  FOREIGN KEY (`merchant_id`) REFERENCES `merchants`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `endpoint_id` INT NOT NULL,
+  `message_id` INT NOT NULL,
+  `redelivery` INT NOT NULL DEFAULT 0,
+  `merchant_id` INT NOT NULL,
+  `event_type` VARCHAR(64) NOT NULL,
+  `payload` TEXT NOT NULL,
+  `status` VARCHAR(20) NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_response_status` INT NOT NULL DEFAULT 0,
+  `last_error` TEXT,
+  `delivered_at` TIMESTAMP NULL,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE INDEX `idx_webhook_deliveries_event` (`endpoint_id`, `message_id`, `redelivery`),
+  INDEX `idx_webhook_deliveries_merchant_id` (`merchant_id`),
+  INDEX `idx_webhook_deliveries_due` (`status`, `next_attempt_at`),
+  FOREIGN KEY (`endpoint_id`) REFERENCES `webhook_endpoints`(`id`)
+);
@@ -0,0 +1,11 @@
+ALTER TABLE `webhook_endpoints` ADD COLUMN `secret` VARCHAR(100) NOT NULL DEFAULT '';
+
+UPDATE `webhook_endpoints` e
+SET e.`secret` = COALESCE((
+  SELECT s.`secret` FROM `webhook_secrets` s
+  WHERE s.`merchant_id` = e.`merchant_id`
+  ORDER BY s.`id` DESC
+  LIMIT 1
+), '');
+
+DROP TABLE IF EXISTS `webhook_secrets`;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `webhook_secrets` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `merchant_id` INT NOT NULL,
+  `secret` VARCHAR(100) NOT NULL,
+  `expires_at` TIMESTAMP NULL,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_webhook_secrets_merchant_id` (`merchant_id`),
+  FOREIGN KEY (`merchant_id`) REFERENCES `merchants`(`id`)
+);
+
+INSERT INTO `webhook_secrets` (`merchant_id`, `secret`, `created_at`)
+SELECT `merchant_id`, `secret`, `created_at` FROM `webhook_endpoints` WHERE `deleted_at` IS NULL;
+
+ALTER TABLE `webhook_endpoints` DROP COLUMN `secret`;
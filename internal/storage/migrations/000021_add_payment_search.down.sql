@@ -0,0 +1,13 @@
+ALTER TABLE `credit_cards`
+  DROP INDEX `idx_credit_cards_last_four`;
+
+ALTER TABLE `customers`
+  DROP INDEX `idx_customers_email`;
+
+ALTER TABLE `payments`
+  DROP FOREIGN KEY `fk_payments_credit_card`,
+  DROP INDEX `idx_payments_merchant_order_token`,
+  DROP INDEX `idx_payments_merchant_amount`,
+  DROP INDEX `idx_payments_merchant_status`,
+  DROP INDEX `idx_payments_merchant_created_at`,
+  DROP COLUMN `credit_card_id`;
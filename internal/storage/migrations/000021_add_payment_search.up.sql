@@ -0,0 +1,13 @@
+ALTER TABLE `payments`
+  ADD COLUMN `credit_card_id` INT NULL,
+  ADD CONSTRAINT `fk_payments_credit_card` FOREIGN KEY (`credit_card_id`) REFERENCES `credit_cards`(`id`),
+  ADD INDEX `idx_payments_merchant_created_at` (`merchant_id`, `created_at`, `id`),
+  ADD INDEX `idx_payments_merchant_status` (`merchant_id`, `status`, `created_at`),
+  ADD INDEX `idx_payments_merchant_amount` (`merchant_id`, `currency`, `amount`, `id`),
+  ADD INDEX `idx_payments_merchant_order_token` (`merchant_id`, `order_token`);
+
+ALTER TABLE `customers`
+  ADD INDEX `idx_customers_email` (`email`);
+
+ALTER TABLE `credit_cards`
+  ADD INDEX `idx_credit_cards_last_four` (`last_four`);
@@ -0,0 +1,3 @@
+ALTER TABLE `payments`
+  DROP INDEX `idx_payments_merchant_active_order_token`,
+  DROP COLUMN `active_order_token`;
@@ -0,0 +1,25 @@
+-- A merchant has a single active payment per order token. Failed and cancelled payments are not active, so the
+-- order can be paid again with a new payment. MySQL has no partial indexes, so the unique index covers a generated
+-- column holding the order token of active payments only.
+ALTER TABLE `payments`
+  ADD COLUMN `active_order_token` VARCHAR(100)
+    GENERATED ALWAYS AS (IF(`status` IN ('failed', 'cancelled'), NULL, `order_token`)) STORED;
+
+-- Orders charged more than once before the index existed keep their most advanced payment: a successful one before
+-- a pending one, and the latest among them. The order tokens of the other active payments are marked as duplicates
+-- so that the payments are kept and can still be found by ID.
+UPDATE `payments`
+  JOIN (
+    SELECT DISTINCT `duplicate`.`id`
+    FROM `payments` AS `duplicate`
+    JOIN `payments` AS `kept`
+      ON `kept`.`merchant_id` = `duplicate`.`merchant_id`
+      AND `kept`.`active_order_token` = `duplicate`.`active_order_token`
+      AND `kept`.`id` <> `duplicate`.`id`
+    WHERE (`duplicate`.`status` = 'pending' AND `kept`.`status` <> 'pending')
+      OR ((`duplicate`.`status` = 'pending') = (`kept`.`status` = 'pending') AND `kept`.`id` > `duplicate`.`id`)
+  ) AS `duplicates` ON `duplicates`.`id` = `payments`.`id`
+  SET `payments`.`order_token` = CONCAT(LEFT(`payments`.`order_token`, 78), '#duplicate-', `payments`.`id`);
+
+ALTER TABLE `payments`
+  ADD UNIQUE INDEX `idx_payments_merchant_active_order_token` (`merchant_id`, `active_order_token`);
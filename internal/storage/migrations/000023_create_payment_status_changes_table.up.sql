@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `payment_status_changes` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `payment_id` INT NOT NULL,
+  `status` ENUM('pending', 'succeeded', 'failed', 'cancelled', 'refunded', 'processed', 'authorized', 'partially_refunded') NOT NULL,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_payment_status_changes_payment_id` (`payment_id`),
+  FOREIGN KEY (`payment_id`) REFERENCES `payments`(`id`)
+);
+
+-- Earlier payments only have their current status in their history.
+INSERT INTO `payment_status_changes` (`payment_id`, `status`, `created_at`)
+SELECT `id`, `status`, `updated_at` FROM `payments`;
@@ -0,0 +1,3 @@
+ALTER TABLE `idempotency_keys`
+  DROP INDEX `idx_idempotency_keys_created_at`,
+  DROP COLUMN `locked_at`;
@@ -0,0 +1,3 @@
+ALTER TABLE `idempotency_keys`
+  ADD COLUMN `locked_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD INDEX `idx_idempotency_keys_created_at` (`created_at`);
@@ -0,0 +1,4 @@
+ALTER TABLE `refunds`
+  DROP INDEX `idx_refunds_status_created_at`;
+ALTER TABLE `payments`
+  DROP INDEX `idx_payments_status_created_at`;
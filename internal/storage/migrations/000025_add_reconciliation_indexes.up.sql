@@ -0,0 +1,5 @@
+-- Pending payments and refunds are looked up by age to be reconciled with the acquiring bank.
+ALTER TABLE `payments`
+  ADD INDEX `idx_payments_status_created_at` (`status`, `created_at`);
+ALTER TABLE `refunds`
+  ADD INDEX `idx_refunds_status_created_at` (`status`, `created_at`);
@@ -0,0 +1,7 @@
+ALTER TABLE `credit_cards`
+  DROP INDEX `idx_credit_cards_merchant_id`,
+  DROP COLUMN `merchant_id`;
+
+ALTER TABLE `customers`
+  DROP INDEX `idx_customers_merchant_id`,
+  DROP COLUMN `merchant_id`;
@@ -0,0 +1,23 @@
+-- Customers and their saved cards belong to the merchant that created them.
+ALTER TABLE `customers`
+  ADD COLUMN `merchant_id` INT NOT NULL DEFAULT 0 AFTER `id`,
+  ADD INDEX `idx_customers_merchant_id` (`merchant_id`);
+
+ALTER TABLE `credit_cards`
+  ADD COLUMN `merchant_id` INT NOT NULL DEFAULT 0 AFTER `id`,
+  ADD INDEX `idx_credit_cards_merchant_id` (`merchant_id`);
+
+-- Existing customers are given to the merchant of their first payment. Customers never charged keep no merchant
+-- and can no longer be used.
+UPDATE `customers`
+  JOIN (
+    SELECT `customer_id`, MIN(`id`) AS `payment_id`
+    FROM `payments`
+    GROUP BY `customer_id`
+  ) AS `first_payments` ON `first_payments`.`customer_id` = `customers`.`id`
+  JOIN `payments` ON `payments`.`id` = `first_payments`.`payment_id`
+  SET `customers`.`merchant_id` = `payments`.`merchant_id`;
+
+UPDATE `credit_cards`
+  JOIN `customers` ON `customers`.`id` = `credit_cards`.`customer_id`
+  SET `credit_cards`.`merchant_id` = `customers`.`merchant_id`;
@@ -0,0 +1,27 @@
+ALTER TABLE `merchants`
+  ADD COLUMN `api_token` CHAR(64) NULL,
+  ADD COLUMN `scopes` VARCHAR(255) NOT NULL DEFAULT 'payments:write payments:read refunds:write';
+
+-- Every merchant goes back to its oldest key that was not revoked.
+UPDATE `merchants`
+  JOIN (
+    SELECT `merchant_id`, MIN(`id`) AS `key_id`
+    FROM `merchant_api_keys`
+    WHERE `deleted_at` IS NULL
+    GROUP BY `merchant_id`
+  ) AS `first_keys` ON `first_keys`.`merchant_id` = `merchants`.`id`
+  JOIN `merchant_api_keys` ON `merchant_api_keys`.`id` = `first_keys`.`key_id`
+  SET
+    `merchants`.`api_token` = `merchant_api_keys`.`key_hash`,
+    `merchants`.`scopes` = TRIM(REPLACE(REPLACE(`merchant_api_keys`.`scopes`, 'api_keys:read', ''), 'api_keys:write', ''));
+
+-- Merchants without keys are given a random token nobody holds.
+UPDATE `merchants`
+  SET `api_token` = SHA2(UUID(), 256)
+  WHERE `api_token` IS NULL;
+
+ALTER TABLE `merchants`
+  MODIFY COLUMN `api_token` CHAR(64) NOT NULL,
+  ADD UNIQUE KEY `idx_merchants_api_token` (`api_token`);
+
+DROP TABLE IF EXISTS `merchant_api_keys`;
@@ -0,0 +1,31 @@
+-- A merchant can hold several API keys, each granted its own scopes.
+CREATE TABLE IF NOT EXISTS `merchant_api_keys` (
+  `id` INT PRIMARY KEY AUTO_INCREMENT,
+  `merchant_id` INT NOT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  `key_hash` CHAR(64) NOT NULL,
+  `scopes` VARCHAR(255) NOT NULL,
+  `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  `deleted_at` TIMESTAMP NULL,
+  UNIQUE INDEX `idx_merchant_api_keys_key_hash` (`key_hash`),
+  INDEX `idx_merchant_api_keys_merchant_id` (`merchant_id`),
+  FOREIGN KEY (`merchant_id`) REFERENCES `merchants`(`id`)
+);
+
+-- The existing key of every merchant becomes its first key. Keys that can create payments may also manage the
+-- keys of the merchant, so that merchants can issue new keys without operator help.
+INSERT INTO `merchant_api_keys` (`merchant_id`, `name`, `key_hash`, `scopes`, `created_at`, `updated_at`)
+SELECT
+  `id`,
+  'default',
+  `api_token`,
+  IF(CONCAT(' ', `scopes`, ' ') LIKE '% payments:write %', CONCAT(`scopes`, ' api_keys:read api_keys:write'), `scopes`),
+  NOW(),
+  NOW()
+FROM `merchants`;
+
+ALTER TABLE `merchants`
+  DROP INDEX `idx_merchants_api_token`,
+  DROP COLUMN `api_token`,
+  DROP COLUMN `scopes`;
@@ -0,0 +1,8 @@
+ALTER TABLE `outbox_entries`
+  DROP INDEX `idx_outbox_entries_unsent`,
+  DROP COLUMN `claimed_until`,
+  ADD INDEX `idx_outbox_entries_sent_at` (`sent_at`);
+
+ALTER TABLE `messages`
+  DROP INDEX `idx_messages_event_id`,
+  DROP COLUMN `event_id`;
@@ -0,0 +1,34 @@
+-- Messages are identified by the outbox entry they were relayed from, so that relaying an entry again does not
+-- store a second message. Messages stored before keep their own ID as event ID, which the webhook deliveries of
+-- their events already use.
+ALTER TABLE `messages`
+  ADD COLUMN `event_id` INT NULL AFTER `id`;
+
+UPDATE `messages` SET `event_id` = `id`;
+
+ALTER TABLE `messages`
+  MODIFY COLUMN `event_id` INT NOT NULL,
+  ADD UNIQUE INDEX `idx_messages_event_id` (`event_id`);
+
+-- Outbox entries not sent yet and the ones stored from now on are numbered after every existing message and entry,
+-- so that their event IDs do not collide with the ones of the messages stored before.
+SET @outbox_entry_offset = GREATEST(
+  (SELECT COALESCE(MAX(`id`), 0) FROM `messages`),
+  (SELECT COALESCE(MAX(`id`), 0) FROM `outbox_entries`)
+);
+
+UPDATE `outbox_entries`
+  SET `id` = `id` + @outbox_entry_offset
+  WHERE `sent_at` IS NULL
+  ORDER BY `id` DESC;
+
+SET @statement = CONCAT('ALTER TABLE `outbox_entries` AUTO_INCREMENT = ', @outbox_entry_offset * 2 + 1);
+PREPARE `renumber_outbox_entries` FROM @statement;
+EXECUTE `renumber_outbox_entries`;
+DEALLOCATE PREPARE `renumber_outbox_entries`;
+
+-- Relays claim the entries they publish so that several gateways do not publish the same entries.
+ALTER TABLE `outbox_entries`
+  ADD COLUMN `claimed_until` TIMESTAMP NULL AFTER `sent_at`,
+  DROP INDEX `idx_outbox_entries_sent_at`,
+  ADD INDEX `idx_outbox_entries_unsent` (`sent_at`, `claimed_until`);
@@ -0,0 +1,2 @@
+ALTER TABLE `webhook_deliveries`
+  CHANGE COLUMN `event_id` `message_id` INT NOT NULL;
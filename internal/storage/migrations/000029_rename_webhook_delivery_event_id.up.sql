@@ -0,0 +1,3 @@
+-- Deliveries are keyed on the ID of the event they send, which is the event ID of its message.
+ALTER TABLE `webhook_deliveries`
+  CHANGE COLUMN `message_id` `event_id` INT NOT NULL;
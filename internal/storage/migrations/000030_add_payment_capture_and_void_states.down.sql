@@ -0,0 +1,14 @@
+ALTER TABLE `payments`
+  DROP INDEX `idx_payments_status_updated_at`,
+  ADD INDEX `idx_payments_status_created_at` (`status`, `created_at`);
+
+DELETE FROM `payment_status_changes` WHERE `status` IN ('capturing', 'cancelling');
+
+ALTER TABLE `payment_status_changes`
+  MODIFY `status` ENUM('pending', 'succeeded', 'failed', 'cancelled', 'refunded', 'processed', 'authorized', 'partially_refunded') NOT NULL;
+
+UPDATE `payments` SET `status` = 'authorized', `captured_amount` = 0 WHERE `status` IN ('capturing', 'cancelling');
+
+ALTER TABLE `payments`
+  DROP COLUMN `bank_reference`,
+  MODIFY `status` ENUM('pending', 'succeeded', 'failed', 'cancelled', 'refunded', 'processed', 'authorized', 'partially_refunded') NOT NULL DEFAULT 'pending';
@@ -0,0 +1,13 @@
+-- Authorized payments are capturing or cancelling while their capture or void is sent to the acquiring bank, and
+-- keep the reference of that call so that they are reconciled with its outcome when it is unknown.
+ALTER TABLE `payments`
+  MODIFY `status` ENUM('pending', 'succeeded', 'failed', 'cancelled', 'refunded', 'processed', 'authorized', 'partially_refunded', 'capturing', 'cancelling') NOT NULL DEFAULT 'pending',
+  ADD COLUMN `bank_reference` VARCHAR(100) NOT NULL DEFAULT '';
+
+ALTER TABLE `payment_status_changes`
+  MODIFY `status` ENUM('pending', 'succeeded', 'failed', 'cancelled', 'refunded', 'processed', 'authorized', 'partially_refunded', 'capturing', 'cancelling') NOT NULL;
+
+-- Payments are reconciled by the time they moved to their status, which is when they were last updated.
+ALTER TABLE `payments`
+  DROP INDEX `idx_payments_status_created_at`,
+  ADD INDEX `idx_payments_status_updated_at` (`status`, `updated_at`);
@@ -0,0 +1,3 @@
+ALTER TABLE `credit_cards`
+  DROP INDEX `idx_credit_cards_customer_active_fingerprint`,
+  DROP COLUMN `active_fingerprint`;
@@ -0,0 +1,23 @@
+-- A customer of a merchant has a single saved card per card number. Deleted cards are kept, so the same number can
+-- be saved again once its card is deleted. MySQL has no partial indexes, so the unique index covers a generated
+-- column holding the fingerprint of cards that are not deleted only.
+ALTER TABLE `credit_cards`
+  ADD COLUMN `active_fingerprint` VARCHAR(64)
+    GENERATED ALWAYS AS (IF(`deleted_at` IS NULL, `fingerprint`, NULL)) STORED;
+
+-- Cards saved more than once before the index existed keep the first card saved, which is the one found when the
+-- card is saved again. The other copies are deleted, and payments made with them still reference them.
+UPDATE `credit_cards`
+  JOIN (
+    SELECT DISTINCT `duplicate`.`id`
+    FROM `credit_cards` AS `duplicate`
+    JOIN `credit_cards` AS `kept`
+      ON `kept`.`merchant_id` = `duplicate`.`merchant_id`
+      AND `kept`.`customer_id` = `duplicate`.`customer_id`
+      AND `kept`.`active_fingerprint` = `duplicate`.`active_fingerprint`
+      AND `kept`.`id` < `duplicate`.`id`
+  ) AS `duplicates` ON `duplicates`.`id` = `credit_cards`.`id`
+  SET `credit_cards`.`deleted_at` = NOW();
+
+ALTER TABLE `credit_cards`
+  ADD UNIQUE INDEX `idx_credit_cards_customer_active_fingerprint` (`merchant_id`, `customer_id`, `active_fingerprint`);
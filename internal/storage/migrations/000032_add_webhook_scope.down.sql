@@ -0,0 +1,3 @@
+UPDATE `merchant_api_keys`
+  SET `scopes` = TRIM(REPLACE(CONCAT(' ', `scopes`, ' '), ' webhooks:write ', ' '))
+  WHERE CONCAT(' ', `scopes`, ' ') LIKE '% webhooks:write %';
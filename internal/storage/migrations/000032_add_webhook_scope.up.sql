@@ -0,0 +1,6 @@
+-- Webhook endpoints are managed with their own scope instead of payments:write. Keys that could manage them keep
+-- doing so.
+UPDATE `merchant_api_keys`
+  SET `scopes` = CONCAT(`scopes`, ' webhooks:write')
+  WHERE CONCAT(' ', `scopes`, ' ') LIKE '% payments:write %'
+    AND CONCAT(' ', `scopes`, ' ') NOT LIKE '% webhooks:write %';
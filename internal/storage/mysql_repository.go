@@ -6,21 +6,36 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
+	"time"
 
+	"github.com/arielcr/payment-gateway/internal/audit"
 	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/messaging"
 	"github.com/arielcr/payment-gateway/internal/models"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Define custom error messages
 var (
-	errMerchantNotFound = errors.New("merchant not found")
-	errCustomerNotFound = errors.New("customer not found")
-	errPaymentNotFound  = errors.New("payment not found")
-	errInvalidPaymentId = errors.New("invalid payment id")
+	errMerchantNotFound       = errors.New("merchant not found")
+	errApiKeyNotFound         = errors.New("api key not found")
+	errCustomerNotFound       = errors.New("customer not found")
+	errPaymentNotFound        = errors.New("payment not found")
+	errInvalidPaymentId       = errors.New("invalid payment id")
+	errIdempotencyKeyNotFound = errors.New("idempotency key not found")
+	errVaultEntryNotFound     = errors.New("card token not found")
+	errCreditCardNotFound     = errors.New("credit card not found")
+	errAuditChainContention   = errors.New("unable to append audit entry after concurrent appends")
+	errPaymentNotUpdated      = errors.New("payment was not updated")
+	errWebhookNotFound        = errors.New("webhook endpoint not found")
+	errDeliveryNotFound       = errors.New("webhook delivery not found")
 )
 
+// auditAppendAttempts is the number of times an audit entry is chained again when another one took its sequence.
+const auditAppendAttempts = 5
+
 // MySQLRepository represents a MySQL implementation of the Repository interface.
 type MySQLRepository struct {
 	db     *gorm.DB
@@ -44,7 +59,7 @@ func ConnectMySQL(config config.RepositoryParameters) (*gorm.DB, error) {
 		config.Port,
 		config.DBName)
 
-	conn, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	conn, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
@@ -52,56 +67,337 @@ func ConnectMySQL(config config.RepositoryParameters) (*gorm.DB, error) {
 	return conn, nil
 }
 
-// CreatePayment creates a new payment record in the database.
+// CreatePayment creates a new payment record in the database, with the outbox entries of its events in the same
+// transaction. The unique index on the merchant and active order token rejects a second active payment for the same
+// order.
 func (m *MySQLRepository) CreatePayment(payment *models.Payment) error {
 	m.logger.Info("Creating new payment")
 
-	if result := m.db.Create(&payment); result.Error != nil {
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		if err := m.recordStatusChange(tx, payment.ID, payment.Status); err != nil {
+			return err
+		}
+		return m.writeOutbox(tx, models.PaymentEvents(*payment)...)
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		m.logger.Error(ErrOrderTokenExists.Error())
+		return ErrOrderTokenExists
+	}
+	if err != nil {
+		m.logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// FindPayment retrieves the payment entity of a merchant from the database by ID.
+// Payments of other merchants are reported as not found.
+func (m *MySQLRepository) FindPayment(merchantID uint, paymentID uint) (models.Payment, error) {
+	m.logger.Info("Finding a payment")
+
+	var payment models.Payment
+	if result := m.db.Where("merchant_id = ?", merchantID).First(&payment, paymentID); result.Error != nil {
 		m.logger.Error(result.Error.Error())
-		return result.Error
+		return models.Payment{}, errPaymentNotFound
+	}
+	return payment, nil
+}
+
+// FindPaymentByOrderToken retrieves the latest payment entity of a merchant from the database by its order token.
+func (m *MySQLRepository) FindPaymentByOrderToken(merchantID uint, orderToken string) (models.Payment, error) {
+	m.logger.Info("Finding a payment by order token")
+
+	var payment models.Payment
+	result := m.db.Where("merchant_id = ? AND order_token = ?", merchantID, orderToken).Order("id DESC").First(&payment)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.Payment{}, errPaymentNotFound
+	}
+	return payment, nil
+}
+
+// GetUnsettledPayments retrieves up to limit payment entities pending, capturing or cancelling since before the given
+// time from the database, after the given ID. A payment moved to its status when it was last updated.
+func (m *MySQLRepository) GetUnsettledPayments(afterID uint, before time.Time, limit int) ([]models.Payment, error) {
+	m.logger.Info("Getting unsettled payments")
+
+	statuses := []models.PaymentStatus{models.Pending, models.Capturing, models.Cancelling}
+	var payments []models.Payment
+	result := m.db.Where("status IN ? AND updated_at < ? AND id > ?", statuses, before, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&payments)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return payments, nil
+}
+
+// UpdatePayment saves every field of an existing payment in the database, with the outbox entries of the events
+// of its new status in the same transaction. The update only applies while the stored status is still the given one.
+func (m *MySQLRepository) UpdatePayment(payment *models.Payment, from models.PaymentStatus) error {
+	m.logger.Info("Updating payment")
+
+	if err := from.ValidateTransition(payment.Status); err != nil {
+		m.logger.Error(err.Error())
+		return err
+	}
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(payment).Where("status = ?", from).Select("*").Updates(payment)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPaymentNotUpdated
+		}
+		if payment.Status != from {
+			if err := m.recordStatusChange(tx, payment.ID, payment.Status); err != nil {
+				return err
+			}
+		}
+		return m.writeOutbox(tx, models.PaymentTransitionEvents(*payment, from)...)
+	})
+	if errors.Is(err, errPaymentNotUpdated) {
+		return m.statusConflict(payment.ID)
+	}
+	if err != nil {
+		m.logger.Error(err.Error())
+		return err
 	}
 	return nil
 }
 
-// UpdatePaymentStatus updates the status of a payment in the database.
-func (m *MySQLRepository) UpdatePaymentStatus(paymentID uint, status models.PaymentStatus) error {
+// UpdatePaymentStatus moves a payment from one status to another in the database, with the outbox entries of the
+// events of the new status in the same transaction. The update only applies while the stored status is still the
+// given one.
+func (m *MySQLRepository) UpdatePaymentStatus(paymentID uint, from models.PaymentStatus, to models.PaymentStatus) error {
 	m.logger.Info("Updating payment status")
 
-	var payment models.Payment
-	if err := m.db.First(&payment, paymentID); err.Error != nil {
-		m.logger.Error(err.Error.Error())
-		return errPaymentNotFound
+	if err := from.ValidateTransition(to); err != nil {
+		m.logger.Error(err.Error())
+		return err
 	}
 
-	payment.Status = status
-	if err := m.db.Save(&payment); err.Error != nil {
-		m.logger.Error(err.Error.Error())
-		return err.Error
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Payment{}).Where("id = ? AND status = ?", paymentID, from).Update("status", to)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPaymentNotUpdated
+		}
+
+		if err := m.recordStatusChange(tx, paymentID, to); err != nil {
+			return err
+		}
+
+		var payment models.Payment
+		if err := tx.First(&payment, paymentID).Error; err != nil {
+			return err
+		}
+		return m.writeOutbox(tx, models.PaymentTransitionEvents(payment, from)...)
+	})
+	if errors.Is(err, errPaymentNotUpdated) {
+		return m.statusConflict(paymentID)
+	}
+	if err != nil {
+		m.logger.Error(err.Error())
+		return err
 	}
+	return nil
+}
 
+// writeOutbox stores the outbox entries of the events in the transaction of the change they report.
+func (m *MySQLRepository) writeOutbox(tx *gorm.DB, events ...models.Event) error {
+	for _, event := range events {
+		entry, err := messaging.NewOutboxEntry(event)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// CreateRefund creates a new refund record in the database.
+// recordStatusChange stores the status a payment moved to in the transaction of the change, for its status history.
+func (m *MySQLRepository) recordStatusChange(tx *gorm.DB, paymentID uint, status models.PaymentStatus) error {
+	return tx.Create(&models.PaymentStatusChange{PaymentID: paymentID, Status: status}).Error
+}
+
+// statusConflict tells apart a missing payment from one whose status was changed by a concurrent request.
+func (m *MySQLRepository) statusConflict(paymentID uint) error {
+	if result := m.db.First(&models.Payment{}, paymentID); result.Error != nil {
+		return errPaymentNotFound
+	}
+	m.logger.Error(ErrPaymentStatusConflict.Error())
+	return ErrPaymentStatusConflict
+}
+
+// CreateRefund creates a new pending refund record in the database, with the outbox entry of its event.
+// The refundable balance is checked in the same transaction as the insert, with the payment row locked, so
+// concurrent refunds cannot add up to more than the settled amount of the payment.
 func (m *MySQLRepository) CreateRefund(refund *models.Refund) error {
 	m.logger.Info("Creating new refund")
 
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, refund.PaymentID); result.Error != nil {
+			return errPaymentNotFound
+		}
+
+		if err := payment.Status.ValidateTransition(models.Refunded); err != nil {
+			return err
+		}
+
+		refunded, err := m.sumRefunds(tx, payment, models.RefundPending, models.RefundSucceeded)
+		if err != nil {
+			return err
+		}
+		remaining, err := payment.SettledAmount().Sub(refunded)
+		if err != nil {
+			return err
+		}
+
+		// if the refund amount equals zero, then it is a full refund of the remaining balance
+		if refund.Amount.IsZero() {
+			refund.Amount = remaining
+		}
+		exceeds, err := refund.Amount.Cmp(remaining)
+		if err != nil {
+			return err
+		}
+		if exceeds > 0 || refund.Amount.IsNegative() || refund.Amount.IsZero() {
+			return ErrRefundExceedsBalance
+		}
+
+		refund.Status = models.RefundPending
+		if err := tx.Create(refund).Error; err != nil {
+			return err
+		}
+		return m.writeOutbox(tx, models.NewRefundCreated(*refund, payment.MerchantID))
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// SettleRefund stores the final status of a pending refund in the database and, when it succeeded, moves the
+// payment to refunded once the whole settled amount is refunded, or to partially refunded otherwise. The outbox
+// entry of its event is stored in the same transaction. The status only changes while the stored refund is still
+// pending, so a late outcome cannot overwrite the one stored first.
+func (m *MySQLRepository) SettleRefund(refund *models.Refund, status models.RefundStatus) (models.Payment, error) {
+	m.logger.Info("Settling refund")
+
 	var payment models.Payment
-	if err := m.db.First(&payment, refund.PaymentID); err.Error != nil {
-		m.logger.Error(err.Error.Error())
-		return errPaymentNotFound
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, refund.PaymentID); result.Error != nil {
+			return errPaymentNotFound
+		}
+
+		result := tx.Model(refund).Where("status = ?", models.RefundPending).Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundAlreadySettled
+		}
+		refund.Status = status
+
+		if status != models.RefundSucceeded {
+			return m.writeOutbox(tx, models.NewRefundSettled(*refund, payment))
+		}
+
+		refunded, err := m.sumRefunds(tx, payment, models.RefundSucceeded)
+		if err != nil {
+			return err
+		}
+
+		next := models.PartiallyRefunded
+		if settled, err := refunded.Cmp(payment.SettledAmount()); err == nil && settled >= 0 {
+			next = models.Refunded
+		}
+		if err := payment.Status.ValidateTransition(next); err != nil {
+			return err
+		}
+
+		payment.Status = next
+		if err := tx.Model(&payment).Update("status", next).Error; err != nil {
+			return err
+		}
+		if err := m.recordStatusChange(tx, payment.ID, next); err != nil {
+			return err
+		}
+		return m.writeOutbox(tx, models.NewRefundSettled(*refund, payment))
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return models.Payment{}, err
 	}
+	return payment, nil
+}
+
+// GetPendingRefunds retrieves up to limit refund records pending since before the given time from the database,
+// after the given ID.
+func (m *MySQLRepository) GetPendingRefunds(afterID uint, before time.Time, limit int) ([]models.Refund, error) {
+	m.logger.Info("Getting pending refunds")
 
-	// if the refund amount equals zero, then it is a full refund
-	if refund.Amount == 0.00 {
-		refund.Amount = payment.Amount
+	var refunds []models.Refund
+	result := m.db.Where("status = ? AND created_at < ? AND id > ?", models.RefundPending, before, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&refunds)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
 	}
+	return refunds, nil
+}
+
+// GetPaymentOfRefund retrieves the payment entity a refund belongs to from the database.
+func (m *MySQLRepository) GetPaymentOfRefund(refund models.Refund) (models.Payment, error) {
+	m.logger.Info("Getting payment of refund")
 
-	if result := m.db.Create(&refund); result.Error != nil {
+	var payment models.Payment
+	if result := m.db.First(&payment, refund.PaymentID); result.Error != nil {
 		m.logger.Error(result.Error.Error())
-		return result.Error
+		return models.Payment{}, errPaymentNotFound
 	}
-	return nil
+	return payment, nil
+}
+
+// GetRefunds retrieves every refund of a payment from the database, oldest first.
+func (m *MySQLRepository) GetRefunds(paymentID uint) ([]models.Refund, error) {
+	m.logger.Info("Getting refunds")
+
+	var refunds []models.Refund
+	if result := m.db.Where("payment_id = ?", paymentID).Order("id").Find(&refunds); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return refunds, nil
+}
+
+// sumRefunds adds up the amount of the refunds of a payment in any of the given statuses.
+func (m *MySQLRepository) sumRefunds(tx *gorm.DB, payment models.Payment, statuses ...models.RefundStatus) (models.Money, error) {
+	total := models.NewMoney(0, payment.Amount.Currency)
+	err := tx.Model(&models.Refund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("payment_id = ? AND status IN ?", payment.ID, statuses).
+		Row().
+		Scan(&total)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return total, nil
 }
 
 // CreateCustomer creates a new customer record in the database.
@@ -127,20 +423,75 @@ func (m *MySQLRepository) GetMerchant(merchantID uint) (models.Merchant, error)
 	return merchant, nil
 }
 
-// GetCustomer retrieves a customer record from the database by ID.
-func (m *MySQLRepository) GetCustomer(customerID uint) (models.Customer, error) {
+// GetMerchantApiKey retrieves a merchant API key record that was not revoked from the database by the hash of
+// the key.
+func (m *MySQLRepository) GetMerchantApiKey(keyHash string) (models.MerchantApiKey, error) {
+	m.logger.Info("Getting a merchant API key")
+
+	var apiKey models.MerchantApiKey
+	if result := m.db.Where("key_hash = ?", keyHash).First(&apiKey); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.MerchantApiKey{}, errApiKeyNotFound
+	}
+	return apiKey, nil
+}
+
+// CreateMerchantApiKey creates a new API key record of a merchant in the database.
+func (m *MySQLRepository) CreateMerchantApiKey(apiKey *models.MerchantApiKey) error {
+	m.logger.Info("Creating merchant API key")
+
+	if result := m.db.Create(apiKey); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// GetMerchantApiKeys retrieves the API key records of a merchant that were not revoked from the database.
+func (m *MySQLRepository) GetMerchantApiKeys(merchantID uint) ([]models.MerchantApiKey, error) {
+	m.logger.Info("Getting merchant API keys")
+
+	var apiKeys []models.MerchantApiKey
+	if result := m.db.Where("merchant_id = ?", merchantID).Order("id").Find(&apiKeys); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return apiKeys, nil
+}
+
+// RevokeMerchantApiKey soft deletes an API key record of a merchant in the database by ID, so that it is no longer
+// found when authenticating requests. Keys of other merchants are reported as not found.
+func (m *MySQLRepository) RevokeMerchantApiKey(merchantID uint, keyID uint) error {
+	m.logger.Info("Revoking merchant API key")
+
+	result := m.db.Where("merchant_id = ?", merchantID).Delete(&models.MerchantApiKey{}, keyID)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		m.logger.Error(errApiKeyNotFound.Error())
+		return errApiKeyNotFound
+	}
+	return nil
+}
+
+// GetCustomer retrieves a customer record of a merchant from the database by ID.
+// Customers of other merchants are reported as not found.
+func (m *MySQLRepository) GetCustomer(merchantID uint, customerID uint) (models.Customer, error) {
 	m.logger.Info("Getting a customer")
 
 	var customer models.Customer
-	if result := m.db.First(&customer, customerID); result.Error != nil {
+	if result := m.db.Where("merchant_id = ?", merchantID).First(&customer, customerID); result.Error != nil {
 		m.logger.Error(result.Error.Error())
 		return models.Customer{}, errCustomerNotFound
 	}
 	return customer, nil
 }
 
-// GetPayment retrieves a payment record from the database by ID.
-func (m *MySQLRepository) GetPayment(paymentID string) (models.PaymentData, error) {
+// GetPayment retrieves a payment record of a merchant from the database by ID.
+// Payments of other merchants are reported as not found.
+func (m *MySQLRepository) GetPayment(merchantID uint, paymentID string) (models.PaymentData, error) {
 	m.logger.Info("Getting a payment")
 
 	var payment models.Payment
@@ -151,13 +502,34 @@ func (m *MySQLRepository) GetPayment(paymentID string) (models.PaymentData, erro
 		return models.PaymentData{}, errInvalidPaymentId
 	}
 
-	if result := m.db.First(&payment, uint(id)); result.Error != nil {
+	if result := m.db.Where("merchant_id = ?", merchantID).First(&payment, uint(id)); result.Error != nil {
 		m.logger.Error(errPaymentNotFound.Error())
 		return models.PaymentData{}, errPaymentNotFound
 	}
 
-	customer, err := m.GetCustomer(payment.CustomerID)
-	if err != nil {
+	return m.paymentData(payment)
+}
+
+// GetPaymentByOrderToken retrieves the latest payment record of a merchant from the database by its order token.
+func (m *MySQLRepository) GetPaymentByOrderToken(merchantID uint, orderToken string) (models.PaymentData, error) {
+	m.logger.Info("Getting a payment by order token")
+
+	var payment models.Payment
+	result := m.db.Where("merchant_id = ? AND order_token = ?", merchantID, orderToken).Order("id DESC").First(&payment)
+	if result.Error != nil {
+		m.logger.Error(errPaymentNotFound.Error())
+		return models.PaymentData{}, errPaymentNotFound
+	}
+
+	return m.paymentData(payment)
+}
+
+// paymentData builds the payment data of a payment record with its customer and merchant, the card it was made
+// with, its refunds and its status history. Cards deleted by the customer after the payment are still reported.
+// The customer is the one the payment was made for, so it is looked up by the payment alone.
+func (m *MySQLRepository) paymentData(payment models.Payment) (models.PaymentData, error) {
+	var customer models.Customer
+	if result := m.db.First(&customer, payment.CustomerID); result.Error != nil {
 		m.logger.Error(errCustomerNotFound.Error())
 		return models.PaymentData{}, errCustomerNotFound
 	}
@@ -168,10 +540,36 @@ func (m *MySQLRepository) GetPayment(paymentID string) (models.PaymentData, erro
 		return models.PaymentData{}, errMerchantNotFound
 	}
 
+	refunds, err := m.GetRefunds(payment.ID)
+	if err != nil {
+		return models.PaymentData{}, err
+	}
+	summary, err := models.SummarizeRefunds(payment, refunds)
+	if err != nil {
+		m.logger.Error(err.Error())
+		return models.PaymentData{}, err
+	}
+
+	var history []models.PaymentStatusChange
+	if result := m.db.Where("payment_id = ?", payment.ID).Order("id").Find(&history); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.PaymentData{}, result.Error
+	}
+
 	paymentData := models.PaymentData{
-		OrderToken: payment.OrderToken,
-		Amount:     payment.Amount,
-		Status:     payment.Status,
+		ID:                payment.ID,
+		OrderToken:        payment.OrderToken,
+		Amount:            payment.Amount,
+		Currency:          payment.Currency,
+		Status:            payment.Status,
+		CapturedAmount:    payment.CapturedAmount,
+		Processor:         payment.Processor,
+		AuthorizationCode: payment.AuthorizationCode,
+		BankMessage:       payment.BankMessage,
+		RefundedAmount:    summary.RefundedAmount,
+		RemainingAmount:   summary.RemainingAmount,
+		Refunds:           summary.Refunds,
+		StatusHistory:     history,
 		Customer: models.CustomerResponse{
 			Name:  customer.Name,
 			Email: customer.Email,
@@ -183,16 +581,775 @@ func (m *MySQLRepository) GetPayment(paymentID string) (models.PaymentData, erro
 		CreatedAt: payment.CreatedAt,
 	}
 
+	if payment.CreditCardID != nil {
+		var creditCard models.CreditCard
+		if result := m.db.Unscoped().First(&creditCard, *payment.CreditCardID); result.Error != nil {
+			m.logger.Error(errCreditCardNotFound.Error())
+			return models.PaymentData{}, errCreditCardNotFound
+		}
+		paymentData.Card = &models.CardDetails{
+			CardType:       creditCard.CardType,
+			CardBrand:      creditCard.CardBrand,
+			CardHolder:     creditCard.CardHolder,
+			LastFourDigits: creditCard.LastFour,
+		}
+	}
+
 	return paymentData, nil
 }
 
+// FindPayments retrieves payment records of a merchant matching the filter from the database, joined with their
+// customer and card. Pages are read with keyset pagination on the sort column and the ID, so that reading a page
+// costs the same wherever it is in the list.
+func (m *MySQLRepository) FindPayments(filter models.PaymentFilter, limit int) ([]models.PaymentSummary, error) {
+	m.logger.Info("Finding payments")
+
+	query := m.db.Table("payments").
+		Select("payments.id, payments.order_token, payments.amount, payments.currency, payments.status, "+
+			"payments.processor, payments.customer_id, payments.created_at, customers.email AS customer_email, "+
+			"credit_cards.card_brand, credit_cards.last_four AS card_last_four").
+		Joins("JOIN customers ON customers.id = payments.customer_id").
+		Joins("LEFT JOIN credit_cards ON credit_cards.id = payments.credit_card_id").
+		Where("payments.merchant_id = ? AND payments.deleted_at IS NULL", filter.MerchantID)
+
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			statuses = append(statuses, status.String())
+		}
+		query = query.Where("payments.status IN ?", statuses)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("payments.created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("payments.created_at < ?", filter.To)
+	}
+	if filter.Currency != "" {
+		query = query.Where("payments.currency = ?", filter.Currency)
+	}
+	if !filter.MinAmount.IsZero() {
+		query = query.Where("payments.amount >= ?", filter.MinAmount)
+	}
+	if !filter.MaxAmount.IsZero() {
+		query = query.Where("payments.amount <= ?", filter.MaxAmount)
+	}
+	if filter.CustomerEmail != "" {
+		query = query.Where("customers.email = ?", filter.CustomerEmail)
+	}
+	if filter.OrderToken != "" {
+		query = query.Where("payments.order_token = ?", filter.OrderToken)
+	}
+	if filter.CardLastFour != "" {
+		query = query.Where("credit_cards.last_four = ?", filter.CardLastFour)
+	}
+
+	column, direction, comparison := "payments.created_at", "ASC", ">"
+	if filter.Sort == models.SortByAmount {
+		column = "payments.amount"
+	}
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		var value interface{} = filter.After.CreatedAt
+		if filter.Sort == models.SortByAmount {
+			value = filter.After.Amount
+		}
+		query = query.Where(
+			fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND payments.id %[2]s ?))", column, comparison),
+			value, value, filter.After.ID)
+	}
+
+	var payments []models.PaymentSummary
+	result := query.Order(column + " " + direction).Order("payments.id " + direction).Limit(limit).Find(&payments)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	for i := range payments {
+		payments[i].Amount.Currency = payments[i].Currency
+	}
+	return payments, nil
+}
+
 // CreateCreditCard creates a new credit card record in the database.
+// The unique index on the fingerprint of the cards of a customer reports a card saved concurrently with the same
+// card number as ErrCreditCardExists.
 func (m *MySQLRepository) CreateCreditCard(creditCard *models.CreditCard) error {
 	m.logger.Info("Creating new credit card")
 
 	if result := m.db.Create(&creditCard); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			m.logger.Error(ErrCreditCardExists.Error())
+			return ErrCreditCardExists
+		}
 		m.logger.Error(result.Error.Error())
 		return result.Error
 	}
 	return nil
 }
+
+// UpdateCreditCard saves a credit card record in the database.
+func (m *MySQLRepository) UpdateCreditCard(creditCard *models.CreditCard) error {
+	m.logger.Info("Updating credit card")
+
+	if result := m.db.Save(creditCard); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// GetCreditCard retrieves a credit card record of a customer of a merchant from the database by token.
+// Cards of other merchants are reported as not found.
+func (m *MySQLRepository) GetCreditCard(merchantID uint, customerID uint, token string) (models.CreditCard, error) {
+	m.logger.Info("Getting a credit card")
+
+	var creditCard models.CreditCard
+	result := m.db.Where("merchant_id = ? AND customer_id = ? AND token = ?", merchantID, customerID, token).First(&creditCard)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.CreditCard{}, errCreditCardNotFound
+	}
+	return creditCard, nil
+}
+
+// FindCreditCard retrieves a credit card record of a customer of a merchant from the database by card number
+// fingerprint.
+func (m *MySQLRepository) FindCreditCard(merchantID uint, customerID uint, fingerprint string) (models.CreditCard, error) {
+	m.logger.Info("Finding a credit card")
+
+	var creditCard models.CreditCard
+	result := m.db.Where("merchant_id = ? AND customer_id = ? AND fingerprint = ?", merchantID, customerID, fingerprint).First(&creditCard)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.CreditCard{}, errCreditCardNotFound
+	}
+	return creditCard, nil
+}
+
+// GetCreditCards retrieves the credit card records of a customer of a merchant from the database.
+func (m *MySQLRepository) GetCreditCards(merchantID uint, customerID uint) ([]models.CreditCard, error) {
+	m.logger.Info("Getting credit cards")
+
+	var creditCards []models.CreditCard
+	result := m.db.Where("merchant_id = ? AND customer_id = ?", merchantID, customerID).Order("id").Find(&creditCards)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return creditCards, nil
+}
+
+// DeleteCreditCard deletes a credit card record of a customer of a merchant from the database.
+// Cards of other merchants are reported as not found.
+func (m *MySQLRepository) DeleteCreditCard(merchantID uint, customerID uint, creditCardID uint) error {
+	m.logger.Info("Deleting credit card")
+
+	result := m.db.Where("merchant_id = ? AND customer_id = ?", merchantID, customerID).Delete(&models.CreditCard{}, creditCardID)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errCreditCardNotFound
+	}
+	return nil
+}
+
+// CreateIdempotencyKey creates a new idempotency key record in the database.
+func (m *MySQLRepository) CreateIdempotencyKey(key *models.IdempotencyKey) error {
+	m.logger.Info("Creating new idempotency key")
+
+	if result := m.db.Create(key); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return ErrIdempotencyKeyExists
+		}
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// GetIdempotencyKey retrieves an idempotency key record of a merchant from the database.
+func (m *MySQLRepository) GetIdempotencyKey(merchantID uint, key string) (models.IdempotencyKey, error) {
+	m.logger.Info("Getting an idempotency key")
+
+	var idempotencyKey models.IdempotencyKey
+	if result := m.db.Where("merchant_id = ? AND `key` = ?", merchantID, key).First(&idempotencyKey); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.IdempotencyKey{}, errIdempotencyKeyNotFound
+	}
+	return idempotencyKey, nil
+}
+
+// UpdateIdempotencyKey saves an idempotency key record in the database.
+func (m *MySQLRepository) UpdateIdempotencyKey(key *models.IdempotencyKey) error {
+	m.logger.Info("Updating idempotency key")
+
+	if result := m.db.Save(key); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey permanently deletes an idempotency key record from the database.
+func (m *MySQLRepository) DeleteIdempotencyKey(key *models.IdempotencyKey) error {
+	m.logger.Info("Deleting idempotency key")
+
+	if result := m.db.Unscoped().Delete(key); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// RenewIdempotencyKey renews the lock of an uncompleted idempotency key record in the database.
+func (m *MySQLRepository) RenewIdempotencyKey(key *models.IdempotencyKey) error {
+	m.logger.Info("Renewing idempotency key")
+
+	lockedAt := time.Now()
+	result := m.db.Model(&models.IdempotencyKey{}).
+		Where("id = ? AND completed = ?", key.ID, false).
+		Update("locked_at", lockedAt)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	key.LockedAt = lockedAt
+	return nil
+}
+
+// ReclaimIdempotencyKey locks again an uncompleted idempotency key record whose lock was taken before the given
+// time. The lock is compared and set in a single update, so only one of the requests reclaiming the key gets it.
+func (m *MySQLRepository) ReclaimIdempotencyKey(key *models.IdempotencyKey, lockedBefore time.Time) (bool, error) {
+	m.logger.Info("Reclaiming idempotency key")
+
+	lockedAt := time.Now()
+	result := m.db.Model(&models.IdempotencyKey{}).
+		Where("id = ? AND completed = ? AND locked_at < ?", key.ID, false, lockedBefore).
+		Update("locked_at", lockedAt)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	key.LockedAt = lockedAt
+	return true, nil
+}
+
+// DeleteExpiredIdempotencyKeys permanently removes the idempotency key records created before the given time from the database.
+func (m *MySQLRepository) DeleteExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	m.logger.Info("Deleting expired idempotency keys")
+
+	result := m.db.Unscoped().Where("created_at < ?", before).Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// GetRoutingRules retrieves the routing rules of a merchant and the ones shared by every merchant from the database.
+func (m *MySQLRepository) GetRoutingRules(merchantID uint) ([]models.RoutingRule, error) {
+	m.logger.Info("Getting routing rules")
+
+	var rules []models.RoutingRule
+	result := m.db.Where("merchant_id IN ?", []uint{0, merchantID}).
+		Order("priority").
+		Find(&rules)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return rules, nil
+}
+
+// CreateVaultEntry creates a new vault entry record in the database.
+func (m *MySQLRepository) CreateVaultEntry(entry *models.VaultEntry) error {
+	m.logger.Info("Creating new vault entry")
+
+	if result := m.db.Create(entry); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// GetVaultEntry retrieves a vault entry record from the database by token.
+func (m *MySQLRepository) GetVaultEntry(token string) (models.VaultEntry, error) {
+	m.logger.Info("Getting a vault entry")
+
+	var entry models.VaultEntry
+	if result := m.db.Where("token = ?", token).First(&entry); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.VaultEntry{}, errVaultEntryNotFound
+	}
+	return entry, nil
+}
+
+// GetVaultEntriesToRotate retrieves vault entry records encrypted with a key other than the given one from the database.
+func (m *MySQLRepository) GetVaultEntriesToRotate(keyID string, limit int) ([]models.VaultEntry, error) {
+	m.logger.Info("Getting vault entries to rotate")
+
+	var entries []models.VaultEntry
+	result := m.db.Where("key_id <> ?", keyID).
+		Order("id").
+		Limit(limit).
+		Find(&entries)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+// UpdateVaultEntry saves a vault entry record in the database.
+func (m *MySQLRepository) UpdateVaultEntry(entry *models.VaultEntry) error {
+	m.logger.Info("Updating vault entry")
+
+	if result := m.db.Save(entry); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// AppendAuditEntry chains an audit entry after the last stored one and stores it in the database.
+// Entries appended concurrently claim the same sequence, which is unique, so the losers chain again after the winner.
+func (m *MySQLRepository) AppendAuditEntry(entry *audit.Entry) error {
+	m.logger.Info("Appending audit entry")
+
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		var last audit.Entry
+		result := m.db.Order("sequence DESC").Limit(1).Find(&last)
+		if result.Error != nil {
+			m.logger.Error(result.Error.Error())
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			entry.Chain(nil)
+		} else {
+			entry.Chain(&last)
+		}
+
+		result = m.db.Create(entry)
+		if result.Error == nil {
+			return nil
+		}
+		if !errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			m.logger.Error(result.Error.Error())
+			return result.Error
+		}
+	}
+
+	m.logger.Error(errAuditChainContention.Error())
+	return errAuditChainContention
+}
+
+// GetAuditEntries retrieves audit entry records with a sequence greater than the given one from the database.
+func (m *MySQLRepository) GetAuditEntries(afterSequence uint64, limit int) ([]audit.Entry, error) {
+	m.logger.Info("Getting audit entries")
+
+	var entries []audit.Entry
+	result := m.db.Where("sequence > ?", afterSequence).
+		Order("sequence").
+		Limit(limit).
+		Find(&entries)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+// FindAuditEntries retrieves audit entry records matching the filter from the database.
+// The time range includes From and excludes To.
+func (m *MySQLRepository) FindAuditEntries(filter audit.Filter, limit int) ([]audit.Entry, error) {
+	m.logger.Info("Finding audit entries")
+
+	query := m.db.Where("sequence > ?", filter.AfterSequence)
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.MerchantID != 0 {
+		query = query.Where("merchant_id = ?", filter.MerchantID)
+	}
+	if filter.PaymentID != 0 {
+		query = query.Where("payment_id = ?", filter.PaymentID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("occurred_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("occurred_at < ?", filter.To)
+	}
+
+	var entries []audit.Entry
+	if result := query.Order("sequence").Limit(limit).Find(&entries); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+// CreateMessage creates a new message record in the database, unless the message of its event was already
+// created, in which case messaging.ErrMessageExists is returned.
+func (m *MySQLRepository) CreateMessage(message *messaging.Message) error {
+	m.logger.Info("Creating new message")
+
+	result := m.db.Clauses(clause.OnConflict{DoNothing: true}).Create(message)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return messaging.ErrMessageExists
+	}
+	return nil
+}
+
+// ClaimMessages retrieves undelivered message records due for a new attempt from the database and postpones their
+// next attempt by the lease in the same transaction. Rows claimed by another transaction are skipped.
+func (m *MySQLRepository) ClaimMessages(lease time.Duration, limit int) ([]messaging.Message, error) {
+	m.logger.Info("Claiming messages")
+
+	var messages []messaging.Message
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("delivered_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").
+			Limit(limit).
+			Find(&messages)
+		if result.Error != nil || len(messages) == 0 {
+			return result.Error
+		}
+
+		ids := make([]uint, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+		return tx.Model(&messaging.Message{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MarkMessageDelivered stores the delivery time of a message record in the database.
+func (m *MySQLRepository) MarkMessageDelivered(message *messaging.Message) error {
+	m.logger.Info("Marking message as delivered")
+
+	if result := m.db.Model(message).Update("delivered_at", time.Now()); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// RescheduleMessage stores the attempts, next attempt and last error of a message record in the database.
+func (m *MySQLRepository) RescheduleMessage(message *messaging.Message) error {
+	m.logger.Info("Rescheduling message")
+
+	result := m.db.Model(message).Select("attempts", "next_attempt_at", "last_error").Updates(message)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// ClaimOutboxEntries retrieves outbox entry records neither sent nor claimed from the database, oldest first, and
+// sets their claim to expire after the lease in the same transaction. Rows claimed by another transaction are skipped.
+func (m *MySQLRepository) ClaimOutboxEntries(lease time.Duration, limit int) ([]messaging.OutboxEntry, error) {
+	m.logger.Info("Claiming outbox entries")
+
+	var entries []messaging.OutboxEntry
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND (claimed_until IS NULL OR claimed_until <= ?)", now).
+			Order("id").
+			Limit(limit).
+			Find(&entries)
+		if result.Error != nil || len(entries) == 0 {
+			return result.Error
+		}
+
+		ids := make([]uint, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return tx.Model(&messaging.OutboxEntry{}).Where("id IN ?", ids).Update("claimed_until", now.Add(lease)).Error
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MarkOutboxEntrySent stores the time an outbox entry record was sent in the database.
+func (m *MySQLRepository) MarkOutboxEntrySent(entry *messaging.OutboxEntry) error {
+	m.logger.Info("Marking outbox entry as sent")
+
+	if result := m.db.Model(entry).Update("sent_at", time.Now()); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteSentOutboxEntries permanently removes the outbox entry records sent before the given time from the database.
+func (m *MySQLRepository) DeleteSentOutboxEntries(before time.Time) (int64, error) {
+	m.logger.Info("Deleting sent outbox entries")
+
+	result := m.db.Where("sent_at < ?", before).Delete(&messaging.OutboxEntry{})
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteDeliveredMessages permanently removes the message records delivered before the given time from the database.
+func (m *MySQLRepository) DeleteDeliveredMessages(before time.Time) (int64, error) {
+	m.logger.Info("Deleting delivered messages")
+
+	result := m.db.Where("delivered_at < ?", before).Delete(&messaging.Message{})
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// CreateWebhookEndpoint creates a new webhook endpoint record in the database.
+func (m *MySQLRepository) CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	m.logger.Info("Creating webhook endpoint")
+
+	if result := m.db.Create(endpoint); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// GetWebhookEndpoints retrieves every webhook endpoint record of a merchant from the database.
+func (m *MySQLRepository) GetWebhookEndpoints(merchantID uint) ([]models.WebhookEndpoint, error) {
+	m.logger.Info("Getting webhook endpoints")
+
+	var endpoints []models.WebhookEndpoint
+	if result := m.db.Where("merchant_id = ?", merchantID).Order("id").Find(&endpoints); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return endpoints, nil
+}
+
+// GetWebhookEndpoint retrieves a webhook endpoint record of a merchant from the database by ID.
+func (m *MySQLRepository) GetWebhookEndpoint(merchantID uint, endpointID uint) (models.WebhookEndpoint, error) {
+	m.logger.Info("Getting webhook endpoint")
+
+	var endpoint models.WebhookEndpoint
+	if result := m.db.Where("merchant_id = ?", merchantID).First(&endpoint, endpointID); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.WebhookEndpoint{}, errWebhookNotFound
+	}
+	return endpoint, nil
+}
+
+// DeleteWebhookEndpoint deletes a webhook endpoint record of a merchant from the database and marks its pending
+// delivery records as failed in the same transaction.
+func (m *MySQLRepository) DeleteWebhookEndpoint(merchantID uint, endpointID uint) error {
+	m.logger.Info("Deleting webhook endpoint")
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("merchant_id = ?", merchantID).Delete(&models.WebhookEndpoint{}, endpointID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errWebhookNotFound
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("endpoint_id = ? AND status = ?", endpointID, models.WebhookDeliveryPending).
+			Updates(map[string]interface{}{
+				"status":     models.WebhookDeliveryFailed,
+				"last_error": errWebhookNotFound.Error(),
+			}).Error
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetWebhookSecrets retrieves the webhook secret records of a merchant that have not expired from the database,
+// newest first.
+func (m *MySQLRepository) GetWebhookSecrets(merchantID uint) ([]models.WebhookSecret, error) {
+	m.logger.Info("Getting webhook secrets")
+
+	var secrets []models.WebhookSecret
+	result := m.db.Where("merchant_id = ? AND (expires_at IS NULL OR expires_at > ?)", merchantID, time.Now()).
+		Order("id DESC").
+		Find(&secrets)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return secrets, nil
+}
+
+// RotateWebhookSecret creates a new webhook secret record in the database and, in the same transaction, sets the
+// expiration of the other active secret records of the merchant to the end of the overlap.
+func (m *MySQLRepository) RotateWebhookSecret(secret *models.WebhookSecret, overlap time.Duration) error {
+	m.logger.Info("Rotating webhook secret")
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		expiresAt := time.Now().Add(overlap)
+		result := tx.Model(&models.WebhookSecret{}).
+			Where("merchant_id = ? AND (expires_at IS NULL OR expires_at > ?)", secret.MerchantID, expiresAt).
+			Update("expires_at", expiresAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Create(secret).Error
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// CreateWebhookDeliveries creates new webhook delivery records in the database. Deliveries of events already
+// dispatched to their endpoint are skipped.
+func (m *MySQLRepository) CreateWebhookDeliveries(deliveries []models.WebhookDelivery) error {
+	m.logger.Info("Creating webhook deliveries")
+
+	if result := m.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries retrieves pending webhook delivery records due for an attempt from the database and
+// postpones their next attempt by the lease in the same transaction. Rows claimed by another transaction are skipped.
+func (m *MySQLRepository) ClaimWebhookDeliveries(lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	m.logger.Info("Claiming webhook deliveries")
+
+	var deliveries []models.WebhookDelivery
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries)
+		if result.Error != nil || len(deliveries) == 0 {
+			return result.Error
+		}
+
+		ids := make([]uint, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery stores the status, attempts, next attempt and outcome of the last attempt of a webhook
+// delivery record in the database.
+func (m *MySQLRepository) UpdateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	m.logger.Info("Updating webhook delivery")
+
+	result := m.db.Model(delivery).
+		Select("status", "attempts", "next_attempt_at", "last_response_status", "last_error", "delivered_at").
+		Updates(delivery)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// GetWebhookDeliveries retrieves delivery records of a webhook endpoint of a merchant from the database,
+// most recent first.
+func (m *MySQLRepository) GetWebhookDeliveries(merchantID uint, endpointID uint, limit int) ([]models.WebhookDelivery, error) {
+	m.logger.Info("Getting webhook deliveries")
+
+	var deliveries []models.WebhookDelivery
+	result := m.db.Where("merchant_id = ? AND endpoint_id = ?", merchantID, endpointID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries)
+	if result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return nil, result.Error
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDelivery retrieves a webhook delivery record of a merchant from the database by ID.
+func (m *MySQLRepository) GetWebhookDelivery(merchantID uint, deliveryID uint) (models.WebhookDelivery, error) {
+	m.logger.Info("Getting webhook delivery")
+
+	var delivery models.WebhookDelivery
+	if result := m.db.Where("merchant_id = ?", merchantID).First(&delivery, deliveryID); result.Error != nil {
+		m.logger.Error(result.Error.Error())
+		return models.WebhookDelivery{}, errDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// RedeliverWebhookDelivery creates a new pending webhook delivery record with the payload of the given one,
+// numbered after the last redelivery of the same event to the same endpoint.
+func (m *MySQLRepository) RedeliverWebhookDelivery(delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	m.logger.Info("Redelivering webhook delivery")
+
+	redelivery := models.WebhookDelivery{
+		EndpointID:    delivery.EndpointID,
+		EventID:       delivery.EventID,
+		MerchantID:    delivery.MerchantID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		result := tx.Model(&models.WebhookDelivery{}).
+			Where("endpoint_id = ? AND event_id = ?", delivery.EndpointID, delivery.EventID).
+			Select("COALESCE(MAX(redelivery), 0)").
+			Scan(&last)
+		if result.Error != nil {
+			return result.Error
+		}
+		redelivery.Redelivery = last + 1
+		return tx.Create(&redelivery).Error
+	})
+	if err != nil {
+		m.logger.Error(err.Error())
+		return models.WebhookDelivery{}, err
+	}
+	return redelivery, nil
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/arielcr/payment-gateway/internal/messaging"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newMockRepository returns a MySQL repository over a mocked database connection.
+func newMockRepository(t *testing.T) (*MySQLRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMySQLRepository(db, slog.New(slog.NewTextHandler(io.Discard, nil))), mock
+}
+
+// TestLookupsAreScopedToMerchant checks that looking up the records of another merchant queries them by the
+// merchant ID and reports them as not found.
+func TestLookupsAreScopedToMerchant(t *testing.T) {
+	const otherMerchantID = 2
+
+	tests := []struct {
+		name   string
+		query  string
+		args   []driver.Value
+		lookup func(repository *MySQLRepository) error
+	}{
+		{
+			name:  "get payment",
+			query: "SELECT * FROM `payments` WHERE merchant_id = ? AND `payments`.`id` = ?",
+			args:  []driver.Value{otherMerchantID, 100},
+			lookup: func(repository *MySQLRepository) error {
+				_, err := repository.GetPayment(otherMerchantID, "100")
+				return err
+			},
+		},
+		{
+			name:  "find payment",
+			query: "SELECT * FROM `payments` WHERE merchant_id = ? AND `payments`.`id` = ?",
+			args:  []driver.Value{otherMerchantID, 100},
+			lookup: func(repository *MySQLRepository) error {
+				_, err := repository.FindPayment(otherMerchantID, 100)
+				return err
+			},
+		},
+		{
+			name:  "get payment by order token",
+			query: "SELECT * FROM `payments` WHERE (merchant_id = ? AND order_token = ?)",
+			args:  []driver.Value{otherMerchantID, "order-a"},
+			lookup: func(repository *MySQLRepository) error {
+				_, err := repository.GetPaymentByOrderToken(otherMerchantID, "order-a")
+				return err
+			},
+		},
+		{
+			name:  "get customer",
+			query: "SELECT * FROM `customers` WHERE merchant_id = ? AND `customers`.`id` = ?",
+			args:  []driver.Value{otherMerchantID, 10},
+			lookup: func(repository *MySQLRepository) error {
+				_, err := repository.GetCustomer(otherMerchantID, 10)
+				return err
+			},
+		},
+		{
+			name:  "get credit card",
+			query: "SELECT * FROM `credit_cards` WHERE (merchant_id = ? AND customer_id = ? AND token = ?)",
+			args:  []driver.Value{otherMerchantID, 10, "card-token-a"},
+			lookup: func(repository *MySQLRepository) error {
+				_, err := repository.GetCreditCard(otherMerchantID, 10, "card-token-a")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository, mock := newMockRepository(t)
+			// the lookups read the first matching record, which adds a LIMIT of 1
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).
+				WithArgs(append(tt.args, 1)...).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			if err := tt.lookup(repository); err == nil {
+				t.Fatal("expected the record of another merchant not to be found")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestDeleteCreditCardOfAnotherMerchant checks that deleting the card of another merchant deletes nothing and
+// reports it as not found.
+func TestDeleteCreditCardOfAnotherMerchant(t *testing.T) {
+	repository, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `credit_cards` SET `deleted_at`=? WHERE (merchant_id = ? AND customer_id = ?) AND `credit_cards`.`id` = ?")).
+		WithArgs(sqlmock.AnyArg(), 2, 10, 20).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	if err := repository.DeleteCreditCard(2, 10, 20); err != errCreditCardNotFound {
+		t.Fatalf("expected %v, got %v", errCreditCardNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCreateCreditCardSavedConcurrently checks that creating a card whose number the customer saved concurrently
+// reports the card as existing.
+func TestCreateCreditCardSavedConcurrently(t *testing.T) {
+	repository, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `credit_cards`")).
+		WillReturnError(gorm.ErrDuplicatedKey)
+	mock.ExpectRollback()
+
+	creditCard := models.CreditCard{MerchantID: 1, CustomerID: 10, Token: "card-token", Fingerprint: "fingerprint"}
+	if err := repository.CreateCreditCard(&creditCard); !errors.Is(err, ErrCreditCardExists) {
+		t.Fatalf("expected %v, got %v", ErrCreditCardExists, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCreateMessageOfRelayedEvent checks that storing the message of an event that was already relayed stores
+// nothing and reports the message as existing.
+func TestCreateMessageOfRelayedEvent(t *testing.T) {
+	repository, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `messages` (`event_id`,`type`,`merchant_id`,`payment_id`,`payload`,`attempts`,`next_attempt_at`,`delivered_at`,`last_error`,`created_at`) VALUES (?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `id`=`id`")).
+		WithArgs(7, "payment.succeeded", 1, 100, sqlmock.AnyArg(), 0, sqlmock.AnyArg(), nil, "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	message := messaging.Message{EventID: 7, Type: models.EventPaymentSucceeded, MerchantID: 1, PaymentID: 100, Payload: []byte(`{}`)}
+	if err := repository.CreateMessage(&message); !errors.Is(err, messaging.ErrMessageExists) {
+		t.Fatalf("expected %v, got %v", messaging.ErrMessageExists, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestClaimOutboxEntriesSkipsLockedEntries checks that the outbox entries are claimed with a locking read skipping
+// the entries locked by another relay, and that their claim is set in the same transaction.
+func TestClaimOutboxEntriesSkipsLockedEntries(t *testing.T) {
+	repository, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `outbox_entries` WHERE sent_at IS NULL AND (claimed_until IS NULL OR claimed_until <= ?) ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED")).
+		WithArgs(sqlmock.AnyArg(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payment_id"}).AddRow(1, 100).AddRow(2, 100))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_entries` SET `claimed_until`=? WHERE id IN (?,?)")).
+		WithArgs(sqlmock.AnyArg(), 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	entries, err := repository.ClaimOutboxEntries(time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 claimed entries, got %d", len(entries))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,31 +1,250 @@
 // Package storage provides interfaces and implementations for interacting with different data storage systems.
 package storage
 
-import "github.com/arielcr/payment-gateway/internal/models"
+import (
+	"errors"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/audit"
+	"github.com/arielcr/payment-gateway/internal/messaging"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+var (
+	// ErrIdempotencyKeyExists is returned when an idempotency key is already stored for the merchant.
+	ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+	// ErrRefundExceedsBalance is returned when a refund is larger than the refundable balance of the payment.
+	ErrRefundExceedsBalance = errors.New("refund amount exceeds the refundable balance of the payment")
+
+	// ErrCreditCardExists is returned when the customer already saved a card with the same card number.
+	ErrCreditCardExists = errors.New("credit card already exists")
+
+	// ErrOrderTokenExists is returned when the merchant already has an active payment for the order token.
+	ErrOrderTokenExists = errors.New("order already has a payment")
+
+	// ErrPaymentStatusConflict is returned when the payment status changed since it was read.
+	ErrPaymentStatusConflict = errors.New("payment status was changed by another request")
+
+	// ErrRefundAlreadySettled is returned when settling a refund that is no longer pending.
+	ErrRefundAlreadySettled = errors.New("refund was already settled")
+)
 
 // Repository defines the interface for interacting with the storage system.
+// Creating payments and refunds and changing the status of payments store the outbox entries of the resulting
+// domain events in the same transaction as the change.
 type Repository interface {
-	// CreatePayment creates a new payment record in the storage system.
+	// CreatePayment creates a new payment record in the storage system, returning ErrOrderTokenExists when the
+	// merchant already has a payment for its order token.
 	CreatePayment(payment *models.Payment) error
 
-	// CreateRefund creates a new refund record in the storage system.
+	// CreateRefund creates a new pending refund record in the storage system, provided the payment can be refunded
+	// and the refund fits in its refundable balance. An amount of zero refunds the whole remaining balance.
 	CreateRefund(refund *models.Refund) error
 
+	// SettleRefund stores the final status of a pending refund and moves the payment to refunded or partially
+	// refunded accordingly, returning the updated payment. It returns ErrRefundAlreadySettled when the refund is no
+	// longer pending.
+	SettleRefund(refund *models.Refund, status models.RefundStatus) (models.Payment, error)
+
+	// GetPendingRefunds retrieves up to limit refunds with an ID greater than the given one that are pending since
+	// before the given time, in ID order.
+	GetPendingRefunds(afterID uint, before time.Time, limit int) ([]models.Refund, error)
+
+	// GetPaymentOfRefund retrieves the payment a refund belongs to from the storage system.
+	GetPaymentOfRefund(refund models.Refund) (models.Payment, error)
+
+	// GetRefunds retrieves every refund of a payment from the storage system.
+	// The payment must have been retrieved for its merchant first.
+	GetRefunds(paymentID uint) ([]models.Refund, error)
+
 	// CreateCustomer creates a new customer record in the storage system.
 	CreateCustomer(customer *models.Customer) error
 
-	// CreateCreditCard creates a new credit card record in the storage system.
+	// CreateCreditCard creates a new credit card record in the storage system, returning ErrCreditCardExists when the
+	// customer already saved a card with its fingerprint.
 	CreateCreditCard(creditCard *models.CreditCard) error
 
+	// UpdateCreditCard saves every field of an existing credit card in the storage system.
+	UpdateCreditCard(creditCard *models.CreditCard) error
+
+	// GetCreditCard retrieves a saved card of a customer of a merchant from the storage system by its token.
+	// Cards owned by other merchants are not found.
+	GetCreditCard(merchantID uint, customerID uint, token string) (models.CreditCard, error)
+
+	// FindCreditCard retrieves the saved card of a customer of a merchant with the given card number fingerprint
+	// from the storage system.
+	FindCreditCard(merchantID uint, customerID uint, fingerprint string) (models.CreditCard, error)
+
+	// GetCreditCards retrieves every saved card of a customer of a merchant from the storage system.
+	GetCreditCards(merchantID uint, customerID uint) ([]models.CreditCard, error)
+
+	// DeleteCreditCard removes a saved card of a customer of a merchant from the storage system.
+	// Cards owned by other merchants are not found.
+	DeleteCreditCard(merchantID uint, customerID uint, creditCardID uint) error
+
 	// GetMerchant retrieves a merchant record from the storage system by ID.
 	GetMerchant(merchantID uint) (models.Merchant, error)
 
-	// GetCustomer retrieves a customer record from the storage system by ID.
-	GetCustomer(customerID uint) (models.Customer, error)
+	// GetMerchantApiKey retrieves a merchant API key record that was not revoked from the storage system by the
+	// hash of the key.
+	GetMerchantApiKey(keyHash string) (models.MerchantApiKey, error)
+
+	// CreateMerchantApiKey creates a new API key record of a merchant in the storage system.
+	CreateMerchantApiKey(apiKey *models.MerchantApiKey) error
+
+	// GetMerchantApiKeys retrieves the API keys of a merchant that were not revoked from the storage system.
+	GetMerchantApiKeys(merchantID uint) ([]models.MerchantApiKey, error)
+
+	// RevokeMerchantApiKey revokes an API key of a merchant in the storage system by ID, so that it no longer
+	// authenticates requests.
+	RevokeMerchantApiKey(merchantID uint, keyID uint) error
+
+	// GetCustomer retrieves a customer record of a merchant from the storage system by ID.
+	// Customers owned by other merchants are not found.
+	GetCustomer(merchantID uint, customerID uint) (models.Customer, error)
+
+	// GetPayment retrieves a payment record of a merchant from the storage system by ID.
+	// Payments owned by other merchants are not found.
+	GetPayment(merchantID uint, paymentID string) (models.PaymentData, error)
+
+	// GetPaymentByOrderToken retrieves the latest payment record of a merchant from the storage system by its order
+	// token.
+	GetPaymentByOrderToken(merchantID uint, orderToken string) (models.PaymentData, error)
+
+	// FindPaymentByOrderToken retrieves the latest payment entity of a merchant from the storage system by its order
+	// token.
+	FindPaymentByOrderToken(merchantID uint, orderToken string) (models.Payment, error)
+
+	// FindPayments retrieves up to limit payments of a merchant matching the filter, in the order of the filter.
+	FindPayments(filter models.PaymentFilter, limit int) ([]models.PaymentSummary, error)
+
+	// FindPayment retrieves the payment entity of a merchant from the storage system by ID.
+	// Payments owned by other merchants are not found.
+	FindPayment(merchantID uint, paymentID uint) (models.Payment, error)
+
+	// GetUnsettledPayments retrieves up to limit payments with an ID greater than the given one that are pending,
+	// capturing or cancelling since before the given time, in ID order.
+	GetUnsettledPayments(afterID uint, before time.Time, limit int) ([]models.Payment, error)
+
+	// UpdatePayment saves every field of an existing payment in the storage system, provided its stored status
+	// is still the given one and the state machine allows moving to the new status.
+	UpdatePayment(payment *models.Payment, from models.PaymentStatus) error
+
+	// UpdatePaymentStatus moves a payment from one status to another in the storage system, provided its stored
+	// status is still the given one and the state machine allows the transition.
+	UpdatePaymentStatus(paymentID uint, from models.PaymentStatus, to models.PaymentStatus) error
+
+	// CreateIdempotencyKey stores a new idempotency key, returning ErrIdempotencyKeyExists when the merchant already used it.
+	CreateIdempotencyKey(key *models.IdempotencyKey) error
+
+	// GetIdempotencyKey retrieves an idempotency key of a merchant from the storage system.
+	GetIdempotencyKey(merchantID uint, key string) (models.IdempotencyKey, error)
+
+	// UpdateIdempotencyKey saves the stored response of an idempotency key in the storage system.
+	UpdateIdempotencyKey(key *models.IdempotencyKey) error
+
+	// DeleteIdempotencyKey permanently removes an idempotency key from the storage system so it can be reused.
+	DeleteIdempotencyKey(key *models.IdempotencyKey) error
+
+	// RenewIdempotencyKey renews the lock of an uncompleted idempotency key held by a request that is still running.
+	RenewIdempotencyKey(key *models.IdempotencyKey) error
+
+	// ReclaimIdempotencyKey takes over an uncompleted idempotency key whose lock was taken before the given time,
+	// reporting whether it was taken over. Only one of the requests reclaiming the same key takes it over.
+	ReclaimIdempotencyKey(key *models.IdempotencyKey, lockedBefore time.Time) (bool, error)
+
+	// DeleteExpiredIdempotencyKeys permanently removes the idempotency keys created before the given time.
+	DeleteExpiredIdempotencyKeys(before time.Time) (int64, error)
+
+	// GetRoutingRules retrieves the processor routing rules that apply to a merchant from the storage system.
+	GetRoutingRules(merchantID uint) ([]models.RoutingRule, error)
+
+	// CreateVaultEntry stores a new encrypted card number in the card vault.
+	CreateVaultEntry(entry *models.VaultEntry) error
+
+	// GetVaultEntry retrieves the encrypted card number stored behind a token from the card vault.
+	GetVaultEntry(token string) (models.VaultEntry, error)
+
+	// GetVaultEntriesToRotate retrieves up to limit vault entries encrypted with a key other than the given one.
+	GetVaultEntriesToRotate(keyID string, limit int) ([]models.VaultEntry, error)
+
+	// UpdateVaultEntry saves a re-encrypted vault entry in the storage system.
+	UpdateVaultEntry(entry *models.VaultEntry) error
+
+	// AppendAuditEntry chains an audit entry after the last stored entry and stores it in the storage system.
+	AppendAuditEntry(entry *audit.Entry) error
+
+	// GetAuditEntries retrieves up to limit audit entries with a sequence greater than the given one, in sequence order.
+	GetAuditEntries(afterSequence uint64, limit int) ([]audit.Entry, error)
+
+	// FindAuditEntries retrieves up to limit audit entries matching the filter, in sequence order.
+	FindAuditEntries(filter audit.Filter, limit int) ([]audit.Entry, error)
+
+	// CreateMessage stores a new message published to the message queue.
+	CreateMessage(message *messaging.Message) error
+
+	// ClaimMessages retrieves up to limit undelivered messages due for a new attempt and postpones their next
+	// attempt by the lease.
+	ClaimMessages(lease time.Duration, limit int) ([]messaging.Message, error)
+
+	// MarkMessageDelivered records that every subscriber handled a message.
+	MarkMessageDelivered(message *messaging.Message) error
+
+	// RescheduleMessage saves the attempts, next attempt and last error of a message that failed to be handled.
+	RescheduleMessage(message *messaging.Message) error
+
+	// ClaimOutboxEntries retrieves up to limit outbox entries not sent yet nor claimed by another relay, oldest first,
+	// and claims them for the lease.
+	ClaimOutboxEntries(lease time.Duration, limit int) ([]messaging.OutboxEntry, error)
+
+	// MarkOutboxEntrySent records that an outbox entry was published to the message queue.
+	MarkOutboxEntrySent(entry *messaging.OutboxEntry) error
+
+	// DeleteSentOutboxEntries permanently removes the outbox entries sent before the given time.
+	DeleteSentOutboxEntries(before time.Time) (int64, error)
+
+	// DeleteDeliveredMessages permanently removes the messages delivered before the given time.
+	DeleteDeliveredMessages(before time.Time) (int64, error)
+
+	// CreateWebhookEndpoint creates a new webhook endpoint record of a merchant in the storage system.
+	CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error
+
+	// GetWebhookEndpoints retrieves every webhook endpoint of a merchant from the storage system.
+	GetWebhookEndpoints(merchantID uint) ([]models.WebhookEndpoint, error)
+
+	// GetWebhookEndpoint retrieves a webhook endpoint of a merchant from the storage system by ID.
+	// Endpoints of other merchants are not found.
+	GetWebhookEndpoint(merchantID uint, endpointID uint) (models.WebhookEndpoint, error)
+
+	// DeleteWebhookEndpoint removes a webhook endpoint of a merchant from the storage system and fails its pending
+	// deliveries.
+	DeleteWebhookEndpoint(merchantID uint, endpointID uint) error
+
+	// GetWebhookSecrets retrieves the webhook signing secrets of a merchant that have not expired, newest first.
+	GetWebhookSecrets(merchantID uint) ([]models.WebhookSecret, error)
+
+	// RotateWebhookSecret stores a new webhook signing secret of a merchant, and sets the previous secrets to expire
+	// once the overlap elapses unless they expire earlier.
+	RotateWebhookSecret(secret *models.WebhookSecret, overlap time.Duration) error
+
+	// CreateWebhookDeliveries stores new webhook deliveries, skipping those of events already dispatched to their endpoint.
+	CreateWebhookDeliveries(deliveries []models.WebhookDelivery) error
+
+	// ClaimWebhookDeliveries retrieves up to limit pending webhook deliveries due for an attempt and postpones their
+	// next attempt by the lease.
+	ClaimWebhookDeliveries(lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+
+	// UpdateWebhookDelivery saves the outcome of an attempt to send a webhook delivery.
+	UpdateWebhookDelivery(delivery *models.WebhookDelivery) error
+
+	// GetWebhookDeliveries retrieves up to limit deliveries of a webhook endpoint of a merchant, most recent first.
+	GetWebhookDeliveries(merchantID uint, endpointID uint, limit int) ([]models.WebhookDelivery, error)
 
-	// GetPayment retrieves a payment record from the storage system by ID.
-	GetPayment(paymentID string) (models.PaymentData, error)
+	// GetWebhookDelivery retrieves a webhook delivery of a merchant from the storage system by ID.
+	// Deliveries of other merchants are not found.
+	GetWebhookDelivery(merchantID uint, deliveryID uint) (models.WebhookDelivery, error)
 
-	// UpdatePaymentStatus updates the status of a payment in the storage system.
-	UpdatePaymentStatus(paymentID uint, status models.PaymentStatus) error
+	// RedeliverWebhookDelivery stores a new pending delivery of the event of a webhook delivery to the same endpoint.
+	RedeliverWebhookDelivery(delivery models.WebhookDelivery) (models.WebhookDelivery, error)
 }
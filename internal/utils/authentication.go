@@ -1,10 +1,13 @@
 package utils
 
 import (
-	"time"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
 
 	"github.com/arielcr/payment-gateway/internal/config"
-	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type SignedDetails struct {
@@ -13,33 +16,70 @@ type SignedDetails struct {
 	Last_name  string
 	Uid        string
 	User_type  string
-	jwt.StandardClaims
+	Scope      string
+	jwt.RegisteredClaims
 }
 
-func ValidateToken(signedToken string, config config.Application) (claims *SignedDetails, msg string) {
-	token, err := jwt.ParseWithClaims(
+// ValidateToken validates a JWT signed with one of the allowed asymmetric algorithms by a key of the key set,
+// selected by the kid header of the token, and checks its expiration, issuer and audience. The audience claim
+// can be a single value or a list of values, one of which must be the accepted audience.
+func ValidateToken(signedToken string, keys *KeySet, config config.Application) (claims *SignedDetails, msg string) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(config.Token.Algorithms),
+		jwt.WithExpirationRequired(),
+	}
+	if config.Token.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Token.Issuer))
+	}
+	if config.Token.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Token.Audience))
+	}
+
+	token, err := jwt.NewParser(options...).ParseWithClaims(
 		signedToken,
 		&SignedDetails{},
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.SecretKey), nil
+			keyID, _ := token.Header["kid"].(string)
+			key, err := keys.Key(keyID)
+			if err != nil {
+				return nil, err
+			}
+			if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+				return nil, fmt.Errorf("key %q is not meant for %s", keyID, token.Method.Alg())
+			}
+
+			switch token.Method.(type) {
+			case *jwt.SigningMethodRSA:
+				if publicKey, ok := key.PublicKey().(*rsa.PublicKey); ok {
+					return publicKey, nil
+				}
+			case *jwt.SigningMethodECDSA:
+				if publicKey, ok := key.PublicKey().(*ecdsa.PublicKey); ok {
+					return publicKey, nil
+				}
+			}
+			return nil, fmt.Errorf("key %q cannot verify %s", keyID, token.Method.Alg())
 		},
 	)
 
-	if err != nil {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		msg = "token is expired"
+		return
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		msg = "token issuer is not trusted"
+		return
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		msg = "token audience is not accepted"
+		return
+	case err != nil:
 		msg = err.Error()
 		return
 	}
 
 	claims, ok := token.Claims.(*SignedDetails)
-	if !ok {
+	if !ok || !token.Valid {
 		msg = "the token is invalid"
-		//msg = err.Error()
-		return
-	}
-
-	if claims.ExpiresAt < time.Now().Local().Unix() {
-		msg = "token is expired"
-		//msg = err.Error()
 		return
 	}
 	return claims, msg
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestKeySet writes a key set with the public key of a new RSA key and returns the key set and the private key.
+func newTestKeySet(t *testing.T) (*KeySet, *rsa.PrivateKey) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(source, document, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return NewKeySet(source, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))), privateKey
+}
+
+func TestValidateToken(t *testing.T) {
+	keys, privateKey := newTestKeySet(t)
+	cfg := config.Application{Token: config.TokenParameters{
+		Algorithms: []string{"RS256"},
+		Issuer:     "https://idp.example.com",
+		Audience:   "payment-gateway",
+	}}
+	expiresAt := jwt.NewNumericDate(time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		claims jwt.RegisteredClaims
+		msg    string
+	}{
+		{
+			name:   "single audience",
+			claims: jwt.RegisteredClaims{Issuer: "https://idp.example.com", Audience: jwt.ClaimStrings{"payment-gateway"}, ExpiresAt: expiresAt},
+		},
+		{
+			name:   "audience list",
+			claims: jwt.RegisteredClaims{Issuer: "https://idp.example.com", Audience: jwt.ClaimStrings{"reporting", "payment-gateway"}, ExpiresAt: expiresAt},
+		},
+		{
+			name:   "audience list without the gateway",
+			claims: jwt.RegisteredClaims{Issuer: "https://idp.example.com", Audience: jwt.ClaimStrings{"reporting", "billing"}, ExpiresAt: expiresAt},
+			msg:    "token audience is not accepted",
+		},
+		{
+			name:   "untrusted issuer",
+			claims: jwt.RegisteredClaims{Issuer: "https://other.example.com", Audience: jwt.ClaimStrings{"payment-gateway"}, ExpiresAt: expiresAt},
+			msg:    "token issuer is not trusted",
+		},
+		{
+			name:   "expired",
+			claims: jwt.RegisteredClaims{Issuer: "https://idp.example.com", Audience: jwt.ClaimStrings{"payment-gateway"}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+			msg:    "token is expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, SignedDetails{Email: "support@example.com", RegisteredClaims: tt.claims})
+			token.Header["kid"] = "test-key"
+			signedToken, err := token.SignedString(privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, msg := ValidateToken(signedToken, keys, cfg)
+			if msg != tt.msg {
+				t.Fatalf("expected message %q, got %q", tt.msg, msg)
+			}
+			if tt.msg == "" && claims.Email != "support@example.com" {
+				t.Fatalf("expected the claims of the token, got %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsTokensWithoutExpirationOrAllowedAlgorithm(t *testing.T) {
+	keys, privateKey := newTestKeySet(t)
+	cfg := config.Application{Token: config.TokenParameters{Algorithms: []string{"RS256"}}}
+
+	withoutExpiration := jwt.NewWithClaims(jwt.SigningMethodRS256, SignedDetails{})
+	withoutExpiration.Header["kid"] = "test-key"
+	signedWithoutExpiration, err := withoutExpiration.SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symmetric := jwt.NewWithClaims(jwt.SigningMethodHS256, SignedDetails{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	symmetric.Header["kid"] = "test-key"
+	signedSymmetric, err := symmetric.SignedString([]byte("shared secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, signedToken := range map[string]string{"without expiration": signedWithoutExpiration, "HS256": signedSymmetric} {
+		if _, msg := ValidateToken(signedToken, keys, cfg); msg == "" {
+			t.Errorf("expected the token %s to be rejected", name)
+		}
+	}
+}
@@ -1,36 +1,11 @@
 package utils
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"regexp"
 	"strconv"
 )
 
-// TokenizeCreditCard generates a token for a credit card
-func TokenizeCreditCard(creditCardNumber string) (string, error) {
-	token, err := generateRandomToken()
-	if err != nil {
-		return "", err
-	}
-
-	return token, nil
-}
-
-// generateRandomToken generates a random token for the credit card
-func generateRandomToken() (string, error) {
-	tokenBytes := make([]byte, 32)
-	_, err := rand.Read(tokenBytes)
-	if err != nil {
-		return "", err
-	}
-
-	token := base64.URLEncoding.EncodeToString(tokenBytes)
-
-	return token, nil
-}
-
 func ValidateCreditCard(cardNumber string) error {
 	if !luhnCheck(cardNumber) {
 		return errors.New("invalid credit card number")
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// minRefreshInterval is the minimum time between two refreshes triggered by tokens with an unknown key ID,
+// so that tokens with random key IDs cannot make the gateway fetch the key set on every request.
+const minRefreshInterval = time.Minute
+
+// minRefreshBackoff and maxRefreshBackoff bound the wait after a failed refresh before the key set is fetched
+// again, which doubles with every consecutive failure so that an unavailable identity provider is not fetched on
+// every request.
+const (
+	minRefreshBackoff = 5 * time.Second
+	maxRefreshBackoff = 5 * time.Minute
+)
+
+var (
+	errUnknownKeyID       = errors.New("signing key not found in the key set")
+	errUnsupportedKeyType = errors.New("unsupported key type")
+	errUnsupportedCurve   = errors.New("unsupported elliptic curve")
+	errEmptyKeySet        = errors.New("key set has no signing keys")
+)
+
+// JSONWebKey is a public signing key of a JSON Web Key Set.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+
+	publicKey interface{}
+}
+
+// KeySet keeps the public keys of a JSON Web Key Set loaded from a local file or a URL.
+// The keys are cached and refreshed once the refresh interval elapses, or earlier when a token is signed
+// with an unknown key ID, so that the identity provider can rotate its keys without restarting the gateway.
+// Concurrent refreshes share a single fetch, and after a failed refresh the key set is not fetched again until
+// a backoff elapses.
+type KeySet struct {
+	source          string
+	refreshInterval time.Duration
+	client          *http.Client
+	logger          *slog.Logger
+	refreshes       singleflight.Group
+
+	mu          sync.RWMutex
+	keys        map[string]JSONWebKey
+	refreshedAt time.Time
+	failedAt    time.Time
+	failures    int
+}
+
+// NewKeySet creates a key set for the given file path or URL and loads its keys.
+// When the keys cannot be loaded yet, they are loaded again on the next token validation.
+func NewKeySet(source string, refreshInterval time.Duration, logger *slog.Logger) *KeySet {
+	keySet := &KeySet{
+		source:          source,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		logger:          logger,
+	}
+	if err := keySet.refresh(); err != nil {
+		logger.Error("unable to load key set", slog.String("source", source), slog.String("error", err.Error()))
+	}
+	return keySet
+}
+
+// Key returns the key with the given ID, refreshing the key set when it is stale or does not have the key.
+// When a refresh fails the cached keys keep being used until the next attempt after the backoff.
+func (k *KeySet) Key(keyID string) (JSONWebKey, error) {
+	k.mu.RLock()
+	key, found := k.keys[keyID]
+	age := time.Since(k.refreshedAt)
+	backingOff := k.failures > 0 && time.Since(k.failedAt) < refreshBackoff(k.failures)
+	k.mu.RUnlock()
+
+	if !backingOff && (age >= k.refreshInterval || (!found && age >= minRefreshInterval)) {
+		if _, err, _ := k.refreshes.Do(k.source, func() (interface{}, error) { return nil, k.refresh() }); err != nil {
+			k.logger.Error("unable to refresh key set", slog.String("error", err.Error()))
+		}
+		k.mu.RLock()
+		key, found = k.keys[keyID]
+		k.mu.RUnlock()
+	}
+
+	if !found {
+		return JSONWebKey{}, fmt.Errorf("%w: %q", errUnknownKeyID, keyID)
+	}
+	return key, nil
+}
+
+// refresh loads the keys from the source, replacing the cached ones, and records the failure when they cannot be
+// loaded.
+func (k *KeySet) refresh() error {
+	keys, err := k.load()
+	if err != nil {
+		k.mu.Lock()
+		k.failures++
+		k.failedAt = time.Now()
+		k.mu.Unlock()
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.refreshedAt = time.Now()
+	k.failures = 0
+	k.mu.Unlock()
+	return nil
+}
+
+// refreshBackoff returns the wait before fetching the key set again after the given number of consecutive failed
+// refreshes.
+func refreshBackoff(failures int) time.Duration {
+	backoff := minRefreshBackoff
+	for i := 1; i < failures && backoff < maxRefreshBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRefreshBackoff {
+		return maxRefreshBackoff
+	}
+	return backoff
+}
+
+// load reads and parses the signing keys of the key set document.
+func (k *KeySet) load() (map[string]JSONWebKey, error) {
+	data, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var document struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]JSONWebKey{}
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := key.parsePublicKey()
+		if err != nil {
+			k.logger.Warn("skipping key of the key set", slog.String("kid", key.KeyID), slog.String("error", err.Error()))
+			continue
+		}
+		key.publicKey = publicKey
+		keys[key.KeyID] = key
+	}
+	if len(keys) == 0 {
+		return nil, errEmptyKeySet
+	}
+	return keys, nil
+}
+
+// read reads the key set document from its URL or file.
+func (k *KeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(k.source, "http://") && !strings.HasPrefix(k.source, "https://") {
+		return os.ReadFile(k.source)
+	}
+
+	resp, err := k.client.Get(k.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch key set: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// PublicKey returns the parsed public key, an *rsa.PublicKey or an *ecdsa.PublicKey.
+func (j JSONWebKey) PublicKey() interface{} {
+	return j.publicKey
+}
+
+// parsePublicKey builds the public key from its JSON Web Key parameters.
+func (j JSONWebKey) parsePublicKey() (interface{}, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := decodeKeyParameter(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeKeyParameter(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if j.Curve != "P-256" {
+			return nil, fmt.Errorf("%w: %s", errUnsupportedCurve, j.Curve)
+		}
+		x, err := decodeKeyParameter(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeKeyParameter(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		point := make([]byte, 65)
+		point[0] = 4
+		if len(x.Bytes()) > 32 || len(y.Bytes()) > 32 {
+			return nil, fmt.Errorf("%w: point is not on %s", errUnsupportedCurve, j.Curve)
+		}
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("%w: point is not on %s", errUnsupportedCurve, j.Curve)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedKeyType, j.KeyType)
+	}
+}
+
+// decodeKeyParameter decodes a base64url encoded big integer parameter of a JSON Web Key.
+func decodeKeyParameter(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
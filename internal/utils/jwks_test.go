@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 1, expected: 5 * time.Second},
+		{failures: 2, expected: 10 * time.Second},
+		{failures: 3, expected: 20 * time.Second},
+		{failures: 7, expected: maxRefreshBackoff},
+		{failures: 100, expected: maxRefreshBackoff},
+	}
+
+	for _, tt := range tests {
+		if backoff := refreshBackoff(tt.failures); backoff != tt.expected {
+			t.Errorf("refreshBackoff(%d) = %s, expected %s", tt.failures, backoff, tt.expected)
+		}
+	}
+}
+
+func TestKeySetBacksOffAfterFailedRefresh(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	keys := NewKeySet(server.URL, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := 0; i < 10; i++ {
+		if _, err := keys.Key("unknown"); err == nil {
+			t.Fatal("expected the key not to be found")
+		}
+	}
+
+	if fetches.Load() != 1 {
+		t.Fatalf("expected a single fetch during the backoff, got %d", fetches.Load())
+	}
+}
+
+func TestKeySetCoalescesConcurrentRefreshes(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	keys := NewKeySet(server.URL, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	// let the backoff of the failed initial load elapse
+	keys.mu.Lock()
+	keys.failedAt = time.Now().Add(-time.Hour)
+	keys.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = keys.Key("unknown")
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches.Load() != 2 {
+		t.Fatalf("expected the initial load and one shared refresh, got %d fetches", fetches.Load())
+	}
+}
@@ -0,0 +1,104 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// keySize is the size in bytes of the AES-256 keys used by the vault.
+const keySize = 32
+
+// Define custom error messages
+var (
+	// ErrKeyNotFound is returned when an entry was encrypted with a key that is not in the keyring.
+	ErrKeyNotFound = errors.New("vault key not found")
+
+	// ErrNoActiveKey is returned when the keyring has no active key to encrypt with.
+	ErrNoActiveKey = errors.New("vault active key is not configured")
+
+	errInvalidKey        = errors.New("vault key must be a hex encoded 256-bit key")
+	errInvalidCiphertext = errors.New("vault ciphertext is too short")
+)
+
+// Keyring holds the key-encryption keys of the vault by ID.
+// The active key encrypts new entries, while the others are kept to decrypt entries until they are rotated.
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// NewKeyring creates a keyring from hex encoded keys by ID and the ID of the active key.
+func NewKeyring(keys map[string]string, active string) (*Keyring, error) {
+	keyring := &Keyring{
+		keys:   map[string][]byte{},
+		active: active,
+	}
+
+	for id, encoded := range keys {
+		key, err := hex.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("%w: %s", errInvalidKey, id)
+		}
+		keyring.keys[id] = key
+	}
+
+	if _, ok := keyring.keys[active]; !ok {
+		return nil, ErrNoActiveKey
+	}
+	return keyring, nil
+}
+
+// Active returns the ID and the key used to encrypt new entries.
+func (k *Keyring) Active() (string, []byte) {
+	return k.active, k.keys[k.active]
+}
+
+// Get returns the key with the given ID.
+func (k *Keyring) Get(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// encrypt encrypts the plaintext with AES-GCM, prefixing the ciphertext with its random nonce.
+func encrypt(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// decrypt decrypts a ciphertext produced by encrypt, failing when it was tampered with.
+func decrypt(key []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errInvalidCiphertext
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, additionalData)
+}
+
+// newGCM creates an AES-GCM cipher for the given key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
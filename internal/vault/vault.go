@@ -0,0 +1,195 @@
+// Package vault provides the card vault, which keeps card numbers encrypted behind opaque tokens.
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/storage"
+)
+
+// rotationBatchSize is the number of vault entries re-encrypted at a time during a key rotation.
+const rotationBatchSize = 100
+
+// Define custom error messages
+var (
+	errEmptyCardNumber       = errors.New("card number is required")
+	errInvalidFingerprintKey = errors.New("vault fingerprint key must be a hex encoded 256-bit key")
+)
+
+// Vault encrypts card numbers with AES-GCM and stores them behind random tokens.
+// Every card number is encrypted with its own data key, and data keys are encrypted with the active
+// key-encryption key of the keyring, so rotating keys only requires re-encrypting the stored entries.
+type Vault struct {
+	store          storage.Repository
+	keyring        *Keyring
+	fingerprintKey []byte
+	logger         *slog.Logger
+}
+
+// NewVault creates a new instance of Vault with the keyring and fingerprint key of the provided configuration.
+func NewVault(store storage.Repository, config config.Application, logger *slog.Logger) (*Vault, error) {
+	keyring, err := NewKeyring(config.Vault.Keys, config.Vault.ActiveKey)
+	if err != nil {
+		return nil, err
+	}
+	fingerprintKey, err := hex.DecodeString(config.Vault.FingerprintKey)
+	if err != nil || len(fingerprintKey) != keySize {
+		return nil, errInvalidFingerprintKey
+	}
+	return &Vault{
+		store:          store,
+		keyring:        keyring,
+		fingerprintKey: fingerprintKey,
+		logger:         logger,
+	}, nil
+}
+
+// Tokenize encrypts and stores a card number, returning the token that refers to it.
+func (v *Vault) Tokenize(cardNumber string) (string, error) {
+	v.logger.Info("Tokenizing card number")
+
+	if cardNumber == "" {
+		return "", errEmptyCardNumber
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		v.logger.Error(err.Error())
+		return "", err
+	}
+
+	entry := models.VaultEntry{Token: token}
+	if err := v.seal(&entry, cardNumber); err != nil {
+		v.logger.Error(err.Error())
+		return "", err
+	}
+
+	if err := v.store.CreateVaultEntry(&entry); err != nil {
+		v.logger.Error(err.Error())
+		return "", err
+	}
+	return token, nil
+}
+
+// Fingerprint returns a keyed hash of a card number that identifies it without revealing it,
+// so that the same card can be recognized without decrypting the stored ones.
+func (v *Vault) Fingerprint(cardNumber string) string {
+	mac := hmac.New(sha256.New, v.fingerprintKey)
+	mac.Write([]byte(cardNumber))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Detokenize decrypts the card number stored behind a token.
+// It must only be used to send the card number to an acquiring bank.
+func (v *Vault) Detokenize(token string) (string, error) {
+	v.logger.Info("Detokenizing card number")
+
+	entry, err := v.store.GetVaultEntry(token)
+	if err != nil {
+		v.logger.Error(err.Error())
+		return "", err
+	}
+
+	cardNumber, err := v.open(entry)
+	if err != nil {
+		v.logger.Error(err.Error())
+		return "", err
+	}
+	return cardNumber, nil
+}
+
+// Rotate re-encrypts every vault entry that is not encrypted with the active key-encryption key,
+// returning the number of entries re-encrypted. Retired keys can be removed from the keyring once it finishes.
+func (v *Vault) Rotate() (int, error) {
+	v.logger.Info("Rotating vault keys", slog.String("active_key", v.keyring.active))
+
+	rotated := 0
+	for {
+		entries, err := v.store.GetVaultEntriesToRotate(v.keyring.active, rotationBatchSize)
+		if err != nil {
+			v.logger.Error(err.Error())
+			return rotated, err
+		}
+		if len(entries) == 0 {
+			return rotated, nil
+		}
+
+		for i := range entries {
+			cardNumber, err := v.open(entries[i])
+			if err != nil {
+				v.logger.Error(err.Error(), slog.Uint64("entry_id", uint64(entries[i].ID)))
+				return rotated, err
+			}
+			if err := v.seal(&entries[i], cardNumber); err != nil {
+				v.logger.Error(err.Error())
+				return rotated, err
+			}
+			if err := v.store.UpdateVaultEntry(&entries[i]); err != nil {
+				v.logger.Error(err.Error())
+				return rotated, err
+			}
+			rotated++
+		}
+	}
+}
+
+// seal encrypts the card number into the entry with a new data key wrapped by the active key-encryption key.
+// The token is used as additional data so that ciphertexts cannot be swapped between entries.
+func (v *Vault) seal(entry *models.VaultEntry, cardNumber string) error {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+
+	ciphertext, err := encrypt(dataKey, []byte(cardNumber), []byte(entry.Token))
+	if err != nil {
+		return err
+	}
+
+	keyID, keyEncryptionKey := v.keyring.Active()
+	wrappedKey, err := encrypt(keyEncryptionKey, dataKey, []byte(entry.Token))
+	if err != nil {
+		return err
+	}
+
+	entry.KeyID = keyID
+	entry.WrappedKey = wrappedKey
+	entry.Ciphertext = ciphertext
+	return nil
+}
+
+// open decrypts the card number of the entry, unwrapping its data key with the key-encryption key it was sealed with.
+func (v *Vault) open(entry models.VaultEntry) (string, error) {
+	keyEncryptionKey, err := v.keyring.Get(entry.KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := decrypt(keyEncryptionKey, entry.WrappedKey, []byte(entry.Token))
+	if err != nil {
+		return "", err
+	}
+
+	cardNumber, err := decrypt(dataKey, entry.Ciphertext, []byte(entry.Token))
+	if err != nil {
+		return "", err
+	}
+	return string(cardNumber), nil
+}
+
+// generateToken generates a random URL safe token for a vault entry.
+func generateToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a webhook endpoint resolves to an address that is not publicly routable, such
+// as a loopback, private or link-local address, so that merchants cannot reach the internal network of the gateway.
+var ErrPrivateAddress = errors.New("webhook endpoint must resolve to a public address")
+
+// IsPublicIP reports whether webhook requests can be sent to the IP address, which excludes the loopback, private,
+// link-local, multicast and unspecified addresses.
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// CheckEndpointHost resolves the host of a webhook endpoint and returns ErrPrivateAddress when any of its addresses
+// is not public. The sender checks the address again when it connects, since the host can resolve differently then.
+func CheckEndpointHost(ctx context.Context, host string) error {
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPrivateAddress, err)
+	}
+	for _, address := range addresses {
+		if !IsPublicIP(address.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, address.IP)
+		}
+	}
+	return nil
+}
+
+// newTransport returns the transport of the webhook requests. Unless private addresses are allowed, it refuses to
+// connect to an address that is not public, whatever the host of the endpoint resolved to, including on redirects.
+// Requests do not go through the proxy of the environment, which would hide the address of the endpoint.
+func newTransport(timeout time.Duration, allowPrivateAddresses bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivateAddresses {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
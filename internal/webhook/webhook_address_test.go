@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{ip: "93.184.216.34", public: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", public: true},
+		{ip: "127.0.0.1"},
+		{ip: "::1"},
+		{ip: "10.0.0.8"},
+		{ip: "172.16.4.1"},
+		{ip: "192.168.1.10"},
+		{ip: "fd00::1"},
+		{ip: "169.254.169.254"},
+		{ip: "fe80::1"},
+		{ip: "0.0.0.0"},
+		{ip: "224.0.0.1"},
+		{ip: "::ffff:127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if public := IsPublicIP(net.ParseIP(tt.ip)); public != tt.public {
+			t.Errorf("IsPublicIP(%s) = %t, expected %t", tt.ip, public, tt.public)
+		}
+	}
+}
+
+func TestCheckEndpointHostRejectsPrivateAddresses(t *testing.T) {
+	for _, host := range []string{"localhost", "127.0.0.1", "10.1.2.3", "169.254.169.254", "[::1]"} {
+		if err := CheckEndpointHost(context.Background(), host); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("expected %s to be rejected, got %v", host, err)
+		}
+	}
+}
+
+func TestTransportRefusesPrivateAddresses(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTransport(time.Second, false)}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("expected %v, got %v", ErrPrivateAddress, err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected the endpoint not to be reached, got %d requests", requests)
+	}
+
+	client = &http.Client{Transport: newTransport(time.Second, true)}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected private addresses to be allowed, got %v", err)
+	}
+	response.Body.Close()
+}
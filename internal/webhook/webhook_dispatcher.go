@@ -0,0 +1,75 @@
+// Package webhook provides the delivery of the domain events to the webhook endpoints registered by the merchants.
+package webhook
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/messaging"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// Dispatcher is a messaging.MessageHandler creating a pending delivery of each event for every webhook endpoint of
+// its merchant subscribed to its type. The deliveries are sent by the Sender.
+type Dispatcher struct {
+	repository Repository
+	logger     *slog.Logger
+}
+
+// NewDispatcher creates a new instance of Dispatcher with the provided repository.
+func NewDispatcher(repository Repository, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		repository: repository,
+		logger:     logger,
+	}
+}
+
+// Subscribe subscribes the dispatcher to every type of event of the queue.
+func (d *Dispatcher) Subscribe(queue messaging.MessageQueue) {
+	for _, eventType := range models.EventTypes {
+		queue.Subscribe(eventType, d)
+	}
+}
+
+// Handle creates the deliveries of the event of the message, identified by the event ID of the message. An event
+// handled again does not create new deliveries for the endpoints it was already dispatched to.
+func (d *Dispatcher) Handle(message messaging.Message) error {
+	endpoints, err := d.repository.GetWebhookEndpoints(message.MerchantID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(models.WebhookEvent{
+		ID:        message.EventID,
+		Type:      message.Type,
+		CreatedAt: message.CreatedAt,
+		Data:      message.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(message.Type) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			EventID:       message.EventID,
+			MerchantID:    message.MerchantID,
+			EventType:     message.Type,
+			Payload:       payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	d.logger.Info("Dispatching webhook deliveries", slog.Uint64("event_id", uint64(message.EventID)), slog.Int("deliveries", len(deliveries)))
+	return d.repository.CreateWebhookDeliveries(deliveries)
+}
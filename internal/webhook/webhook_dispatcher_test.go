@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/arielcr/payment-gateway/internal/messaging"
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// fakeRepository keeps the deliveries created by the dispatcher, skipping those of events already dispatched to
+// their endpoint like the MySQL repository. Methods the tests do not need panic through the nil embedded interface.
+type fakeRepository struct {
+	Repository
+
+	endpoints  []models.WebhookEndpoint
+	deliveries map[[2]uint]models.WebhookDelivery
+}
+
+func (f *fakeRepository) GetWebhookEndpoints(merchantID uint) ([]models.WebhookEndpoint, error) {
+	return f.endpoints, nil
+}
+
+func (f *fakeRepository) CreateWebhookDeliveries(deliveries []models.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		key := [2]uint{delivery.EndpointID, delivery.EventID}
+		if _, ok := f.deliveries[key]; !ok {
+			f.deliveries[key] = delivery
+		}
+	}
+	return nil
+}
+
+func TestDispatcherIdentifiesDeliveriesByEvent(t *testing.T) {
+	endpoint := models.WebhookEndpoint{MerchantID: 1}
+	endpoint.ID = 3
+	repository := &fakeRepository{endpoints: []models.WebhookEndpoint{endpoint}, deliveries: map[[2]uint]models.WebhookDelivery{}}
+	dispatcher := NewDispatcher(repository, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// the same event stored as two messages, as when its outbox entry was relayed again
+	for _, messageID := range []uint{5, 9} {
+		message := messaging.Message{ID: messageID, EventID: 42, Type: models.EventPaymentSucceeded, MerchantID: 1, Payload: []byte(`{}`)}
+		if err := dispatcher.Handle(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(repository.deliveries) != 1 {
+		t.Fatalf("expected a single delivery of the event, got %d", len(repository.deliveries))
+	}
+	delivery := repository.deliveries[[2]uint{3, 42}]
+	var event models.WebhookEvent
+	if err := json.Unmarshal(delivery.Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != 42 {
+		t.Fatalf("expected the event id 42 in the payload, got %d", event.ID)
+	}
+}
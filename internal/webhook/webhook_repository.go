@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/models"
+)
+
+// Repository defines the storage of the webhook endpoints of the merchants and of the deliveries of events to them.
+type Repository interface {
+	// GetWebhookEndpoints retrieves every webhook endpoint of a merchant.
+	GetWebhookEndpoints(merchantID uint) ([]models.WebhookEndpoint, error)
+
+	// GetWebhookEndpoint retrieves a webhook endpoint of a merchant by ID.
+	GetWebhookEndpoint(merchantID uint, endpointID uint) (models.WebhookEndpoint, error)
+
+	// GetWebhookSecrets retrieves the signing secrets of a merchant that have not expired, newest first.
+	GetWebhookSecrets(merchantID uint) ([]models.WebhookSecret, error)
+
+	// CreateWebhookDeliveries stores new deliveries, skipping those of events already dispatched to their endpoint.
+	CreateWebhookDeliveries(deliveries []models.WebhookDelivery) error
+
+	// ClaimWebhookDeliveries retrieves up to limit pending deliveries whose next attempt is due, and postpones their
+	// next attempt by the lease so that they are not claimed again while they are being sent.
+	ClaimWebhookDeliveries(lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+
+	// UpdateWebhookDelivery saves the outcome of an attempt to send a delivery.
+	UpdateWebhookDelivery(delivery *models.WebhookDelivery) error
+}
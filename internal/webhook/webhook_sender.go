@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arielcr/payment-gateway/internal/config"
+	"github.com/arielcr/payment-gateway/internal/models"
+	"github.com/arielcr/payment-gateway/internal/models/signature"
+)
+
+// maxResponseSize is the number of bytes of the response of an endpoint read before the connection is released.
+const maxResponseSize = 64 << 10
+
+// Define custom error messages
+var (
+	errUnexpectedStatus = errors.New("webhook endpoint responded with a non 2xx status")
+)
+
+// Sender sends the pending webhook deliveries to their endpoints. A delivery is sent again after an exponential
+// backoff until its endpoint responds with a 2xx status, and it is marked as failed once the attempts run out.
+// Endpoints resolving to an address that is not public are not connected to, and their attempts fail.
+type Sender struct {
+	repository   Repository
+	client       *http.Client
+	workers      int
+	batchSize    int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+	maxBackoff   time.Duration
+	logger       *slog.Logger
+
+	deliveries chan models.WebhookDelivery
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewSender creates a new instance of Sender with the provided repository and webhook configuration.
+func NewSender(repository Repository, config config.Application, logger *slog.Logger) *Sender {
+	return &Sender{
+		repository: repository,
+		client: &http.Client{
+			Timeout:   config.Webhook.Timeout,
+			Transport: newTransport(config.Webhook.Timeout, config.Webhook.AllowPrivateAddresses),
+		},
+		workers:      config.Webhook.Workers,
+		batchSize:    config.Webhook.BatchSize,
+		pollInterval: config.Webhook.PollInterval,
+		lease:        config.Webhook.Lease,
+		maxAttempts:  config.Webhook.MaxAttempts,
+		retryBackoff: config.Webhook.RetryBackoff,
+		maxBackoff:   config.Webhook.MaxBackoff,
+		logger:       logger,
+		deliveries:   make(chan models.WebhookDelivery),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start starts the workers sending the deliveries and the poll of the deliveries due for an attempt.
+func (s *Sender) Start() {
+	s.logger.Info("Starting webhook sender", slog.Int("workers", s.workers))
+
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	s.wg.Add(1)
+	go s.poll()
+}
+
+// Stop stops the workers and the poll, waiting for the deliveries being sent.
+// Deliveries claimed but not sent yet are sent after the next start once their lease expires.
+func (s *Sender) Stop() {
+	s.logger.Info("Stopping webhook sender")
+
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// work sends deliveries until the sender is stopped.
+func (s *Sender) work() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case delivery := <-s.deliveries:
+			s.deliver(delivery)
+		}
+	}
+}
+
+// poll periodically claims the deliveries due for an attempt and hands them to the workers.
+func (s *Sender) poll() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		deliveries, err := s.repository.ClaimWebhookDeliveries(s.lease, s.batchSize)
+		if err != nil {
+			s.logger.Error(err.Error())
+			continue
+		}
+		for _, delivery := range deliveries {
+			select {
+			case <-s.stop:
+				return
+			case s.deliveries <- delivery:
+			}
+		}
+	}
+}
+
+// deliver makes an attempt to send the delivery and saves its outcome.
+func (s *Sender) deliver(delivery models.WebhookDelivery) {
+	delivery.Attempts++
+	statusCode, err := s.send(delivery)
+	delivery.LastResponseStatus = statusCode
+
+	if err == nil {
+		deliveredAt := time.Now()
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &deliveredAt
+		delivery.LastError = ""
+	} else {
+		s.logger.Error(err.Error(), slog.Uint64("delivery_id", uint64(delivery.ID)), slog.Int("attempts", delivery.Attempts))
+
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= s.maxAttempts {
+			delivery.Status = models.WebhookDeliveryFailed
+		} else {
+			delivery.NextAttemptAt = time.Now().Add(s.backoff(delivery.Attempts))
+		}
+	}
+
+	if err := s.repository.UpdateWebhookDelivery(&delivery); err != nil {
+		s.logger.Error(err.Error())
+	}
+}
+
+// send posts the payload of the delivery to its endpoint, signed at the time of the attempt with every active
+// secret of the merchant, and returns the status the endpoint responded with.
+func (s *Sender) send(delivery models.WebhookDelivery) (int, error) {
+	endpoint, err := s.repository.GetWebhookEndpoint(delivery.MerchantID, delivery.EndpointID)
+	if err != nil {
+		return 0, err
+	}
+
+	secrets, err := s.repository.GetWebhookSecrets(delivery.MerchantID)
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		keys = append(keys, secret.Secret)
+	}
+	header, err := signature.Sign(delivery.Payload, time.Now(), keys...)
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventTypeHeader, string(delivery.EventType))
+	request.Header.Set(DeliveryIDHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	request.Header.Set(signature.Header, header)
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseSize))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("%w: %d", errUnexpectedStatus, response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt of a delivery that failed the given number of times,
+// doubling from the retry backoff up to the maximum backoff.
+func (s *Sender) backoff(attempts int) time.Duration {
+	delay := s.retryBackoff
+	for i := 1; i < attempts && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.maxBackoff {
+		return s.maxBackoff
+	}
+	return delay
+}
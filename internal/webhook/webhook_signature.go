@@ -0,0 +1,24 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// Headers of the requests sent to webhook endpoints besides the signature header.
+const (
+	EventTypeHeader  = "Gateway-Event-Type"
+	DeliveryIDHeader = "Gateway-Delivery-ID"
+)
+
+// secretPrefix prefixes the webhook signing secrets so that they are recognizable.
+const secretPrefix = "whsec_"
+
+// GenerateSecret generates a random secret for signing the requests sent to the webhook endpoints of a merchant.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}